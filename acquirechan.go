@@ -0,0 +1,138 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"time"
+)
+
+// AcquireChan starts acquiring the semaphore with a weight of n without
+// blocking, for callers that wait for it in a select statement alongside other
+// channels. The returned channel receives exactly one value: nil once the
+// weight is acquired, after which the caller holds it and must release it, or
+// the error Acquire would have returned, e.g. a *StateError, ErrQueueFull or
+// ErrRequestTooLarge.
+//
+// cancel abandons the acquisition, reporting whether it did. It returns false
+// if the weight was acquired first, whether or not the nil was received yet;
+// the caller then holds the weight as if it hadn't canceled.
+//
+// Since there is no context, WithMaxWait and WithProgress don't apply to the
+// wait; time out with a case in the select instead. Unlike a blocked Acquire,
+// the wait is counted by the instrumentation but neither observed nor traced.
+func (s *Weighted) AcquireChan(n int64) (acquired <-chan error, cancel func() bool) {
+	result := make(chan error, 1)
+	cancel = s.acquireNotify(n, func(err error) { result <- err })
+	return result, cancel
+}
+
+// acquireNotify implements AcquireChan, calling notify exactly once with the
+// outcome of the acquisition unless it is canceled first. notify may be called
+// with s.mu held, so it must not block.
+func (s *Weighted) acquireNotify(n int64, notify func(error)) (cancel func() bool) {
+	s.lock()
+	if err := s.refused(); err != nil {
+		s.mu.Unlock()
+		s.count("semaphore.rejections", 1)
+		notify(err)
+		return func() bool { return true }
+	}
+	if s.strict && n > s.size {
+		s.counters.tooLarge++
+		s.mu.Unlock()
+		s.count("semaphore.rejections", 1)
+		notify(ErrRequestTooLarge)
+		return func() bool { return true }
+	}
+	if s.state == StateOpen && s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.acquired(n)
+		s.waited(0)
+		s.usageChanged()
+		s.mu.Unlock()
+		s.count("semaphore.acquires", 1)
+		s.hookAcquire(n, 0)
+		notify(nil)
+		return func() bool { return false }
+	}
+
+	var slot *waiter
+	if s.slots != nil {
+		slot = s.newWaiter(n, n)
+	}
+	if (s.slots != nil && slot == nil) || s.queueFull() {
+		s.mu.Unlock()
+		s.count("semaphore.rejections", 1)
+		notify(ErrQueueFull)
+		return func() bool { return true }
+	}
+	w := &waiter{n: n, max: n, notify: notify, slot: slot, strict: s.strict, ctx: context.Background(), enqueued: time.Now()}
+	if n > s.size {
+		s.impossibleWaiters.PushBack(w)
+	} else {
+		s.waiters.PushBack(w)
+	}
+	s.queueChanged()
+	s.mu.Unlock()
+	s.hookWaitStart(n)
+
+	return func() bool {
+		s.lock()
+		defer s.mu.Unlock()
+		if w.list == nil {
+			// Already admitted, failed or canceled.
+			return w.err != nil
+		}
+		w.list.Remove(w)
+		w.err = context.Canceled
+		s.counters.cancellations++
+		s.waited(time.Since(w.enqueued))
+		s.freeSlot(w)
+		s.queueChanged()
+		s.count("semaphore.cancellations", 1)
+		s.postWaitEnd(w)
+		return true
+	}
+}
+
+// wake notifies w, which has left the queue, that it was admitted or failed.
+// Must be called with s.mu held.
+func (s *Weighted) wake(w *waiter) {
+	if w.notify == nil {
+		// Sent by unlock, so that waking many waiters doesn't hold up s.mu.
+		if s.wokenTail == nil {
+			s.woken = w
+		} else {
+			s.wokenTail.wakeNext = w
+		}
+		s.wokenTail = w
+		return
+	}
+	s.freeSlot(w)
+	w.notify(w.err)
+	if w.err != nil {
+		s.count("semaphore.cancellations", 1)
+	} else {
+		s.count("semaphore.acquires", 1)
+	}
+	s.postWaitEnd(w)
+}
+
+// postWaitEnd posts the hooks for the end of the wait of w, started by
+// AcquireChan, if any. Must be called with s.mu held.
+func (s *Weighted) postWaitEnd(w *waiter) {
+	if s.hooks == nil {
+		return
+	}
+	n, enqueued, err := w.n, w.enqueued, w.err
+	s.callbacks.post(func() { s.hookWaitEnd(n, enqueued, n, err) })
+}
+
+// freeSlot returns the preallocated waiter held by w, if any, to the
+// preallocated waiters. Must be called with s.mu held.
+func (s *Weighted) freeSlot(w *waiter) {
+	if w.slot != nil {
+		s.freeWaiter(w.slot)
+		w.slot = nil
+	}
+}
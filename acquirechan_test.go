@@ -0,0 +1,83 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedAcquireChan(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	acquired, _ := sem.AcquireChan(2)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+
+	acquired, cancel := sem.AcquireChan(1)
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquired a full semaphore: %v", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+	sem.Release(2)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AcquireChan not admitted after release")
+	}
+	if cancel() {
+		t.Error("cancel abandoned an acquisition that succeeded")
+	}
+	if cur := sem.Current(); cur != 1 {
+		t.Errorf("got current %d, want 1", cur)
+	}
+	sem.Release(1)
+}
+
+func TestWeightedAcquireChanCancel(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+	_, cancel := sem.AcquireChan(1)
+	_, cancelImpossible := sem.AcquireChan(2)
+	if !cancel() || !cancelImpossible() || !cancel() {
+		t.Error("cancel didn't abandon queued acquisitions")
+	}
+	if n := sem.Waiters(); n != 0 {
+		t.Errorf("got %d waiters after cancel, want 0", n)
+	}
+	sem.Release(1)
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("canceled acquisition got weight, current %d", cur)
+	}
+}
+
+func TestWeightedAcquireChanFailures(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1, WithPreallocatedWaiters(1))
+	sem.Acquire(context.Background(), 1)
+	queued, cancel := sem.AcquireChan(1)
+	if full, _ := sem.AcquireChan(1); <-full != ErrQueueFull {
+		t.Error("AcquireChan beyond the preallocated waiters didn't fail with ErrQueueFull")
+	}
+
+	sem.Close(nil)
+	if err := <-queued; err != ErrClosed {
+		t.Errorf("queued AcquireChan got %v, want ErrClosed", err)
+	}
+	if !cancel() {
+		t.Error("cancel of a failed acquisition reported the weight held")
+	}
+	if closed, _ := sem.AcquireChan(1); <-closed == nil {
+		t.Error("AcquireChan succeeded on a closed semaphore")
+	}
+}
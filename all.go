@@ -0,0 +1,49 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "context"
+
+// AcquireAll acquires the whole size of the semaphore, blocking until every
+// holder has released or ctx is done, for writer-style exclusive access. The
+// size is the one at the time of admission: a Resize while AcquireAll waits
+// changes how much it waits for. On success, returns the granted weight, which
+// ReleaseAll releases, so a Resize while it is held doesn't break the pairing.
+// On failure, returns ctx.Err() and leaves the semaphore unchanged.
+//
+// A Resize that grows the semaphore while the whole of it is held makes the
+// new weight available to others.
+func (s *Weighted) AcquireAll(ctx context.Context) (int64, error) {
+	granted, err := s.acquire(ctx, request{all: true})
+	if err != nil {
+		return 0, err
+	}
+	s.lock()
+	s.allHeld = append(s.allHeld, granted)
+	s.mu.Unlock()
+	return granted, nil
+}
+
+// ReleaseAll releases the weight granted by the earliest AcquireAll not yet
+// released. It panics if there is none.
+func (s *Weighted) ReleaseAll() {
+	s.lock()
+	if len(s.allHeld) == 0 {
+		s.mu.Unlock()
+		panic("semaphore: ReleaseAll without AcquireAll")
+	}
+	n := s.allHeld[0]
+	s.allHeld = s.allHeld[1:]
+	s.mu.Unlock()
+	s.Release(n)
+}
+
+// followSize makes the AcquireAll waiters of l wait for the current size. Must
+// be called with s.mu held.
+func (s *Weighted) followSize(l *waiterList) {
+	for w := l.Front(); w != nil; w = w.Next() {
+		if w.all {
+			w.n, w.max = s.size, s.size
+		}
+	}
+}
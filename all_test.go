@@ -0,0 +1,51 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedAcquireAll(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4)
+	sem.Acquire(ctx, 2) // A reader.
+
+	type result struct {
+		n   int64
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		n, err := sem.AcquireAll(ctx)
+		done <- result{n, err}
+	}()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The writer waits for the size at the time of admission.
+	sem.Resize(3)
+	sem.Release(2)
+	if r := <-done; r.err != nil || r.n != 3 {
+		t.Fatalf("AcquireAll = %d, %v; want 3, nil", r.n, r.err)
+	}
+
+	// A Resize while held doesn't break the pairing.
+	sem.Resize(8)
+	sem.ReleaseAll()
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d after ReleaseAll, want 0", cur)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("ReleaseAll without AcquireAll didn't panic")
+		}
+	}()
+	sem.ReleaseAll()
+}
@@ -0,0 +1,22 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// AcquireAsync starts acquiring the semaphore with a weight of n without
+// blocking, and calls fn with the outcome, for event-loop servers that can't
+// park a goroutine per pending acquisition: nil once the weight is acquired,
+// after which the caller holds it and must release it, or the error Acquire
+// would have returned.
+//
+// fn runs on the goroutine of the queue callbacks, never under the semaphore's
+// lock and never before AcquireAsync returns. It runs after the callbacks
+// posted before it, and delays those posted after, so it must hand any long
+// work off to a goroutine of its own.
+//
+// cancel abandons the acquisition, as the cancel func of AcquireChan does; fn
+// is not called for an abandoned acquisition.
+func (s *Weighted) AcquireAsync(n int64, fn func(err error)) (cancel func() bool) {
+	return s.acquireNotify(n, func(err error) {
+		s.callbacks.post(func() { fn(err) })
+	})
+}
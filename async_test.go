@@ -0,0 +1,48 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeightedAcquireAsync(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	results := make(chan error, 3)
+	sem.AcquireAsync(1, func(err error) { results <- err })
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+
+	canceled := sem.AcquireAsync(1, func(err error) { results <- err })
+	sem.AcquireAsync(1, func(err error) { results <- err })
+	if !canceled() {
+		t.Fatal("cancel of a waiting acquisition failed")
+	}
+	select {
+	case err := <-results:
+		t.Fatalf("called back before the weight was released: %v", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+	sem.Release(1)
+	if err := <-results; err != nil {
+		t.Fatal(err)
+	}
+	if cur := sem.Current(); cur != 1 {
+		t.Errorf("got current %d, want 1", cur)
+	}
+
+	sem.Close(nil)
+	sem.AcquireAsync(1, func(err error) { results <- err })
+	if err := <-results; err != ErrClosed {
+		t.Errorf("got %v from a closed semaphore, want ErrClosed", err)
+	}
+	select {
+	case err := <-results:
+		t.Errorf("the canceled acquisition was called back with %v", err)
+	default:
+	}
+}
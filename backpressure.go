@@ -0,0 +1,116 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "sync"
+
+// Backpressure is a latched signal of a semaphore's utilization, the fraction of
+// its size in use. It becomes saturated when utilization reaches a high
+// threshold and clears only once utilization falls to a lower one, so producers
+// selecting on it don't flap around a single threshold.
+type Backpressure struct {
+	s         *Weighted
+	high, low float64
+	mu        sync.Mutex
+	saturated bool
+	sat       chan struct{} // Closed while saturated.
+	clear     chan struct{} // Closed while not saturated.
+}
+
+// Backpressure creates a new signal on s that saturates when utilization
+// reaches high and clears when it falls to low. Call Stop when done with it.
+func (s *Weighted) Backpressure(high, low float64) *Backpressure {
+	if low > high {
+		panic("semaphore: backpressure low threshold above high")
+	}
+	b := &Backpressure{s: s, high: high, low: low, sat: make(chan struct{}), clear: make(chan struct{})}
+	close(b.clear)
+
+	s.lock()
+	s.signals = append(s.signals, b)
+	b.update(s.utilization())
+	s.mu.Unlock()
+	return b
+}
+
+// Saturated returns a channel that is closed while the semaphore is saturated.
+// Once the signal clears, a new channel is returned.
+func (b *Backpressure) Saturated() <-chan struct{} {
+	b.mu.Lock()
+	ch := b.sat
+	b.mu.Unlock()
+	return ch
+}
+
+// Clear returns a channel that is closed while the semaphore is not saturated.
+// Producers can wait on it before generating more work. Once the signal
+// saturates, a new channel is returned.
+func (b *Backpressure) Clear() <-chan struct{} {
+	b.mu.Lock()
+	ch := b.clear
+	b.mu.Unlock()
+	return ch
+}
+
+// IsSaturated returns whether the semaphore is saturated.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (b *Backpressure) IsSaturated() bool {
+	b.mu.Lock()
+	saturated := b.saturated
+	b.mu.Unlock()
+	return saturated
+}
+
+// Stop detaches the signal from its semaphore. Its channels stop changing.
+func (b *Backpressure) Stop() {
+	s := b.s
+	s.lock()
+	for i, signal := range s.signals {
+		if signal == b {
+			s.signals = append(s.signals[:i], s.signals[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+}
+
+// update latches the signal for the given utilization.
+func (b *Backpressure) update(utilization float64) {
+	b.mu.Lock()
+	switch {
+	case !b.saturated && utilization >= b.high:
+		b.saturated = true
+		close(b.sat)
+		b.clear = make(chan struct{})
+	case b.saturated && utilization <= b.low:
+		b.saturated = false
+		close(b.clear)
+		b.sat = make(chan struct{})
+	}
+	b.mu.Unlock()
+}
+
+// utilization returns the fraction of the size in use; a semaphore of size 0
+// is fully utilized. Must be called with s.mu held.
+func (s *Weighted) utilization() float64 {
+	if s.size <= 0 {
+		return 1
+	}
+	return float64(s.cur) / float64(s.size)
+}
+
+// usageChanged updates the backpressure signals and utilization warning, and
+// wakes WaitIdle calls, after cur or size changed. Must be called with s.mu held.
+func (s *Weighted) usageChanged() {
+	s.checkIdle()
+	if len(s.signals) == 0 && s.warning == nil {
+		return
+	}
+	utilization := s.utilization()
+	if s.warning != nil {
+		s.checkUtilization(utilization)
+	}
+	for _, b := range s.signals {
+		b.update(utilization)
+	}
+}
@@ -0,0 +1,54 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBackpressure(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(10)
+	b := sem.Backpressure(0.8, 0.5)
+	defer b.Stop()
+
+	clear := b.Clear()
+	select {
+	case <-clear:
+	default:
+		t.Fatal("idle semaphore is not clear")
+	}
+
+	sem.Acquire(ctx, 8)
+	select {
+	case <-b.Saturated():
+	default:
+		t.Fatal("semaphore at 80% is not saturated")
+	}
+
+	// Between the thresholds the signal stays latched.
+	sem.Release(2)
+	if !b.IsSaturated() {
+		t.Error("signal cleared above the low threshold")
+	}
+
+	sem.Release(1)
+	select {
+	case <-b.Clear():
+	default:
+		t.Fatal("semaphore at 50% is not clear")
+	}
+
+	// Growing the semaphore lowers its utilization too.
+	sem.Acquire(ctx, 5)
+	if !b.IsSaturated() {
+		t.Fatal("semaphore at 100% is not saturated")
+	}
+	sem.Resize(20)
+	if b.IsSaturated() {
+		t.Error("signal still saturated at 50% after Resize")
+	}
+}
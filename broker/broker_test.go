@@ -0,0 +1,118 @@
+package broker
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Semaphore)(nil)
+
+// serve starts a broker with the given size on a socket of a temporary
+// directory, and returns its path.
+func serve(t *testing.T, size int64) string {
+	path := filepath.Join(t.TempDir(), "sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go NewServer(size).Serve(l)
+	return path
+}
+
+func dial(t *testing.T, path string) *Client {
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestBroker(t *testing.T) {
+	ctx := context.Background()
+	path := serve(t, 3)
+	a := dial(t, path).Semaphore("backups")
+	b := dial(t, path).Semaphore("backups")
+
+	tries := []bool{}
+	tries = append(tries, a.TryAcquire(2)) // true;  2/3
+	tries = append(tries, b.TryAcquire(2)) // false; shared with a
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	want := []bool{true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Acquire(ctx, 2) }()
+	time.Sleep(5 * time.Millisecond)
+	a.Release(2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if cur, err := a.Current(ctx); err != nil || cur != 3 {
+		t.Errorf("got current %d, %v; want 3, nil", cur, err)
+	}
+
+	if err := a.Resize(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if size, err := b.Size(ctx); err != nil || size != 5 {
+		t.Errorf("got size %d, %v; want 5, nil", size, err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(tctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if cur, _ := a.Current(ctx); cur != 3 {
+		t.Errorf("got current %d, want the canceled acquisition left out", cur)
+	}
+}
+
+func TestBrokerReclaim(t *testing.T) {
+	ctx := context.Background()
+	path := serve(t, 2)
+	crashed := dial(t, path)
+	live := dial(t, path).Semaphore("backups")
+
+	if !crashed.Semaphore("backups").TryAcquire(2) {
+		t.Fatal("TryAcquire failed")
+	}
+	pending := make(chan error)
+	go func() { pending <- crashed.Semaphore("backups").Acquire(ctx, 1) }()
+	time.Sleep(5 * time.Millisecond)
+
+	// The holds and pending acquisitions of a client are gone with its
+	// connection.
+	crashed.Close()
+	if err := <-pending; err != ErrClosed {
+		t.Errorf("got %v, want %v", err, ErrClosed)
+	}
+	if err := live.Acquire(ctx, 2); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if cur, _ := live.Current(ctx); cur != 2 {
+		t.Errorf("got current %d, want 2", cur)
+	}
+}
+
+func TestBrokerBadRelease(t *testing.T) {
+	s := dial(t, serve(t, 1)).Semaphore("backups")
+	defer func() {
+		if recover() == nil {
+			t.Error("Release of a weight not held didn't panic")
+		}
+	}()
+	s.Release(1)
+}
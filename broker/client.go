@@ -0,0 +1,252 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrClosed is returned by the calls of a Client whose connection to the broker
+// is closed.
+var ErrClosed = errors.New("broker: connection closed")
+
+// Client is a connection to a broker. Its holds last as long as it does.
+type Client struct {
+	conn    net.Conn
+	wmu     sync.Mutex // Serializes requests.
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[string]chan string // Replies by request ID.
+	held    map[string]int64       // Weight held by semaphore name.
+	done    chan struct{}          // Closed when the connection is.
+}
+
+// Dial connects to the broker listening on the Unix socket at path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient creates a new Client over conn, a connection to a broker.
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		pending: make(map[string]chan string),
+		held:    make(map[string]int64),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+// Close closes the connection to the broker, which releases every hold of the
+// client.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Semaphore returns the broker's semaphore called name. It panics if name is
+// empty or contains white space.
+func (c *Client) Semaphore(name string) *Semaphore {
+	if name == "" || strings.ContainsFunc(name, unicode.IsSpace) {
+		panic("broker: bad name")
+	}
+	return &Semaphore{c: c, name: name}
+}
+
+// read dispatches the replies of the broker to their requests, until the
+// connection closes.
+func (c *Client) read() {
+	defer close(c.done)
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		id, msg, _ := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		c.mu.Lock()
+		reply, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			reply <- msg
+		}
+	}
+}
+
+// send sends a request, returning its ID and the channel its reply will be
+// sent on.
+func (c *Client) send(op, name string, args ...int64) (string, chan string, error) {
+	c.mu.Lock()
+	c.nextID++
+	id := strconv.FormatUint(c.nextID, 10)
+	reply := make(chan string, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	if err := c.write(id, op, name, args...); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return "", nil, err
+	}
+	return id, reply, nil
+}
+
+func (c *Client) write(id, op, name string, args ...int64) error {
+	req := id + " " + op
+	if name != "" {
+		req += " " + name
+	}
+	for _, arg := range args {
+		req += " " + strconv.FormatInt(arg, 10)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.conn.Write([]byte(req + "\n")); err != nil {
+		return ErrClosed
+	}
+	return nil
+}
+
+// call sends a request and returns the value of its reply.
+func (c *Client) call(ctx context.Context, op, name string, args ...int64) (string, error) {
+	_, reply, err := c.send(op, name, args...)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case msg := <-reply:
+		return parseReply(msg)
+	case <-c.done:
+		return "", ErrClosed
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// parseReply returns the value of an "ok" reply, or the error of an "err" one.
+func parseReply(msg string) (string, error) {
+	status, value, _ := strings.Cut(msg, " ")
+	if status != "ok" {
+		return "", fmt.Errorf("broker: %s", value)
+	}
+	return value, nil
+}
+
+// Semaphore is a semaphore of a broker, shared by its clients.
+type Semaphore struct {
+	c    *Client
+	name string
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available, ctx is done or the connection closes. On success, returns nil.
+// On failure, returns ctx.Err() or the error of the broker, and leaves the
+// semaphore unchanged.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	id, reply, err := s.c.send("acquire", s.name, n)
+	if err != nil {
+		return err
+	}
+
+	var msg string
+	select {
+	case msg = <-reply:
+	case <-s.c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		// The broker answers a canceled acquisition too, and may have
+		// admitted it meanwhile.
+		s.c.write(id, "cancel", "")
+		select {
+		case msg = <-reply:
+		case <-s.c.done:
+			return ctx.Err()
+		}
+		if _, err := parseReply(msg); err != nil {
+			return ctx.Err()
+		}
+	}
+	if _, err := parseReply(msg); err != nil {
+		return err
+	}
+	s.hold(n)
+	return nil
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including a closed connection, returns
+// false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	if _, err := s.c.call(context.Background(), "tryacquire", s.name, n); err != nil {
+		return false
+	}
+	s.hold(n)
+	return true
+}
+
+// Release releases a weight of n held by the client. It panics if the client
+// holds less.
+//
+// If the connection is closed, the broker already released every hold of the
+// client, so Release has nothing left to do.
+func (s *Semaphore) Release(n int64) {
+	s.c.mu.Lock()
+	if s.c.held[s.name] < n {
+		s.c.mu.Unlock()
+		panic("broker: bad release")
+	}
+	s.c.held[s.name] -= n
+	s.c.mu.Unlock()
+	s.c.call(context.Background(), "release", s.name, n)
+}
+
+// Resize sets the size of the semaphore for every client of the broker.
+func (s *Semaphore) Resize(ctx context.Context, n int64) error {
+	if n < 0 {
+		panic("broker: bad resize")
+	}
+	_, err := s.c.call(ctx, "resize", s.name, n)
+	return err
+}
+
+// Size returns the size of the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Size(ctx context.Context) (int64, error) {
+	return s.read(ctx, "size")
+}
+
+// Current returns the weight held by every client of the broker.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Current(ctx context.Context) (int64, error) {
+	return s.read(ctx, "current")
+}
+
+func (s *Semaphore) read(ctx context.Context, op string) (int64, error) {
+	value, err := s.c.call(ctx, op, s.name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("broker: bad reply %q", value)
+	}
+	return n, nil
+}
+
+func (s *Semaphore) hold(n int64) {
+	s.c.mu.Lock()
+	s.c.held[s.name] += n
+	s.c.mu.Unlock()
+}
@@ -0,0 +1,223 @@
+// Package broker shares weighted semaphores between the processes of a host,
+// e.g. CLI invocations or cron jobs, through a broker serving them over a Unix
+// domain socket. The broker is run by cmd/semaphored, or embedded with Server.
+//
+// The holds of a client are tied to its connection: when the connection
+// closes, because the client exited or crashed, the broker releases every hold
+// it left and cancels its pending acquisitions, so a dead client never keeps
+// capacity.
+//
+// The protocol is line-based: a client sends requests of an ID, an operation,
+// and its arguments, e.g. "7 acquire backups 2", and the broker answers each
+// with its ID and either "ok", followed by a value for "size" and "current",
+// or "err" and a message. Requests are served concurrently, so a blocked
+// acquisition doesn't hold up the others of its client, and "cancel" with the
+// ID of a pending acquisition abandons it.
+package broker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+// Server serves named semaphores to the clients of a broker.
+type Server struct {
+	size int64
+	mu   sync.Mutex
+	sems map[string]*semaphore.Weighted
+}
+
+// NewServer creates a new Server whose semaphores have the given size until
+// they are resized.
+func NewServer(size int64) *Server {
+	if size < 0 {
+		panic("broker: bad size")
+	}
+	return &Server{size: size, sems: make(map[string]*semaphore.Weighted)}
+}
+
+// Serve accepts connections on l and serves each in its own goroutine, until
+// accepting fails, and returns that error.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// sem returns the semaphore called name, created on first use.
+func (s *Server) sem(name string) *semaphore.Weighted {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.sems[name]
+	if !ok {
+		sem = semaphore.NewWeighted(s.size)
+		s.sems[name] = sem
+	}
+	return sem
+}
+
+// serverConn is the state of a client's connection.
+type serverConn struct {
+	s       *Server
+	conn    net.Conn
+	wmu     sync.Mutex // Serializes replies.
+	mu      sync.Mutex
+	closed  bool
+	held    map[string]int64              // Weight held by semaphore name.
+	pending map[string]context.CancelFunc // Acquisitions by request ID.
+	wg      sync.WaitGroup
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	c := &serverConn{s: s, conn: conn, held: make(map[string]int64), pending: make(map[string]context.CancelFunc)}
+	defer c.reclaim()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return // The client closed the connection, or died.
+		}
+		c.handle(strings.Fields(line))
+	}
+}
+
+// reclaim cancels the pending acquisitions of the connection, waits for them,
+// and releases every hold it left.
+func (c *serverConn) reclaim() {
+	c.mu.Lock()
+	c.closed = true
+	for _, cancel := range c.pending {
+		cancel()
+	}
+	c.mu.Unlock()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, n := range c.held {
+		c.s.sem(name).Release(n)
+	}
+	c.held = nil
+	c.conn.Close()
+}
+
+func (c *serverConn) handle(req []string) {
+	if len(req) < 2 {
+		return // Can't be answered without an ID.
+	}
+	id, op, args := req[0], req[1], req[2:]
+	if op == "cancel" {
+		c.mu.Lock()
+		if cancel, ok := c.pending[id]; ok {
+			cancel()
+		}
+		c.mu.Unlock()
+		return // The acquisition answers.
+	}
+	if len(args) == 0 {
+		c.reply(id, "err missing semaphore name")
+		return
+	}
+	name, sem := args[0], c.s.sem(args[0])
+
+	switch op {
+	case "size":
+		c.reply(id, "ok "+strconv.FormatInt(sem.Size(), 10))
+		return
+	case "current":
+		c.reply(id, "ok "+strconv.FormatInt(sem.Current(), 10))
+		return
+	}
+
+	if len(args) != 2 {
+		c.reply(id, "err missing weight")
+		return
+	}
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n < 0 {
+		c.reply(id, "err bad weight")
+		return
+	}
+
+	switch op {
+	case "acquire":
+		c.acquire(id, name, sem, n)
+	case "tryacquire":
+		if !sem.TryAcquire(n) {
+			c.reply(id, "err unavailable")
+			return
+		}
+		c.mu.Lock()
+		c.held[name] += n
+		c.mu.Unlock()
+		c.reply(id, "ok")
+	case "release":
+		c.mu.Lock()
+		if c.held[name] < n {
+			c.mu.Unlock()
+			c.reply(id, "err bad release")
+			return
+		}
+		c.held[name] -= n
+		c.mu.Unlock()
+		sem.Release(n)
+		c.reply(id, "ok")
+	case "resize":
+		sem.Resize(n)
+		c.reply(id, "ok")
+	default:
+		c.reply(id, "err unknown operation "+strconv.Quote(op))
+	}
+}
+
+// acquire acquires a weight of n of sem in its own goroutine, until it
+// succeeds, is canceled or the connection closes.
+func (c *serverConn) acquire(id, name string, sem *semaphore.Weighted, n int64) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.pending[id] = cancel
+	c.wg.Add(1)
+	c.mu.Unlock()
+
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		err := sem.Acquire(ctx, n)
+
+		c.mu.Lock()
+		delete(c.pending, id)
+		if err == nil {
+			c.held[name] += n
+		}
+		c.mu.Unlock()
+		if err != nil {
+			c.reply(id, "err "+err.Error())
+			return
+		}
+		c.reply(id, "ok")
+	}()
+}
+
+func (c *serverConn) reply(id, msg string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	// A failed write means the client is gone; reclaim follows.
+	io.WriteString(c.conn, fmt.Sprintf("%s %s\n", id, msg))
+}
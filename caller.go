@@ -0,0 +1,125 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "context"
+
+type callerKey struct{}
+
+// IdentityFunc extracts the identity of a caller from its context, for
+// features that treat callers differently: per-caller limits and fair sharing.
+// It returns "" if the caller is unknown.
+type IdentityFunc func(ctx context.Context) string
+
+// CallerIdentity is the default IdentityFunc, returning the caller carried by
+// the context through ContextWithCaller.
+func CallerIdentity(ctx context.Context) string {
+	id, _ := CallerFromContext(ctx)
+	return id
+}
+
+// WithIdentity sets how the semaphore identifies callers that don't pass an
+// explicit ID to AcquireAs. The default is CallerIdentity.
+func WithIdentity(f IdentityFunc) Option {
+	return func(s *Weighted) {
+		s.identity = f
+	}
+}
+
+// Identity returns the identity of the caller of ctx, as seen by the semaphore.
+func (s *Weighted) Identity(ctx context.Context) string {
+	if s.identity != nil {
+		return s.identity(ctx)
+	}
+	return CallerIdentity(ctx)
+}
+
+// WithCallerLimit caps the weight any single caller may hold at once, on top of
+// the semaphore's size, so one aggressive client can't monopolize it. Callers
+// are identified by the ID passed to AcquireAs, or else by the semaphore's
+// IdentityFunc.
+//
+// A caller at its cap waits without blocking the queue for other callers.
+// Callers identified as "", with no ID and none from their context, share one
+// cap as if they were a single caller.
+//
+// Only AcquireAs and TryAcquireAs apply the cap, and what they acquire must be
+// released with ReleaseAs, given the caller ID they returned. Acquire, TryAcquire and Release don't track callers:
+// weight acquired through them counts against the size but against no caller's
+// cap, even if ctx identifies the caller.
+func WithCallerLimit(max int64) Option {
+	if max <= 0 {
+		panic("semaphore: bad caller limit")
+	}
+	return func(s *Weighted) {
+		s.callers = NewComposite(s, max)
+	}
+}
+
+// ContextWithCaller returns a copy of ctx identifying the caller as id.
+func ContextWithCaller(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, callerKey{}, id)
+}
+
+// CallerFromContext returns the caller ID carried by ctx, if any.
+func CallerFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(callerKey{}).(string)
+	return id, ok
+}
+
+// AcquireAs acquires the semaphore with a weight of n on behalf of the caller
+// id, as Acquire does, while respecting the limit set WithCallerLimit. If id is
+// empty, the caller is identified from ctx; see Identity. Returns the caller ID
+// the weight was acquired for, to release it with ReleaseAs. On failure, leaves
+// the semaphore unchanged.
+func (s *Weighted) AcquireAs(ctx context.Context, id string, n int64) (string, error) {
+	id = s.callerID(ctx, id)
+	if s.callers == nil {
+		return id, s.Acquire(ctx, n)
+	}
+	return id, s.callers.Acquire(ctx, id, n)
+}
+
+// TryAcquireAs acquires the semaphore with a weight of n on behalf of the caller
+// id without blocking, as TryAcquire does, while respecting the limit set
+// WithCallerLimit. If id is empty, the caller is identified from ctx, as by
+// AcquireAs. Returns the caller ID the weight was acquired for, to release it
+// with ReleaseAs, and whether it was.
+func (s *Weighted) TryAcquireAs(ctx context.Context, id string, n int64) (string, bool) {
+	id = s.callerID(ctx, id)
+	if s.callers == nil {
+		return id, s.TryAcquire(n)
+	}
+	return id, s.callers.TryAcquire(id, n)
+}
+
+// callerID returns id, or the identity of the caller of ctx if id is empty.
+func (s *Weighted) callerID(ctx context.Context, id string) string {
+	if id == "" {
+		return s.Identity(ctx)
+	}
+	return id
+}
+
+// ReleaseAs releases the semaphore with a weight of n acquired on behalf of the
+// caller id, as returned by AcquireAs or TryAcquireAs.
+func (s *Weighted) ReleaseAs(id string, n int64) {
+	if s.callers == nil {
+		s.Release(n)
+		return
+	}
+	s.callers.Release(id, n)
+}
+
+// CallerInUse returns the weight held on behalf of the caller id.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) CallerInUse(id string) int64 {
+	if s.callers == nil {
+		return 0
+	}
+	k, ok := s.callers.Key(id)
+	if !ok {
+		return 0
+	}
+	return k.Current()
+}
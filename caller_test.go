@@ -0,0 +1,123 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedCallerLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4, WithCallerLimit(2))
+
+	greedy := ContextWithCaller(ctx, "greedy")
+	if id, err := sem.AcquireAs(greedy, "", 2); err != nil || id != "greedy" {
+		t.Fatalf("AcquireAs = (%q, %v), want (greedy, nil)", id, err)
+	}
+
+	// The greedy caller is at its cap: its next request waits...
+	blocked := make(chan struct{})
+	go func() {
+		sem.AcquireAs(greedy, "", 1)
+		close(blocked)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// ...without holding up anyone else.
+	if _, ok := sem.TryAcquireAs(ctx, "polite", 2); !ok {
+		t.Fatal("capped caller blocked another caller")
+	}
+	if n := sem.CallerInUse("greedy"); n != 2 {
+		t.Errorf("got greedy in use %d, want 2", n)
+	}
+
+	sem.ReleaseAs("polite", 2)
+	select {
+	case <-blocked:
+		t.Fatal("caller exceeded its cap")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	sem.ReleaseAs("greedy", 2)
+	<-blocked
+	if cur := sem.Current(); cur != 1 {
+		t.Errorf("got current %d, want 1", cur)
+	}
+}
+
+func TestWeightedCallerWithoutLimit(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	if _, err := sem.AcquireAs(context.Background(), "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	sem.ReleaseAs("a", 2)
+	if id, ok := CallerFromContext(ContextWithCaller(context.Background(), "a")); id != "a" || !ok {
+		t.Errorf("got caller (%q, %t), want (a, true)", id, ok)
+	}
+}
+
+func TestWeightedIdentity(t *testing.T) {
+	t.Parallel()
+
+	type tenantKey struct{}
+	identity := func(ctx context.Context) string {
+		id, _ := ctx.Value(tenantKey{}).(string)
+		return id
+	}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	sem := NewWeighted(4, WithCallerLimit(1), WithIdentity(identity))
+	if id := sem.Identity(ctx); id != "acme" {
+		t.Fatalf("got identity %q, want acme", id)
+	}
+	sem.AcquireAs(ctx, "", 1)
+	if n := sem.CallerInUse("acme"); n != 1 {
+		t.Errorf("got acme in use %d, want 1", n)
+	}
+
+	f := NewFairShare(sem, 0)
+	f.SetIdentity(identity)
+	f.Acquire(ctx, "", 1)
+	if _, inUse := f.Usage("acme"); inUse != 1 {
+		t.Errorf("got acme tenant in use %d, want 1", inUse)
+	}
+}
+
+func TestWeightedCallerResolved(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(4, WithCallerLimit(1))
+	ctx := ContextWithCaller(context.Background(), "a")
+
+	// TryAcquireAs identifies the caller from ctx like AcquireAs.
+	id, ok := sem.TryAcquireAs(ctx, "", 1)
+	if id != "a" || !ok {
+		t.Fatalf("TryAcquireAs = (%q, %t), want (a, true)", id, ok)
+	}
+	if _, ok := sem.TryAcquireAs(ctx, "", 1); ok {
+		t.Error("TryAcquireAs exceeded the cap of the caller of ctx")
+	}
+	sem.ReleaseAs(id, 1)
+	if n := sem.CallerInUse("a"); n != 0 {
+		t.Errorf("got a in use %d after ReleaseAs, want 0", n)
+	}
+
+	// Unidentified callers share the cap of "".
+	tries := []bool{}
+	_, ok = sem.TryAcquireAs(context.Background(), "", 1)
+	tries = append(tries, ok) // true;  "" holds 1/1
+	_, ok = sem.TryAcquireAs(context.Background(), "", 1)
+	tries = append(tries, ok) // false; "" at its cap
+	want := []bool{true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,237 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Hierarchy partitions a fixed capacity between classes arranged in a tree, in
+// the manner of a hierarchical token bucket: each class has a guaranteed weight
+// and a ceiling it can never exceed, and borrows the unused capacity of its
+// siblings through its parent in between.
+//
+// Guarantees take effect under contention: when capacity is freed, waiters of
+// classes below their guarantee are admitted before waiters that would borrow.
+// Holders are never preempted, so a class whose guarantee was lent out gets it
+// back as borrowers release.
+type Hierarchy struct {
+	mu      sync.Mutex
+	root    *Class
+	waiters list.List
+}
+
+// Class is a node of a Hierarchy.
+type Class struct {
+	h          *Hierarchy
+	name       string
+	parent     *Class
+	guaranteed int64
+	ceiling    int64
+	children   int64 // Sum of the children's guarantees.
+	held       int64 // Weight held directly in the class.
+	use        int64 // Weight held in the class and its descendants.
+}
+
+type classWaiter struct {
+	c     *Class
+	n     int64
+	ready chan<- struct{} // Closed when the class acquired.
+}
+
+// NewHierarchy creates a new Hierarchy with the given total capacity, which is
+// both the guarantee and the ceiling of its root class.
+func NewHierarchy(size int64) *Hierarchy {
+	h := &Hierarchy{}
+	h.root = &Class{h: h, name: "root", guaranteed: size, ceiling: size}
+	return h
+}
+
+// Root returns the root class of the hierarchy.
+func (h *Hierarchy) Root() *Class {
+	return h.root
+}
+
+// NewClass adds a child class to c with the given guarantee and ceiling. The
+// guarantees of c's children may not add up to more than c's own guarantee.
+func (c *Class) NewClass(name string, guaranteed, ceiling int64) *Class {
+	if guaranteed < 0 || ceiling < guaranteed || ceiling > c.ceiling {
+		panic("semaphore: bad class limits")
+	}
+
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	if c.children+guaranteed > c.guaranteed {
+		panic("semaphore: class guarantees exceed parent guarantee")
+	}
+	c.children += guaranteed
+
+	return &Class{h: c.h, name: name, parent: c, guaranteed: guaranteed, ceiling: ceiling}
+}
+
+// Name returns the name of the class.
+func (c *Class) Name() string {
+	return c.name
+}
+
+// Acquire acquires a weight of n in the class, blocking until the class and its
+// ancestors have the resources available or ctx is done. On success, returns
+// nil. On failure, returns ctx.Err() and leaves the hierarchy unchanged.
+//
+// Waiters of a class are admitted in FIFO order; waiters of different classes
+// don't block each other.
+func (c *Class) Acquire(ctx context.Context, n int64) error {
+	h := c.h
+	h.mu.Lock()
+	if h.admits(c, n) {
+		c.adjust(n)
+		h.mu.Unlock()
+		c.reportAcquire(nil)
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := h.waiters.PushBack(classWaiter{c: c, n: n, ready: ready})
+	h.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		h.mu.Lock()
+		select {
+		case <-ready:
+			err = nil
+		default:
+			h.waiters.Remove(elem)
+			// Waiters of the class queued behind us may fit now.
+			h.notifyWaiters()
+		}
+		h.mu.Unlock()
+		c.reportAcquire(err)
+		return err
+
+	case <-ready:
+		c.reportAcquire(nil)
+		return nil
+	}
+}
+
+// TryAcquire acquires a weight of n in the class without blocking. On success,
+// returns true. On failure, returns false and leaves the hierarchy unchanged.
+func (c *Class) TryAcquire(n int64) bool {
+	h := c.h
+	h.mu.Lock()
+	success := h.admits(c, n)
+	if success {
+		c.adjust(n)
+	}
+	h.mu.Unlock()
+	if success {
+		c.reportAcquire(nil)
+	}
+	return success
+}
+
+// reportAcquire counts the outcome of an acquisition in c.
+func (c *Class) reportAcquire(err error) {
+	name := "semaphore.class.acquires"
+	if err != nil {
+		name = "semaphore.class.cancellations"
+	}
+	report(currentInstrumentation(), name, 1, slog.String("class", c.name))
+}
+
+// Release releases a weight of n in the class.
+func (c *Class) Release(n int64) {
+	h := c.h
+	h.mu.Lock()
+	if c.held < n {
+		h.mu.Unlock()
+		panic("semaphore: bad release")
+	}
+	c.adjust(-n)
+	h.notifyWaiters()
+	h.mu.Unlock()
+}
+
+// InUse returns the weight held in the class and its descendants.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (c *Class) InUse() int64 {
+	c.h.mu.Lock()
+	use := c.use
+	c.h.mu.Unlock()
+	return use
+}
+
+// fits reports whether a weight of n can be acquired in c without exceeding
+// the ceiling of c or any of its ancestors. Must be called with c.h.mu held.
+func (c *Class) fits(n int64) bool {
+	for ; c != nil; c = c.parent {
+		if c.use+n > c.ceiling {
+			return false
+		}
+	}
+	return true
+}
+
+// borrows reports whether acquiring a weight of n in c takes it beyond its
+// guarantee. Must be called with c.h.mu held.
+func (c *Class) borrows(n int64) bool {
+	return c.use+n > c.guaranteed
+}
+
+// adjust adds n, which may be negative, to the weight held in c. Must be called
+// with c.h.mu held.
+func (c *Class) adjust(n int64) {
+	c.held += n
+	for ; c != nil; c = c.parent {
+		c.use += n
+	}
+}
+
+// admits reports whether a new acquisition of a weight of n in c may proceed
+// without queueing: it must fit, must not overtake waiters of its own class,
+// and may only borrow while nobody is waiting. Must be called with h.mu held.
+func (h *Hierarchy) admits(c *Class, n int64) bool {
+	if c.borrows(n) && h.waiters.Len() > 0 {
+		return false
+	}
+	return !h.queued(c) && c.fits(n)
+}
+
+// queued reports whether c has queued waiters. Must be called with h.mu held.
+func (h *Hierarchy) queued(c *Class) bool {
+	for elem := h.waiters.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(classWaiter).c == c {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyWaiters admits queued waiters that fit, first those within their
+// class's guarantee and then those that need to borrow. A class whose first
+// waiter doesn't fit keeps its later waiters blocked. Must be called with h.mu
+// held.
+func (h *Hierarchy) notifyWaiters() {
+	for _, borrowing := range []bool{false, true} {
+		blocked := make(map[*Class]bool)
+		for elem := h.waiters.Front(); elem != nil; {
+			w := elem.Value.(classWaiter)
+			next := elem.Next()
+			switch {
+			case blocked[w.c]:
+			case !borrowing && w.c.borrows(w.n), !w.c.fits(w.n):
+				blocked[w.c] = true
+			default:
+				w.c.adjust(w.n)
+				h.waiters.Remove(elem)
+				close(w.ready)
+			}
+			elem = next
+		}
+	}
+}
@@ -0,0 +1,77 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHierarchyCeilingAndBorrowing(t *testing.T) {
+	t.Parallel()
+
+	h := NewHierarchy(10)
+	a := h.Root().NewClass("a", 4, 10)
+	b := h.Root().NewClass("b", 4, 6)
+
+	tries := []bool{}
+	tries = append(tries, b.TryAcquire(6)) // true;  b borrows 2 of a's idle guarantee
+	tries = append(tries, b.TryAcquire(1)) // false; b is at its ceiling
+	tries = append(tries, a.TryAcquire(4)) // true;  root = 10/10
+	tries = append(tries, a.TryAcquire(1)) // false; root is full
+
+	want := []bool{true, false, true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+	if use := h.Root().InUse(); use != 10 {
+		t.Errorf("got root in use %d, want 10", use)
+	}
+}
+
+func TestHierarchyGuaranteeFirst(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	h := NewHierarchy(4)
+	a := h.Root().NewClass("a", 2, 4)
+	b := h.Root().NewClass("b", 2, 4)
+
+	a.Acquire(ctx, 4) // a borrows all of b's guarantee.
+
+	order := make(chan string, 2)
+	go func() {
+		a.Acquire(ctx, 1)
+		order <- "a"
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		b.Acquire(ctx, 1)
+		order <- "b"
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// b is below its guarantee, so it gets the freed weight before a, which
+	// queued first but would borrow.
+	a.Release(1)
+	if got := <-order; got != "b" {
+		t.Fatalf("got %q admitted first, want b", got)
+	}
+	a.Release(1)
+	<-order
+}
+
+func TestHierarchyBadGuarantee(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("oversubscribed guarantees did not panic")
+		}
+	}()
+	h := NewHierarchy(4)
+	h.Root().NewClass("a", 3, 4)
+	h.Root().NewClass("b", 2, 4)
+}
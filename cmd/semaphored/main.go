@@ -0,0 +1,56 @@
+// Command semaphored runs a broker sharing weighted semaphores between the
+// processes of a host over a Unix domain socket; see package broker.
+//
+// Usage:
+//
+//	semaphored [-socket path] [-size n]
+//
+// Every semaphore starts with the size of -size until a client resizes it.
+// The broker removes its socket when it gets SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/sherifabdlnaby/semaphore/broker"
+)
+
+func main() {
+	socket := flag.String("socket", filepath.Join(os.TempDir(), "semaphored.sock"), "path of the Unix socket to listen on")
+	size := flag.Int64("size", 1, "initial size of every semaphore")
+	flag.Parse()
+	if *size < 0 {
+		log.Fatal("semaphored: -size must not be negative")
+	}
+
+	// A socket left by a broker that didn't exit cleanly would fail Listen.
+	if conn, err := net.Dial("unix", *socket); err == nil {
+		conn.Close()
+		log.Fatalf("semaphored: a broker is already listening on %s", *socket)
+	}
+	os.Remove(*socket)
+
+	l, err := net.Listen("unix", *socket)
+	if err != nil {
+		log.Fatalf("semaphored: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		l.Close() // Removes the socket.
+	}()
+
+	if err := broker.NewServer(*size).Serve(l); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Fatalf("semaphored: %v", err)
+	}
+}
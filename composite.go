@@ -0,0 +1,141 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Composite limits acquisitions both globally and per key: every acquisition
+// consumes weight from a shared global semaphore and from a semaphore of its
+// own key, and releases both together.
+//
+// The key's semaphore is always acquired before the global one and rolled back
+// if the global acquisition fails, so callers never hold one without the other
+// and never deadlock on ordering.
+type Composite struct {
+	global  AcquireReleaser
+	keySize int64
+	mu      sync.Mutex
+	keys    map[string]*compositeKey
+}
+
+type compositeKey struct {
+	sem  *Weighted
+	refs int // Holders and waiters of the key.
+}
+
+// NewComposite creates a new Composite limiting every key to keySize and all
+// keys together to global.
+func NewComposite(global AcquireReleaser, keySize int64) *Composite {
+	return &Composite{global: global, keySize: keySize, keys: make(map[string]*compositeKey)}
+}
+
+// Acquire acquires a weight of n for key, blocking until both the key and the
+// global semaphore have the resources available or ctx is done. On success,
+// returns nil. On failure, returns ctx.Err() and leaves both semaphores
+// unchanged.
+func (c *Composite) Acquire(ctx context.Context, key string, n int64) error {
+	k := c.ref(key)
+	if err := k.sem.Acquire(ctx, n); err != nil {
+		c.unref(key, k)
+		return err
+	}
+	if err := c.global.Acquire(ctx, n); err != nil {
+		k.sem.Release(n)
+		c.unref(key, k)
+		return err
+	}
+	return nil
+}
+
+// TryAcquire acquires a weight of n for key without blocking. On success,
+// returns true. On failure, returns false and leaves both semaphores unchanged.
+func (c *Composite) TryAcquire(key string, n int64) bool {
+	k := c.ref(key)
+	if !k.sem.TryAcquire(n) {
+		c.unref(key, k)
+		return false
+	}
+	if !c.global.TryAcquire(n) {
+		k.sem.Release(n)
+		c.unref(key, k)
+		return false
+	}
+	return true
+}
+
+// Release releases a weight of n for key from both semaphores.
+func (c *Composite) Release(key string, n int64) {
+	c.mu.Lock()
+	k, ok := c.keys[key]
+	c.mu.Unlock()
+	if !ok {
+		panic("semaphore: bad release")
+	}
+	c.global.Release(n)
+	k.sem.Release(n)
+	c.unref(key, k)
+}
+
+// Key returns the semaphore of key, if it has holders or waiters.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (c *Composite) Key(key string) (*Weighted, bool) {
+	c.mu.Lock()
+	k, ok := c.keys[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return k.sem, true
+}
+
+func (c *Composite) ref(key string) *compositeKey {
+	c.mu.Lock()
+	k, ok := c.keys[key]
+	if !ok {
+		k = &compositeKey{sem: NewWeighted(c.keySize)}
+		c.keys[key] = k
+	}
+	k.refs++
+	c.mu.Unlock()
+	return k
+}
+
+// unref drops a reference to k, forgetting the key once nobody uses it.
+func (c *Composite) unref(key string, k *compositeKey) {
+	c.mu.Lock()
+	k.refs--
+	if k.refs == 0 {
+		delete(c.keys, key)
+	}
+	c.mu.Unlock()
+}
+
+type keyUsage struct {
+	key   string
+	inUse int64
+}
+
+// top returns up to n keys with the highest weight in use, highest first.
+func (c *Composite) top(n int) []keyUsage {
+	c.mu.Lock()
+	usage := make([]keyUsage, 0, len(c.keys))
+	sems := make([]*Weighted, 0, len(c.keys))
+	for key, k := range c.keys {
+		usage = append(usage, keyUsage{key: key})
+		sems = append(sems, k.sem)
+	}
+	c.mu.Unlock()
+
+	for i, sem := range sems {
+		usage[i].inUse = sem.Current()
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].inUse > usage[j].inUse })
+	if len(usage) > n {
+		usage = usage[:n]
+	}
+	return usage
+}
@@ -0,0 +1,49 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestComposite(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	global := NewWeighted(3)
+	c := NewComposite(global, 2)
+
+	tries := []bool{}
+	tries = append(tries, c.TryAcquire("a", 2)) // true;  a = 2/2, global = 2/3
+	tries = append(tries, c.TryAcquire("a", 1)) // false; a is full
+	tries = append(tries, c.TryAcquire("b", 2)) // false; global would be 4/3
+	tries = append(tries, c.TryAcquire("b", 1)) // true;  b = 1/2, global = 3/3
+
+	want := []bool{true, false, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	// A failed global acquisition must not leave weight on the key.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := c.Acquire(tctx, "b", 1); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if b, _ := c.Key("b"); b.Current() != 1 {
+		t.Errorf("got key current %d, want 1", b.Current())
+	}
+
+	c.Release("a", 2)
+	c.Release("b", 1)
+	if _, ok := c.Key("a"); ok {
+		t.Error("idle key was not forgotten")
+	}
+	if global.Current() != 0 {
+		t.Errorf("got global current %d, want 0", global.Current())
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// WithWorkConserving lets waiters that fit be admitted ahead of a waiter that
+// doesn't, instead of leaving the capacity idle until it does. To keep the
+// blocked waiter from starving, at most maxSkips waiters are admitted ahead of
+// it; after that, admission is FIFO again until it is admitted.
+//
+// It trades the strict ordering of the default policy for throughput under
+// mixed weights. It has no effect together with WithScheduler.
+func WithWorkConserving(maxSkips int) Option {
+	if maxSkips <= 0 {
+		panic("semaphore: bad work-conserving skips")
+	}
+	return func(s *Weighted) {
+		s.maxSkips = maxSkips
+	}
+}
+
+// admitAround admits the queued waiters after blocked that fit, until blocked
+// has been skipped maxSkips times. Must be called with s.mu held.
+func (s *Weighted) admitAround(blocked *waiter) {
+	for w := s.waiters.Front(); w != nil && blocked.skipped < s.maxSkips; {
+		next := w.Next()
+		if w != blocked && s.size-s.cur >= w.n {
+			s.admit(w)
+			blocked.skipped++
+		}
+		w = next
+	}
+}
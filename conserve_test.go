@@ -0,0 +1,54 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedWorkConserving(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(3, WithWorkConserving(2))
+	sem.Acquire(ctx, 2)
+	large := make(chan struct{})
+	go func() {
+		sem.Acquire(ctx, 3)
+		close(large)
+	}()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Two small waiters skip the blocked large one.
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if err := sem.Acquire(tctx, 1); err != nil {
+			t.Fatalf("small waiter %d not admitted around the blocked one: %v", i, err)
+		}
+		sem.Release(1)
+	}
+
+	// The large waiter was skipped enough: the next small one waits behind it.
+	small := make(chan struct{})
+	go func() {
+		sem.Acquire(ctx, 1)
+		close(small)
+	}()
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release(2)
+	<-large
+	select {
+	case <-small:
+		t.Fatal("small waiter admitted while the large one holds everything")
+	default:
+	}
+	sem.Release(3)
+	<-small
+}
@@ -0,0 +1,75 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// Consume receives items from src until it is closed and calls handler for
+// each concurrently, holding a weight of weight(item) of sem for the duration
+// of the call, or of 1 if weight is nil. Items are received one at a time, once
+// the weight of the previous one is acquired, so a full sem leaves items in
+// src instead of buffering them.
+//
+// Consume stops receiving when ctx is done or a handler first fails, then
+// waits for the calls in progress to return before returning the handler's
+// error, or ctx.Err(), or nil once src is closed and drained. An item received
+// from src is always handled, even if Consume stops while it waits for its
+// weight. Handlers are passed a context that is canceled when ctx is or when a
+// handler fails.
+func Consume[T any](ctx context.Context, sem AcquireReleaser, src <-chan T, weight func(T) int64, handler func(context.Context, T) error) error {
+	parent := ctx
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			first = err
+			cancel(err)
+		})
+	}
+
+	// Received items wait for their weight regardless of ctx, as the calls in
+	// progress eventually release theirs.
+	receivedCtx := context.WithoutCancel(ctx)
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case item, ok := <-src:
+			if !ok {
+				break loop
+			}
+			n := int64(1)
+			if weight != nil {
+				n = weight(item)
+			}
+			if err := sem.Acquire(receivedCtx, n); err != nil {
+				fail(err)
+				break loop
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer sem.Release(n)
+				if err := handler(ctx, item); err != nil {
+					fail(err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if first != nil {
+		return first
+	}
+	return parent.Err()
+}
@@ -0,0 +1,96 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsume(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(3)
+	src := make(chan int)
+	go func() {
+		for i := 1; i <= 20; i++ {
+			src <- i
+		}
+		close(src)
+	}()
+
+	var sum, peak atomic.Int64
+	err := Consume(context.Background(), sem, src, func(i int) int64 { return int64(i%3 + 1) }, func(ctx context.Context, i int) error {
+		if cur := sem.Current(); cur > peak.Load() {
+			peak.Store(cur)
+		}
+		sum.Add(int64(i))
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if got := sum.Load(); got != 210 {
+		t.Errorf("got sum %d, want 210", got)
+	}
+	if got := peak.Load(); got > 3 {
+		t.Errorf("got peak weight %d, want at most 3", got)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
+
+func TestConsumeStops(t *testing.T) {
+	t.Parallel()
+
+	tries := []struct {
+		name   string
+		cancel bool
+		fail   error
+	}{
+		{"Canceled", true, nil},
+		{"HandlerFailed", false, errors.New("handler failed")},
+	}
+	for i, try := range tries {
+		ctx, cancel := context.WithCancel(context.Background())
+		sem := NewWeighted(1)
+		src := make(chan int, 10)
+		for j := 0; j < cap(src); j++ {
+			src <- j
+		}
+
+		var handled atomic.Int64
+		err := Consume(ctx, sem, src, nil, func(ctx context.Context, j int) error {
+			handled.Add(1)
+			if j == 2 {
+				if try.cancel {
+					cancel()
+				}
+				return try.fail
+			}
+			return nil
+		})
+		cancel()
+
+		want := try.fail
+		if try.cancel {
+			want = context.Canceled
+		}
+		if err != want {
+			t.Errorf("tries[%d] %s: got %v, want %v", i, try.name, err, want)
+		}
+		// The item received while the failing one held the weight is still
+		// handled; the rest stay in src.
+		if got := handled.Load() + int64(len(src)); got != int64(cap(src)) {
+			t.Errorf("tries[%d] %s: %d items lost", i, try.name, int64(cap(src))-got)
+		}
+		if cur := sem.Current(); cur != 0 {
+			t.Errorf("tries[%d] %s: got current %d, want 0", i, try.name, cur)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "context"
+
+type bypassKey struct{}
+
+// tokenKey keys the token of a semaphore, so tokens of different semaphores
+// don't shadow each other.
+type tokenKey struct {
+	sem *Weighted
+}
+
+// WithBypass returns a copy of ctx marking acquisitions made with it to skip
+// admission: Acquire succeeds immediately, even if the semaphore is full or
+// paused, and the weight is still counted as in use and must be released.
+// AcquireUpTo is granted its max, but no more than the semaphore's size. It is
+// meant for health checks and emergency administrative operations.
+//
+// Semaphores created WithoutBypass ignore the mark.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+func isBypass(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// ContextWithToken returns a copy of ctx carrying t, so code further down the
+// call stack can tell that the request was already admitted by t's semaphore
+// and avoid acquiring from it twice.
+func ContextWithToken(ctx context.Context, t *Token) context.Context {
+	return context.WithValue(ctx, tokenKey{t.sem}, t)
+}
+
+// TokenFromContext returns the token of s carried by ctx, if any.
+func TokenFromContext(ctx context.Context, s *Weighted) (*Token, bool) {
+	t, ok := ctx.Value(tokenKey{s}).(*Token)
+	return t, ok
+}
+
+type semaphoreKey struct{}
+
+// ContextWithSemaphore returns a copy of ctx carrying s, so libraries further
+// down the call stack can acquire from the caller's semaphore, and so honor
+// its concurrency budget, without taking it as a parameter.
+func ContextWithSemaphore(ctx context.Context, s *Weighted) context.Context {
+	return context.WithValue(ctx, semaphoreKey{}, s)
+}
+
+// SemaphoreFromContext returns the semaphore carried by ctx, if any.
+func SemaphoreFromContext(ctx context.Context) (*Weighted, bool) {
+	s, ok := ctx.Value(semaphoreKey{}).(*Weighted)
+	return s, ok
+}
@@ -0,0 +1,99 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedBypass(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	sem.Acquire(ctx, 1)
+	sem.Pause()
+
+	if err := sem.Acquire(WithBypass(ctx), 1); err != nil {
+		t.Fatalf("bypassed Acquire failed: %v", err)
+	}
+	if cur, n := sem.Current(), sem.Bypassed(); cur != 2 || n != 1 {
+		t.Errorf("got current %d and %d bypassed, want 2 and 1", cur, n)
+	}
+	sem.Release(1)
+	sem.Release(1)
+
+	if got, err := sem.AcquireUpTo(WithBypass(ctx), 1<<40); err != nil || got != 1 {
+		t.Errorf("bypassed AcquireUpTo got %d, %v, want 1, nil", got, err)
+	}
+}
+
+func TestWeightedWithoutBypass(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1, WithoutBypass())
+	sem.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(WithBypass(context.Background()), 10*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(ctx, 1); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := sem.Bypassed(); n != 0 {
+		t.Errorf("got %d bypassed, want 0", n)
+	}
+}
+
+func TestTokenFromContext(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	a, b := NewWeighted(2), NewWeighted(2)
+
+	admit := func(ctx context.Context, s *Weighted) context.Context {
+		if _, ok := TokenFromContext(ctx, s); ok {
+			return ctx
+		}
+		s.Acquire(ctx, 1)
+		return ContextWithToken(ctx, NewToken(s, 1))
+	}
+
+	ctx = admit(ctx, a)
+	ctx = admit(ctx, a) // Already admitted by a.
+	ctx = admit(ctx, b)
+
+	if cur := a.Current(); cur != 1 {
+		t.Errorf("request charged %d on a, want 1", cur)
+	}
+	tok, ok := TokenFromContext(ctx, b)
+	if !ok || tok.Semaphore() != b || tok.Weight() != 1 {
+		t.Errorf("got token %+v, %t for b", tok, ok)
+	}
+	if _, ok := TokenFromContext(context.Background(), a); ok {
+		t.Error("found a token in a bare context")
+	}
+}
+
+func TestSemaphoreFromContext(t *testing.T) {
+	t.Parallel()
+
+	s := NewWeighted(1)
+	ctx := ContextWithSemaphore(context.Background(), s)
+
+	// A library deep in the call stack acquires from the caller's budget.
+	work := func(ctx context.Context) bool {
+		sem, ok := SemaphoreFromContext(ctx)
+		return ok && sem.TryAcquire(1)
+	}
+	if !work(ctx) {
+		t.Fatal("first call wasn't admitted")
+	}
+	if work(ctx) {
+		t.Error("second call was admitted beyond the budget")
+	}
+	if _, ok := SemaphoreFromContext(context.Background()); ok {
+		t.Error("found a semaphore in a bare context")
+	}
+}
@@ -0,0 +1,91 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// CostEstimator learns the cost of categories of work from how long they hold
+// a Weighted, and acquires proportionate weights for them. It lets callers
+// that can't predict the cost of a request still get proportionate admission
+// instead of a uniform weight of 1.
+//
+// The cost of a label is an exponentially weighted moving average of its
+// observed hold times, expressed in multiples of a unit duration.
+type CostEstimator struct {
+	sem   AcquireReleaseResizer
+	alpha float64
+	unit  time.Duration
+	mu    sync.Mutex
+	costs map[string]float64
+}
+
+// NewCostEstimator creates a new CostEstimator acquiring from sem. A hold time
+// of unit costs a weight of 1. alpha in (0, 1] is the weight given to each new
+// observation.
+func NewCostEstimator(sem AcquireReleaseResizer, alpha float64, unit time.Duration) *CostEstimator {
+	if alpha <= 0 || alpha > 1 {
+		panic("semaphore: bad estimator alpha")
+	}
+	if unit <= 0 {
+		panic("semaphore: bad estimator unit")
+	}
+	return &CostEstimator{sem: sem, alpha: alpha, unit: unit, costs: make(map[string]float64)}
+}
+
+// Weight returns the estimated weight of label, rounded up and bounded by 1 and
+// the current size of the semaphore. Labels never observed weigh 1.
+func (e *CostEstimator) Weight(label string) int64 {
+	e.mu.Lock()
+	cost, ok := e.costs[label]
+	e.mu.Unlock()
+	if !ok {
+		return 1
+	}
+
+	n := int64(math.Ceil(cost))
+	if size := e.sem.Size(); n > size {
+		n = size
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Observe records that work of label held the semaphore for held.
+func (e *CostEstimator) Observe(label string, held time.Duration) {
+	cost := float64(held) / float64(e.unit)
+	e.mu.Lock()
+	if prev, ok := e.costs[label]; ok {
+		cost = e.alpha*cost + (1-e.alpha)*prev
+	}
+	e.costs[label] = cost
+	e.mu.Unlock()
+
+	if inst := instrumentationOf(e.sem); inst != nil {
+		inst.Observe("semaphore.cost.hold", held.Seconds(), slog.String("label", label))
+	}
+}
+
+// Acquire acquires the estimated weight of label, blocking until resources are
+// available or ctx is done. On success, returns a function that releases the
+// weight and records the hold time; it must be called exactly once. On failure,
+// returns ctx.Err() and leaves the semaphore unchanged.
+func (e *CostEstimator) Acquire(ctx context.Context, label string) (release func(), err error) {
+	n := e.Weight(label)
+	if err := e.sem.Acquire(ctx, n); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	return func() {
+		e.Observe(label, time.Since(start))
+		e.sem.Release(n)
+	}, nil
+}
@@ -0,0 +1,46 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCostEstimator(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(10)
+	e := NewCostEstimator(sem, 0.5, time.Millisecond)
+
+	if n := e.Weight("new"); n != 1 {
+		t.Errorf("unobserved label weighs %d, want 1", n)
+	}
+
+	e.Observe("slow", 4*time.Millisecond)
+	e.Observe("slow", 8*time.Millisecond) // 0.5*8 + 0.5*4 = 6
+	if n := e.Weight("slow"); n != 6 {
+		t.Errorf("got weight %d, want 6", n)
+	}
+
+	e.Observe("huge", time.Second)
+	if n := e.Weight("huge"); n != 10 {
+		t.Errorf("got weight %d, want it bounded by the size 10", n)
+	}
+
+	release, err := e.Acquire(context.Background(), "slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur := sem.Current(); cur != 6 {
+		t.Errorf("got current %d, want 6", cur)
+	}
+	release()
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+	if n := e.Weight("slow"); n >= 6 {
+		t.Errorf("short hold did not lower the estimate, got weight %d", n)
+	}
+}
@@ -0,0 +1,147 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Counting is a semaphore specialized for concurrency caps, where every
+// acquisition has a weight of 1. Free tokens are spread over shards, one per
+// CPU, that are taken and refilled with atomic operations, so that as long as
+// tokens are free, acquiring and releasing never take a lock.
+//
+// Counting trades fairness for throughput: a new acquisition may take a token
+// ahead of blocked waiters, which are otherwise woken in FIFO order.
+type Counting struct {
+	size    int64
+	shards  []countingShard
+	waiting atomic.Int64 // Acquire calls registered as blocked.
+	mu      sync.Mutex
+	waiters list.List // Of chan struct{}, closed when handed a token.
+}
+
+type countingShard struct {
+	tokens atomic.Int64
+	_      [56]byte // Keeps shards on separate cache lines.
+}
+
+// NewCounting creates a new Counting semaphore with the given number of
+// tokens.
+func NewCounting(n int64) *Counting {
+	if n < 0 {
+		panic("semaphore: bad counting size")
+	}
+	c := &Counting{size: n, shards: make([]countingShard, runtime.GOMAXPROCS(0))}
+	for i := range c.shards {
+		c.shards[i].tokens.Store(n / int64(len(c.shards)))
+	}
+	c.shards[0].tokens.Add(n % int64(len(c.shards)))
+	return c
+}
+
+// Acquire acquires a token, blocking until one is available or ctx is done.
+// On success, returns nil. On failure, returns ctx.Err() and leaves the
+// semaphore unchanged.
+//
+// If ctx is already done, Acquire may still succeed without blocking.
+func (c *Counting) Acquire(ctx context.Context) error {
+	if c.TryAcquire() {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.waiting.Add(1)
+	// A token released before we registered went to a shard, not to us.
+	if c.TryAcquire() {
+		c.waiting.Add(-1)
+		c.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := c.waiters.PushBack(ready)
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		c.mu.Lock()
+		select {
+		case <-ready:
+			// Handed a token after we were canceled.
+			err = nil
+		default:
+			c.waiters.Remove(elem)
+			c.waiting.Add(-1)
+		}
+		c.mu.Unlock()
+		return err
+
+	case <-ready:
+		return nil
+	}
+}
+
+// TryAcquire acquires a token without blocking. On success, returns true. On
+// failure, returns false and leaves the semaphore unchanged.
+func (c *Counting) TryAcquire() bool {
+	start := rand.IntN(len(c.shards))
+	for i := range c.shards {
+		shard := &c.shards[(start+i)%len(c.shards)]
+		for {
+			tokens := shard.tokens.Load()
+			if tokens == 0 {
+				break
+			}
+			if shard.tokens.CompareAndSwap(tokens, tokens-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Release releases a token.
+//
+// Unlike Weighted, Counting can't tell when more tokens are released than were
+// acquired; releasing a token that wasn't acquired grows the semaphore.
+func (c *Counting) Release() {
+	c.shards[rand.IntN(len(c.shards))].tokens.Add(1)
+	if c.waiting.Load() == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	for elem := c.waiters.Front(); elem != nil && c.TryAcquire(); elem = c.waiters.Front() {
+		c.waiters.Remove(elem)
+		c.waiting.Add(-1)
+		close(elem.Value.(chan struct{}))
+	}
+	c.mu.Unlock()
+}
+
+// Size returns the number of tokens of the semaphore.
+func (c *Counting) Size() int64 {
+	return c.size
+}
+
+// Current returns the number of tokens currently held.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (c *Counting) Current() int64 {
+	free := int64(0)
+	for i := range c.shards {
+		free += c.shards[i].tokens.Load()
+	}
+	return c.size - free
+}
+
+// Waiters returns the number of currently waiting Acquire calls.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (c *Counting) Waiters() int {
+	return int(c.waiting.Load())
+}
@@ -0,0 +1,115 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounting(t *testing.T) {
+	t.Parallel()
+
+	sem := NewCounting(2)
+
+	tries := []bool{}
+	tries = append(tries, sem.TryAcquire()) // true;  1/2
+	tries = append(tries, sem.TryAcquire()) // true;  2/2
+	tries = append(tries, sem.TryAcquire()) // false; full
+	sem.Release()
+	tries = append(tries, sem.TryAcquire()) // true;  2/2
+
+	want := []bool{true, true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+	if cur := sem.Current(); cur != 2 {
+		t.Errorf("got current %d, want 2", cur)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if w := sem.Waiters(); w != 0 {
+		t.Errorf("got %d waiters, want 0", w)
+	}
+
+	done := make(chan error)
+	go func() { done <- sem.Acquire(context.Background()) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release()
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
+
+func TestCountingConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const size = 3
+	sem := NewCounting(size)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		held    int
+		maxHeld int
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sem.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			held++
+			maxHeld = max(maxHeld, held)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			held--
+			mu.Unlock()
+			sem.Release()
+		}()
+	}
+	wg.Wait()
+
+	if maxHeld > size {
+		t.Errorf("got %d tokens held at once, want at most %d", maxHeld, size)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
+
+func BenchmarkCountingParallel(b *testing.B) {
+	ctx := context.Background()
+	b.Run("Counting", func(b *testing.B) {
+		sem := NewCounting(1 << 20)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				sem.Acquire(ctx)
+				sem.Release()
+			}
+		})
+	})
+	b.Run("Weighted", func(b *testing.B) {
+		sem := NewWeighted(1 << 20)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				sem.Acquire(ctx, 1)
+				sem.Release(1)
+			}
+		})
+	})
+}
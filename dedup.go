@@ -0,0 +1,113 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Dedup runs functions under a Weighted while collapsing concurrent calls that
+// share a key: callers asking for the same key share one admission and one
+// execution, and distinct keys are bounded by the semaphore's total weight.
+type Dedup struct {
+	sem   AcquireReleaser
+	mu    sync.Mutex
+	calls map[string]*dedupCall
+}
+
+type dedupCall struct {
+	done    chan struct{} // Closed when val and err are set.
+	val     interface{}
+	err     error
+	callers int
+	cancel  context.CancelFunc
+}
+
+// NewDedup creates a new Dedup admitting executions on sem.
+func NewDedup(sem AcquireReleaser) *Dedup {
+	return &Dedup{sem: sem, calls: make(map[string]*dedupCall)}
+}
+
+// Do runs fn with a weight of n unless a call for key is already in flight, in
+// which case it waits for that call and returns its result. shared reports
+// whether the result was delivered to more than one caller.
+//
+// If ctx is done before the result is ready, Do returns ctx.Err() without
+// affecting other callers of the same key. The context passed to fn is
+// canceled once every caller waiting for it has given up.
+func (d *Dedup) Do(ctx context.Context, key string, n int64, fn func(context.Context) (interface{}, error)) (v interface{}, shared bool, err error) {
+	d.mu.Lock()
+	c, ok := d.calls[key]
+	if ok {
+		c.callers++
+	} else {
+		cctx, cancel := context.WithCancel(context.Background())
+		c = &dedupCall{done: make(chan struct{}), callers: 1, cancel: cancel}
+		d.calls[key] = c
+		go d.run(cctx, key, c, n, fn)
+	}
+	d.mu.Unlock()
+	defer func() {
+		report(instrumentationOf(d.sem), "semaphore.dedup.calls", 1, slog.Bool("shared", shared))
+	}()
+
+	select {
+	case <-ctx.Done():
+		d.mu.Lock()
+		select {
+		case <-c.done:
+			// Finished after we were canceled; the result is as good as any.
+			shared = c.callers > 1
+			d.mu.Unlock()
+			return c.val, shared, c.err
+		default:
+		}
+		c.callers--
+		if c.callers == 0 {
+			// Nobody is waiting any more: abandon the call and let the next
+			// caller for key start afresh.
+			if d.calls[key] == c {
+				delete(d.calls, key)
+			}
+			c.cancel()
+		}
+		d.mu.Unlock()
+		return nil, false, ctx.Err()
+
+	case <-c.done:
+		d.mu.Lock()
+		shared = c.callers > 1
+		d.mu.Unlock()
+		return c.val, shared, c.err
+	}
+}
+
+// InFlight returns the number of keys with a call in flight.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (d *Dedup) InFlight() int {
+	d.mu.Lock()
+	inFlight := len(d.calls)
+	d.mu.Unlock()
+	return inFlight
+}
+
+func (d *Dedup) run(ctx context.Context, key string, c *dedupCall, n int64, fn func(context.Context) (interface{}, error)) {
+	defer c.cancel()
+
+	c.err = d.sem.Acquire(ctx, n)
+	if c.err == nil {
+		func() {
+			defer d.sem.Release(n)
+			c.val, c.err = fn(ctx)
+		}()
+	}
+
+	d.mu.Lock()
+	if d.calls[key] == c {
+		delete(d.calls, key)
+	}
+	close(c.done)
+	d.mu.Unlock()
+}
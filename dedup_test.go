@@ -0,0 +1,108 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupSharesExecution(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	d := NewDedup(NewWeighted(1))
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, shared, err := d.Do(ctx, "key", 1, fn)
+			if v != "v" || !shared || err != nil {
+				t.Errorf("got (%v, %t, %v), want (v, true, <nil>)", v, shared, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("fn ran %d times, want 1", calls)
+	}
+}
+
+func TestDedupBoundsDistinctKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	d := NewDedup(sem)
+
+	var running, peak int32
+	fn := func(context.Context) (interface{}, error) {
+		cur := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if cur <= old || atomic.CompareAndSwapInt32(&peak, old, cur) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			d.Do(ctx, key, 1, fn)
+		}(key)
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("peak concurrency %d exceeds semaphore size 2", peak)
+	}
+}
+
+func TestDedupCancel(t *testing.T) {
+	t.Parallel()
+
+	d := NewDedup(NewWeighted(1))
+	canceled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := d.Do(ctx, "key", 1, fn); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("abandoned execution was not canceled")
+	}
+	if n := d.InFlight(); n != 0 {
+		t.Errorf("got %d calls in flight, want 0", n)
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "sync"
+
+// dispatcher runs callbacks one at a time, in the order they were posted, on a
+// goroutine of its own. It lets the semaphore notify users without calling
+// their code while holding its lock.
+type dispatcher struct {
+	mu      sync.Mutex
+	queue   []func()
+	running bool
+}
+
+// post schedules fn to run after every previously posted callback.
+func (d *dispatcher) post(fn func()) {
+	d.mu.Lock()
+	d.queue = append(d.queue, fn)
+	if !d.running {
+		d.running = true
+		go d.run()
+	}
+	d.mu.Unlock()
+}
+
+func (d *dispatcher) run() {
+	for {
+		d.mu.Lock()
+		if len(d.queue) == 0 {
+			d.running = false
+			d.mu.Unlock()
+			return
+		}
+		fn := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.mu.Unlock()
+
+		fn()
+	}
+}
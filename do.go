@@ -0,0 +1,31 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "context"
+
+// Do acquires the semaphore with a weight of n, runs fn and releases the
+// weight, even if fn panics. Returns the error of Acquire without running fn
+// if the weight couldn't be acquired, and the error of fn otherwise.
+func (s *Weighted) Do(ctx context.Context, n int64, fn func() error) error {
+	if err := s.Acquire(ctx, n); err != nil {
+		return err
+	}
+	defer s.Release(n)
+	return fn()
+}
+
+// Go acquires the semaphore with a weight of n, blocking until it is available
+// or ctx is done, then calls fn in a new goroutine and releases the weight when
+// fn returns, or panics, before the panic continues. Returns the error of
+// Acquire without starting fn if the weight couldn't be acquired.
+func (s *Weighted) Go(ctx context.Context, n int64, fn func()) error {
+	if err := s.Acquire(ctx, n); err != nil {
+		return err
+	}
+	go func() {
+		defer s.Release(n)
+		fn()
+	}()
+	return nil
+}
@@ -0,0 +1,85 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWeightedDo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	errFn := errors.New("fn failed")
+
+	err := sem.Do(ctx, 2, func() error {
+		if cur := sem.Current(); cur != 2 {
+			t.Errorf("got current %d while running, want 2", cur)
+		}
+		return errFn
+	})
+	if err != errFn {
+		t.Errorf("got %v, want %v", err, errFn)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic of fn was not propagated")
+			}
+		}()
+		sem.Do(ctx, 1, func() error { panic("boom") })
+	}()
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d after Do, want 0", cur)
+	}
+}
+
+func TestWeightedDoCanceled(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	ran := false
+	if err := sem.Do(ctx, 1, func() error { ran = true; return nil }); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if ran {
+		t.Error("fn ran without the weight")
+	}
+}
+
+func TestWeightedGo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		if err := sem.Go(ctx, 1, func() {
+			defer wg.Done()
+			if cur := sem.Current(); cur > 2 {
+				t.Errorf("got current %d while running, want at most 2", cur)
+			}
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	sem.Acquire(ctx, 2) // Once every goroutine has released.
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := sem.Go(canceled, 1, func() { t.Error("fn started without the weight") }); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,70 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "context"
+
+// Drain shuts the semaphore down gracefully: it stops admitting acquisitions,
+// failing queued and later Acquire calls with a *StateError, and blocks until
+// the current holders have released everything, when the semaphore moves from
+// StateDraining to StateClosed. Returns nil once drained, or ctx.Err() if ctx
+// is done first, leaving the semaphore draining.
+//
+// Drain of a closed semaphore only waits for its holders.
+func (s *Weighted) Drain(ctx context.Context) error {
+	s.lock()
+	if s.setState(StateDraining) {
+		s.failWaiters(&StateError{State: StateDraining})
+		s.notifyWaiters()
+	}
+	s.unlock()
+	return s.WaitIdle(ctx)
+}
+
+// WaitIdle blocks until nothing is held and no Acquire call is queued, or ctx
+// is done. Unlike Drain it doesn't stop admitting acquisitions, so the
+// semaphore may be busy again by the time WaitIdle returns. Returns nil once
+// idle, or ctx.Err().
+func (s *Weighted) WaitIdle(ctx context.Context) error {
+	s.lock()
+	if s.isIdle() {
+		s.mu.Unlock()
+		return nil
+	}
+	idle := make(chan struct{})
+	s.idle = append(s.idle, idle)
+	s.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		s.lock()
+		for i, ch := range s.idle {
+			if ch == idle {
+				s.idle = append(s.idle[:i], s.idle[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// isIdle reports whether nothing is held or queued. Must be called with s.mu
+// held.
+func (s *Weighted) isIdle() bool {
+	return s.cur == 0 && s.waiters.Len()+s.impossibleWaiters.Len() == 0
+}
+
+// checkIdle wakes the WaitIdle calls if the semaphore is idle. Must be called
+// with s.mu held.
+func (s *Weighted) checkIdle() {
+	if len(s.idle) == 0 || !s.isIdle() {
+		return
+	}
+	for _, ch := range s.idle {
+		close(ch)
+	}
+	s.idle = nil
+}
@@ -0,0 +1,106 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedDrain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	sem.Acquire(ctx, 2)
+	done := make(chan error, 2)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	go func() { done <- sem.Acquire(ctx, 3) }() // Impossible.
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	drained := make(chan error)
+	go func() { drained <- sem.Drain(ctx) }()
+	for i := 0; i < 2; i++ {
+		err := <-done
+		if se, ok := err.(*StateError); !ok || se.State != StateDraining {
+			t.Fatalf("queued Acquire got %v, want *StateError for %v", err, StateDraining)
+		}
+	}
+	if err := sem.Acquire(ctx, 1); err == nil {
+		t.Fatal("Acquire succeeded while draining")
+	}
+
+	sem.Release(1)
+	select {
+	case err := <-drained:
+		t.Fatalf("Drain returned %v while holders remain", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+	if st := sem.State(); st != StateDraining {
+		t.Fatalf("got state %v while holders remain, want %v", st, StateDraining)
+	}
+
+	sem.Release(1)
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if st := sem.State(); st != StateClosed {
+		t.Fatalf("got state %v once drained, want %v", st, StateClosed)
+	}
+}
+
+func TestWeightedDrainCanceled(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if err := sem.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if st := sem.State(); st != StateDraining {
+		t.Errorf("got state %v after canceled Drain, want %v", st, StateDraining)
+	}
+}
+
+func TestWeightedWaitIdle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	if err := sem.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sem.Acquire(ctx, 1)
+	queued := make(chan error)
+	go func() { queued <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	idle := make(chan error)
+	go func() { idle <- sem.WaitIdle(ctx) }()
+
+	// Handing the weight to the queued waiter doesn't make the semaphore idle.
+	sem.Release(1)
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-idle:
+		t.Fatal("WaitIdle returned while weight is held")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	sem.Release(1)
+	if err := <-idle; err != nil {
+		t.Fatal(err)
+	}
+	if !sem.TryAcquire(1) {
+		t.Error("WaitIdle stopped admitting acquisitions")
+	}
+}
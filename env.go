@@ -0,0 +1,84 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variables read by NewWeightedFromEnv, after the prefix.
+const (
+	EnvSize          = "SIZE"           // Required. Maximum combined weight.
+	EnvName          = "NAME"           // See WithName.
+	EnvMaxWait       = "MAX_WAIT"       // A time.Duration; see WithMaxWait.
+	EnvDefaultWeight = "DEFAULT_WEIGHT" // See WithDefaultWeight.
+	EnvMaxWaiters    = "MAX_WAITERS"    // Bounds the queue; see WithMaxWaiters.
+	EnvPolicy        = "POLICY"         // "fifo" or "lifo"; see WithQueuePolicy.
+)
+
+// NewWeightedFromEnv creates a new weighted semaphore configured by the
+// environment variables named prefix + "_" + one of the Env constants, e.g.
+// DB_SIZE and DB_MAX_WAIT for prefix "DB". The size is required; every other
+// variable is optional and leaves the default, or the setting of opts, when
+// unset. Set variables are applied after opts and take precedence.
+//
+// Returns an error naming the variable if one is missing or invalid.
+func NewWeightedFromEnv(prefix string, opts ...Option) (*Weighted, error) {
+	env := func(key string) (string, string, bool) {
+		name := key
+		if prefix != "" {
+			name = prefix + "_" + key
+		}
+		value, ok := os.LookupEnv(name)
+		return name, value, ok
+	}
+
+	name, value, ok := env(EnvSize)
+	if !ok {
+		return nil, fmt.Errorf("semaphore: %s is not set", name)
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("semaphore: %s: invalid size %q", name, value)
+	}
+
+	opts = append([]Option(nil), opts...)
+	if _, value, ok := env(EnvName); ok {
+		opts = append(opts, WithName(value))
+	}
+	if name, value, ok := env(EnvMaxWait); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("semaphore: %s: invalid max wait %q", name, value)
+		}
+		opts = append(opts, WithMaxWait(d))
+	}
+	if name, value, ok := env(EnvDefaultWeight); ok {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("semaphore: %s: invalid default weight %q", name, value)
+		}
+		opts = append(opts, WithDefaultWeight(n))
+	}
+	if name, value, ok := env(EnvMaxWaiters); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("semaphore: %s: invalid max waiters %q", name, value)
+		}
+		opts = append(opts, WithMaxWaiters(n))
+	}
+	if name, value, ok := env(EnvPolicy); ok {
+		switch value {
+		case "fifo":
+			opts = append(opts, WithQueuePolicy(FIFO))
+		case "lifo":
+			opts = append(opts, WithQueuePolicy(LIFO))
+		default:
+			return nil, fmt.Errorf("semaphore: %s: invalid policy %q", name, value)
+		}
+	}
+	return NewWeighted(size, opts...), nil
+}
@@ -0,0 +1,87 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewWeightedFromEnv(t *testing.T) {
+	t.Setenv("DB_SIZE", "5")
+	t.Setenv("DB_NAME", "db")
+	t.Setenv("DB_MAX_WAIT", "50ms")
+	t.Setenv("DB_DEFAULT_WEIGHT", "2")
+	t.Setenv("DB_MAX_WAITERS", "1")
+
+	sem, err := NewWeightedFromEnv("DB", WithName("ignored"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, name := sem.Size(), sem.Name(); size != 5 || name != "db" {
+		t.Errorf("got size %d, name %q; want 5, \"db\"", size, name)
+	}
+	if sem.maxWaiters != 1 || sem.slots != nil {
+		t.Errorf("got max waiters %d, preallocated %t; want 1 set WithMaxWaiters", sem.maxWaiters, sem.slots != nil)
+	}
+
+	sem.AcquireDefault(context.Background())
+	if cur := sem.Current(); cur != 2 {
+		t.Errorf("Current() = %d after AcquireDefault, want 2", cur)
+	}
+	done := make(chan error)
+	go func() { done <- sem.Acquire(context.Background(), 4) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := sem.Acquire(context.Background(), 1); err != ErrQueueFull {
+		t.Errorf("Acquire beyond max waiters = %v, want ErrQueueFull", err)
+	}
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire beyond max wait = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestNewWeightedFromEnvInvalid(t *testing.T) {
+	tries := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{}, "semaphore: Q_SIZE is not set"},
+		{map[string]string{"Q_SIZE": "-1"}, `semaphore: Q_SIZE: invalid size "-1"`},
+		{map[string]string{"Q_SIZE": "1", "Q_MAX_WAIT": "soon"}, `semaphore: Q_MAX_WAIT: invalid max wait "soon"`},
+		{map[string]string{"Q_SIZE": "1", "Q_DEFAULT_WEIGHT": "0"}, `semaphore: Q_DEFAULT_WEIGHT: invalid default weight "0"`},
+		{map[string]string{"Q_SIZE": "1", "Q_MAX_WAITERS": "-1"}, `semaphore: Q_MAX_WAITERS: invalid max waiters "-1"`},
+		{map[string]string{"Q_SIZE": "1", "Q_MAX_WAITERS": "0"}, `semaphore: Q_MAX_WAITERS: invalid max waiters "0"`},
+		{map[string]string{"Q_SIZE": "1", "Q_POLICY": "random"}, `semaphore: Q_POLICY: invalid policy "random"`},
+	}
+	for i, try := range tries {
+		t.Run("", func(t *testing.T) {
+			for k, v := range try.env {
+				t.Setenv(k, v)
+			}
+			if _, err := NewWeightedFromEnv("Q"); err == nil || err.Error() != try.want {
+				t.Errorf("tries[%d]: got %v, want %s", i, err, try.want)
+			}
+		})
+	}
+}
+
+func TestWeightedMaxWait(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1, WithMaxWait(10*time.Millisecond))
+	sem.Acquire(context.Background(), 1)
+	start := time.Now()
+	if err := sem.Acquire(context.Background(), 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire = %v, want context.DeadlineExceeded", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("waited %v, want about 10ms", waited)
+	}
+	if n := sem.Waiters(); n != 0 {
+		t.Errorf("Waiters() = %d after timeout, want 0", n)
+	}
+}
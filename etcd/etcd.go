@@ -0,0 +1,282 @@
+// Package etcd implements a weighted semaphore shared by many processes,
+// stored in etcd.
+//
+// Every acquisition is a key under the semaphore's prefix, attached to the
+// lease of the process's session, so the holds of a process that crashes or
+// loses its connection disappear when the lease expires. Acquisitions are
+// admitted in the order their keys were created, like Weighted admits its
+// waiters, and the create revision of its key is a fencing token: it grows
+// with every acquisition, so a resource guarded by the semaphore can reject
+// requests from holders that were since superseded.
+package etcd
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/sherifabdlnaby/semaphore"
+	"github.com/sherifabdlnaby/semaphore/internal/holdset"
+)
+
+// Semaphore is a weighted semaphore stored in etcd. Every process sharing it
+// creates its own Semaphore with the same prefix.
+type Semaphore struct {
+	kv      clientv3.KV
+	watcher clientv3.Watcher
+	session session
+	prefix  string
+	size    int64
+	holds   holdset.Set
+	onError func(error)
+}
+
+// session is the lease a Semaphore attaches its keys to, a
+// *concurrency.Session.
+type session interface {
+	Lease() clientv3.LeaseID
+	Done() <-chan struct{}
+	Close() error
+}
+
+// Option configures a Semaphore.
+type Option func(*options)
+
+type options struct {
+	ttl     int
+	onError func(error)
+}
+
+// WithTTL sets the ttl of the lease of the process's session, renewed while it
+// is alive, in seconds. The default is 60.
+func WithTTL(seconds int) Option {
+	if seconds <= 0 {
+		panic("etcd: bad ttl")
+	}
+	return func(o *options) {
+		o.ttl = seconds
+	}
+}
+
+// WithErrorHandler sets a function called with the errors of the calls that
+// can't return them: TryAcquire, Release and Resize. By default, they are
+// dropped.
+func WithErrorHandler(fn func(error)) Option {
+	return func(o *options) {
+		o.onError = fn
+	}
+}
+
+// New creates a new Semaphore stored under prefix, with the given size unless
+// one was set by Resize, and opens its session.
+func New(client *clientv3.Client, prefix string, size int64, opts ...Option) (*Semaphore, error) {
+	o := options{ttl: 60}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	session, err := concurrency.NewSession(client, concurrency.WithTTL(o.ttl))
+	if err != nil {
+		return nil, fmt.Errorf("etcd: %w", err)
+	}
+	return &Semaphore{kv: client, watcher: client, session: session, prefix: prefix + "/", size: size, onError: o.onError}, nil
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() or the error of the etcd client, and leaves the semaphore
+// unchanged.
+//
+// If n is more than the size, Acquire fails with semaphore.ErrRequestTooLarge
+// rather than wait for a Resize, as it does if the semaphore is resized below
+// n while it waits, so it doesn't hold up the acquisitions queued after it.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	_, err := s.AcquireFenced(ctx, n)
+	return err
+}
+
+// AcquireFenced is like Acquire, but also returns the fencing token of the
+// hold, greater than that of every hold acquired before it.
+func (s *Semaphore) AcquireFenced(ctx context.Context, n int64) (int64, error) {
+	if err := s.checkSize(ctx, n); err != nil {
+		return 0, err
+	}
+	key, rev, err := s.enqueue(ctx, n)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		ok, at, err := s.admitted(ctx, n, rev)
+		if err == nil && ok {
+			s.holds.Add(holdset.Hold{ID: key, N: n})
+			return rev, nil
+		}
+		if err == nil {
+			err = s.wait(ctx, at)
+		}
+		if err != nil {
+			s.dequeue(key)
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			return 0, err
+		}
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including an error of the etcd client,
+// returns false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	ctx := context.Background()
+	if err := s.checkSize(ctx, n); err != nil {
+		if err != semaphore.ErrRequestTooLarge {
+			s.error(err)
+		}
+		return false
+	}
+	key, rev, err := s.enqueue(ctx, n)
+	if err != nil {
+		s.error(err)
+		return false
+	}
+	ok, _, err := s.admitted(ctx, n, rev)
+	if err != nil && err != semaphore.ErrRequestTooLarge {
+		s.error(err)
+	}
+	if !ok {
+		s.dequeue(key)
+		return false
+	}
+	s.holds.Add(holdset.Hold{ID: key, N: n})
+	return true
+}
+
+// Release releases a hold with a weight of n. It panics if the process holds
+// none.
+func (s *Semaphore) Release(n int64) {
+	h, ok := s.holds.Take(n)
+	if !ok {
+		panic("etcd: bad release")
+	}
+	s.dequeue(h.ID)
+}
+
+// Resize sets the size of the semaphore for every process sharing it.
+func (s *Semaphore) Resize(n int64) {
+	if n < 0 {
+		panic("etcd: bad resize")
+	}
+	if _, err := s.kv.Put(context.Background(), s.sizeKey(), strconv.FormatInt(n, 10)); err != nil {
+		s.error(fmt.Errorf("etcd: resize: %w", err))
+	}
+}
+
+// Lost returns a channel that is closed if the session's lease expires, after
+// which the holds of the process may be held by others.
+func (s *Semaphore) Lost() <-chan struct{} {
+	return s.session.Done()
+}
+
+// Close closes the session, revoking its lease and so giving up every hold of
+// the process.
+func (s *Semaphore) Close() error {
+	return s.session.Close()
+}
+
+func (s *Semaphore) sizeKey() string {
+	return s.prefix + "size"
+}
+
+// enqueue creates the key of an acquisition of a weight of n, returning the
+// key and its create revision.
+func (s *Semaphore) enqueue(ctx context.Context, n int64) (string, int64, error) {
+	key := fmt.Sprintf("%sholders/%x-%s", s.prefix, s.session.Lease(), rand.Text())
+	resp, err := s.kv.Put(ctx, key, strconv.FormatInt(n, 10), clientv3.WithLease(s.session.Lease()))
+	if err != nil {
+		return "", 0, fmt.Errorf("etcd: acquire: %w", err)
+	}
+	return key, resp.Header.Revision, nil
+}
+
+// dequeue deletes the key of an acquisition, even if the ctx it was made with
+// is done.
+func (s *Semaphore) dequeue(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.kv.Delete(ctx, key); err != nil {
+		s.error(fmt.Errorf("etcd: release: %w", err))
+	}
+}
+
+// checkSize returns semaphore.ErrRequestTooLarge if n is more than the size.
+func (s *Semaphore) checkSize(ctx context.Context, n int64) error {
+	resp, err := s.kv.Get(ctx, s.sizeKey())
+	if err != nil {
+		return fmt.Errorf("etcd: acquire: %w", err)
+	}
+	if _, size := admits(resp.Kvs, s.sizeKey(), s.size, 0); n > size {
+		return semaphore.ErrRequestTooLarge
+	}
+	return nil
+}
+
+// admitted reports whether the acquisition of a weight of n created at rev is
+// admitted, along with the revision its decision was read at. Returns
+// semaphore.ErrRequestTooLarge if n is more than the size.
+func (s *Semaphore) admitted(ctx context.Context, n, rev int64) (bool, int64, error) {
+	resp, err := s.kv.Get(ctx, s.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return false, 0, fmt.Errorf("etcd: acquire: %w", err)
+	}
+	ok, size := admits(resp.Kvs, s.sizeKey(), s.size, rev)
+	if n > size {
+		return false, 0, semaphore.ErrRequestTooLarge
+	}
+	return ok, resp.Header.Revision, nil
+}
+
+// admits reports whether the acquisition created at rev fits, along with the
+// holds and waiters created before it, in the size stored in kvs under
+// sizeKey, or else size. It also returns the size it used.
+func admits(kvs []*mvccpb.KeyValue, sizeKey string, size, rev int64) (bool, int64) {
+	var used int64
+	for _, kv := range kvs {
+		n, err := strconv.ParseInt(string(kv.Value), 10, 64)
+		switch {
+		case err != nil:
+		case string(kv.Key) == sizeKey:
+			size = n
+		case kv.CreateRevision <= rev:
+			used += n
+		}
+	}
+	return used <= size, size
+}
+
+// wait blocks until something under the prefix changes after rev, or ctx is
+// done.
+func (s *Semaphore) wait(ctx context.Context, rev int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for resp := range s.watcher.Watch(ctx, s.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1)) {
+		if err := resp.Err(); err != nil {
+			return fmt.Errorf("etcd: acquire: %w", err)
+		}
+		if len(resp.Events) > 0 {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *Semaphore) error(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
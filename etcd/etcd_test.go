@@ -0,0 +1,225 @@
+package etcd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Semaphore)(nil)
+
+func TestAdmits(t *testing.T) {
+	kv := func(key, value string, rev int64) *mvccpb.KeyValue {
+		return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(value), CreateRevision: rev}
+	}
+	kvs := []*mvccpb.KeyValue{
+		kv("s/holders/a", "2", 10),
+		kv("s/holders/b", "1", 11),
+		kv("s/holders/c", "2", 12),
+	}
+
+	tries := []struct {
+		size, rev int64
+		want      bool
+	}{
+		{3, 11, true},  // a and b fit in 3.
+		{3, 12, false}, // c waits for a or b.
+		{5, 12, true},  // Everyone fits in 5.
+		{1, 10, false}, // a doesn't fit at all.
+	}
+	for i, try := range tries {
+		if got, _ := admits(kvs, "s/size", try.size, try.rev); got != try.want {
+			t.Errorf("tries[%d]: got %t, want %t", i, got, try.want)
+		}
+	}
+
+	// A size set by Resize overrides the default.
+	kvs = append(kvs, kv("s/size", "5", 13))
+	if ok, size := admits(kvs, "s/size", 3, 12); !ok || size != 5 {
+		t.Errorf("got (%t, %d), want the stored size to override the default", ok, size)
+	}
+}
+
+// fakeEtcd is an in-memory etcd with the revisions, range reads and watches a
+// Semaphore relies on. Its other methods panic.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Watcher
+	mu       sync.Mutex
+	rev      int64
+	kvs      map[string]*mvccpb.KeyValue
+	watchers map[chan clientv3.WatchResponse]clientv3.Op
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: make(map[string]*mvccpb.KeyValue), watchers: make(map[chan clientv3.WatchResponse]clientv3.Op)}
+}
+
+// matches reports whether key is op's key or in its range.
+func matches(op clientv3.Op, key string) bool {
+	if end := string(op.RangeBytes()); end != "" {
+		return key >= string(op.KeyBytes()) && key < end
+	}
+	return key == string(op.KeyBytes())
+}
+
+// changed notifies the watchers of ev. Must be called with f.mu held.
+func (f *fakeEtcd) changed(ev *mvccpb.Event) {
+	for ch, op := range f.watchers {
+		if matches(op, string(ev.Kv.Key)) {
+			ch <- clientv3.WatchResponse{Header: pb.ResponseHeader{Revision: f.rev}, Events: []*clientv3.Event{(*clientv3.Event)(ev)}}
+		}
+	}
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rev++
+	kv := &mvccpb.KeyValue{Key: []byte(key), Value: []byte(val), CreateRevision: f.rev, ModRevision: f.rev}
+	if old, ok := f.kvs[key]; ok {
+		kv.CreateRevision = old.CreateRevision
+	}
+	f.kvs[key] = kv
+	f.changed(&mvccpb.Event{Type: mvccpb.PUT, Kv: kv})
+	return &clientv3.PutResponse{Header: &pb.ResponseHeader{Revision: f.rev}}, nil
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	op := clientv3.OpGet(key, opts...)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &clientv3.GetResponse{Header: &pb.ResponseHeader{Revision: f.rev}}
+	for k, kv := range f.kvs {
+		if matches(op, k) {
+			resp.Kvs = append(resp.Kvs, kv)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &clientv3.DeleteResponse{}
+	if kv, ok := f.kvs[key]; ok {
+		f.rev++
+		delete(f.kvs, key)
+		resp.Deleted = 1
+		f.changed(&mvccpb.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: kv.Key, ModRevision: f.rev}})
+	}
+	resp.Header = &pb.ResponseHeader{Revision: f.rev}
+	return resp, nil
+}
+
+// Watch watches for changes. Keeping no history, it reports a change to key
+// right away if any was made since the revision watched from.
+func (f *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	ch := make(chan clientv3.WatchResponse, 100)
+	op := clientv3.OpGet(key, opts...)
+	f.mu.Lock()
+	f.watchers[ch] = op
+	if rev := op.Rev(); rev != 0 && rev <= f.rev {
+		ch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(key)}}}}
+	}
+	f.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		delete(f.watchers, ch)
+		f.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+// fakeSession is a session whose lease never expires.
+type fakeSession struct{}
+
+func (fakeSession) Lease() clientv3.LeaseID { return 1 }
+func (fakeSession) Done() <-chan struct{}   { return nil }
+func (fakeSession) Close() error            { return nil }
+
+func newFakeSemaphore(f *fakeEtcd, size int64) *Semaphore {
+	return &Semaphore{kv: f, watcher: f, session: fakeSession{}, prefix: "s/", size: size}
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeEtcd()
+	a, b := newFakeSemaphore(f, 3), newFakeSemaphore(f, 3)
+
+	first, err := a.AcquireFenced(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tries := []bool{}
+	tries = append(tries, b.TryAcquire(2)) // false; 2/3
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	done := make(chan int64)
+	go func() {
+		token, err := b.AcquireFenced(ctx, 2)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- token
+	}()
+	select {
+	case <-done:
+		t.Fatal("acquired beyond the size")
+	case <-time.After(10 * time.Millisecond):
+	}
+	a.Release(2)
+	second := <-done
+
+	want := []bool{false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+	if second <= first {
+		t.Errorf("got fencing tokens %d then %d, want them to grow", first, second)
+	}
+	b.Release(1)
+	b.Release(2)
+	if resp, _ := f.Get(ctx, "s/holders/", clientv3.WithPrefix()); len(resp.Kvs) != 0 {
+		t.Errorf("got %d holds left, want 0", len(resp.Kvs))
+	}
+}
+
+func TestSemaphoreRequestTooLarge(t *testing.T) {
+	ctx := context.Background()
+	f := newFakeEtcd()
+	sem := newFakeSemaphore(f, 3)
+
+	if err := sem.Acquire(ctx, 4); err != semaphore.ErrRequestTooLarge {
+		t.Errorf("Acquire beyond the size = %v, want ErrRequestTooLarge", err)
+	}
+	if sem.TryAcquire(4) {
+		t.Error("TryAcquire beyond the size succeeded")
+	}
+	if resp, _ := f.Get(ctx, "s/holders/", clientv3.WithPrefix()); len(resp.Kvs) != 0 {
+		t.Errorf("got %d keys left by rejected acquisitions, want 0", len(resp.Kvs))
+	}
+
+	// A waiter is failed once a Resize makes it too large.
+	sem.Resize(5)
+	sem.Acquire(ctx, 2)
+	done := make(chan error)
+	go func() { done <- sem.Acquire(ctx, 4) }()
+	time.Sleep(10 * time.Millisecond)
+	sem.Resize(3)
+	if err := <-done; err != semaphore.ErrRequestTooLarge {
+		t.Errorf("Acquire resized below = %v, want ErrRequestTooLarge", err)
+	}
+	sem.Release(2)
+}
@@ -0,0 +1,153 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"time"
+)
+
+// expiry tracks holds of a semaphore created WithMaxHold.
+type expiry struct {
+	maxHold  time.Duration
+	onExpire func(n int64, held time.Duration)
+	holds    list.List       // Live holds, oldest first.
+	debt     map[int64]int64 // Expired holds per weight, not yet released.
+	expired  int64
+	timer    *time.Timer
+}
+
+type hold struct {
+	n  int64
+	at time.Time
+}
+
+// WithMaxHold makes granted weight return to the semaphore automatically once
+// it has been held for longer than d, even if it is never released. It protects
+// everyone else from a holder that is stuck forever.
+//
+// Holds of equal weight are interchangeable: a Release of a weight of n pays
+// back an expired hold of the same weight before a live one, so the holder of
+// an expired grant can still release it safely. A Release matching no hold,
+// such as part of a grant released in pieces, pays back expired weight first
+// and then live weight, oldest hold first. If onExpire is not nil, it is called
+// in its own goroutine for every expired hold.
+func WithMaxHold(d time.Duration, onExpire func(n int64, held time.Duration)) Option {
+	if d <= 0 {
+		panic("semaphore: bad max hold")
+	}
+	return func(s *Weighted) {
+		s.expiry = &expiry{maxHold: d, onExpire: onExpire, debt: make(map[int64]int64)}
+	}
+}
+
+// Expired returns the number of holds that were returned by expiry.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Expired() int64 {
+	s.lock()
+	defer s.mu.Unlock()
+	if s.expiry == nil {
+		return 0
+	}
+	return s.expiry.expired
+}
+
+// trackHold records a new hold of a weight of n. Must be called with s.mu held.
+func (s *Weighted) trackHold(n int64) {
+	e := s.expiry
+	e.holds.PushBack(&hold{n: n, at: time.Now()})
+	if e.timer == nil {
+		e.timer = time.AfterFunc(e.maxHold, s.expireHolds)
+	}
+}
+
+// untrackHold accounts for a release of a weight of n, returning the part of it
+// that was live and goes back to the semaphore; the rest pays back expired
+// holds. Must be called with s.mu held.
+func (s *Weighted) untrackHold(n int64) int64 {
+	e := s.expiry
+	if e.debt[n] > 0 {
+		e.payDebt(n, n)
+		return 0
+	}
+	for elem := e.holds.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value.(*hold).n == n {
+			e.holds.Remove(elem)
+			return n
+		}
+	}
+
+	rest := n
+	for w := range e.debt {
+		if rest == 0 {
+			break
+		}
+		rest -= e.payDebt(w, rest)
+	}
+	live := rest
+	for elem := e.holds.Front(); elem != nil && rest > 0; {
+		next := elem.Next()
+		h := elem.Value.(*hold)
+		if h.n > rest {
+			h.n -= rest
+			rest = 0
+		} else {
+			rest -= h.n
+			e.holds.Remove(elem)
+		}
+		elem = next
+	}
+	// Any rest matches no hold at all, and makes the release go negative.
+	return live
+}
+
+// payDebt pays back up to max of one expired hold of a weight of w, returning
+// the weight paid. The unpaid part of a partly paid hold stays owed.
+func (e *expiry) payDebt(w, max int64) int64 {
+	if e.debt[w]--; e.debt[w] == 0 {
+		delete(e.debt, w)
+	}
+	if max >= w {
+		return w
+	}
+	e.debt[w-max]++
+	return max
+}
+
+// expireHolds returns the weight of every hold older than the maximum hold time
+// and rearms the timer for the next one.
+func (s *Weighted) expireHolds() {
+	s.lock()
+	e := s.expiry
+	now := time.Now()
+	var expired int64
+	for {
+		front := e.holds.Front()
+		if front == nil {
+			e.timer = nil
+			break
+		}
+
+		h := front.Value.(*hold)
+		held := now.Sub(h.at)
+		if held < e.maxHold {
+			e.timer = time.AfterFunc(e.maxHold-held, s.expireHolds)
+			break
+		}
+
+		e.holds.Remove(front)
+		e.debt[h.n]++
+		e.expired++
+		expired += h.n
+		s.cur -= h.n
+		s.version++
+		if e.onExpire != nil {
+			go e.onExpire(h.n, held)
+		}
+	}
+	s.notifyWaiters()
+	s.unlock()
+	if expired > 0 {
+		s.count("semaphore.expirations", expired)
+	}
+}
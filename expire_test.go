@@ -0,0 +1,95 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedMaxHold(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	expired := make(chan int64, 1)
+	sem := NewWeighted(2, WithMaxHold(10*time.Millisecond, func(n int64, held time.Duration) {
+		expired <- n
+	}))
+
+	sem.Acquire(ctx, 2) // Never released in time.
+
+	// Blocks until the stuck hold expires.
+	if err := sem.Acquire(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-expired; n != 2 {
+		t.Errorf("expired weight %d, want 2", n)
+	}
+	if n := sem.Expired(); n != 1 {
+		t.Errorf("got %d expired holds, want 1", n)
+	}
+
+	// The late release of the expired hold must not panic or free the live hold.
+	sem.Release(2)
+	if cur := sem.Current(); cur != 1 {
+		t.Errorf("got current %d, want 1", cur)
+	}
+	sem.Release(1)
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
+
+func TestWeightedMaxHoldReleasedInTime(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1, WithMaxHold(20*time.Millisecond, nil))
+	for i := 0; i < 5; i++ {
+		if !sem.TryAcquire(1) {
+			t.Fatal("TryAcquire failed on an idle semaphore")
+		}
+		sem.Release(1)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := sem.Expired(); n != 0 {
+		t.Errorf("got %d expired holds, want 0", n)
+	}
+}
+
+func TestWeightedMaxHoldSplitRelease(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4, WithMaxHold(20*time.Millisecond, nil))
+
+	// A grant released in pieces leaves nothing to expire.
+	sem.Acquire(ctx, 4)
+	sem.Release(2)
+	sem.Release(2)
+	if got, _ := sem.AcquireUpTo(ctx, 3); got != 3 {
+		t.Fatalf("AcquireUpTo got %d, want 3", got)
+	}
+	sem.Release(1)
+	sem.Release(2)
+	time.Sleep(30 * time.Millisecond)
+	if cur, n := sem.Current(), sem.Expired(); cur != 0 || n != 0 {
+		t.Fatalf("got current %d and %d expired holds, want 0 and 0", cur, n)
+	}
+
+	// An expired grant released in pieces doesn't free live weight.
+	sem.Acquire(ctx, 4)
+	for sem.Expired() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Acquire(ctx, 1)
+	sem.Release(3)
+	sem.Release(1)
+	if cur := sem.Current(); cur != 1 {
+		t.Errorf("got current %d after releasing the expired grant, want 1", cur)
+	}
+	sem.Release(1)
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
@@ -0,0 +1,272 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// FairShare is an admission controller that divides the capacity of a Weighted
+// between tenants in proportion to their shares.
+//
+// Waiting requests are admitted in order of their tenant's decayed usage
+// divided by its shares, so a tenant that recently consumed a lot of capacity
+// yields to tenants that did not. Requests of a single tenant are admitted in
+// FIFO order.
+//
+// A tenant's entitlement is its fraction of the backend size among the
+// currently active tenants. When borrowing is allowed (the default), a tenant
+// may exceed its entitlement by using capacity no other tenant is waiting for.
+type FairShare struct {
+	sem      AcquireReleaseResizer
+	halfLife time.Duration
+	noBorrow bool
+	identity IdentityFunc
+	mu       sync.Mutex
+	tenants  map[string]*tenant
+	head     *fsWaiter
+}
+
+type tenant struct {
+	shares     int64
+	configured bool
+	inUse      int64
+	usage      float64
+	updated    time.Time
+	queue      list.List
+}
+
+type fsWaiter struct {
+	t    *tenant
+	n    int64
+	head chan struct{} // Closed when the waiter may acquire from the backend.
+}
+
+// NewFairShare creates a new fair-share admission controller backed by sem.
+// Recorded usage loses half its weight every halfLife; a non-positive halfLife
+// disables decay, and an unconfigured tenant's usage is then forgotten as soon
+// as it goes idle.
+func NewFairShare(sem AcquireReleaseResizer, halfLife time.Duration) *FairShare {
+	return &FairShare{sem: sem, halfLife: halfLife, tenants: make(map[string]*tenant)}
+}
+
+// SetShares sets the shares of a tenant. Tenants that were never configured
+// have a single share.
+func (f *FairShare) SetShares(name string, shares int64) {
+	if shares <= 0 {
+		panic("semaphore: bad shares")
+	}
+	f.mu.Lock()
+	t := f.tenant(name)
+	t.shares = shares
+	t.configured = true
+	f.promote()
+	f.mu.Unlock()
+}
+
+// SetIdentity sets how tenants are identified from the context when Acquire is
+// given no tenant name. The default is CallerIdentity.
+func (f *FairShare) SetIdentity(fn IdentityFunc) {
+	f.mu.Lock()
+	f.identity = fn
+	f.mu.Unlock()
+}
+
+// Tenant returns the name of the tenant of ctx, as seen by the controller.
+func (f *FairShare) Tenant(ctx context.Context) string {
+	f.mu.Lock()
+	fn := f.identity
+	f.mu.Unlock()
+	if fn == nil {
+		fn = CallerIdentity
+	}
+	return fn(ctx)
+}
+
+// SetBorrowing sets whether tenants may use more than their entitlement while
+// capacity is idle.
+func (f *FairShare) SetBorrowing(allowed bool) {
+	f.mu.Lock()
+	f.noBorrow = !allowed
+	f.promote()
+	f.mu.Unlock()
+}
+
+// Acquire acquires a weight of n on behalf of the named tenant, blocking until
+// the tenant is scheduled and the backend has the resources available or ctx is
+// done. If name is empty, the tenant is identified from ctx; see Tenant. On
+// success, returns nil. On failure, returns ctx.Err() and leaves the controller
+// unchanged.
+func (f *FairShare) Acquire(ctx context.Context, name string, n int64) error {
+	if name == "" {
+		name = f.Tenant(ctx)
+	}
+	f.mu.Lock()
+	t := f.tenant(name)
+	w := &fsWaiter{t: t, n: n, head: make(chan struct{})}
+	elem := t.queue.PushBack(w)
+	f.promote()
+	f.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		f.mu.Lock()
+		select {
+		case <-w.head:
+			// Scheduled after we were canceled; try the backend anyway so a
+			// grant that is immediately available isn't thrown away.
+			f.mu.Unlock()
+		default:
+			t.queue.Remove(elem)
+			f.forget(name, t)
+			f.promote()
+			f.mu.Unlock()
+			report(instrumentationOf(f.sem), "semaphore.fairshare.cancellations", 1, slog.String("tenant", name))
+			return ctx.Err()
+		}
+	case <-w.head:
+	}
+
+	err := f.sem.Acquire(ctx, n)
+	if err == nil {
+		report(instrumentationOf(f.sem), "semaphore.fairshare.acquires", 1, slog.String("tenant", name))
+	} else {
+		report(instrumentationOf(f.sem), "semaphore.fairshare.cancellations", 1, slog.String("tenant", name))
+	}
+
+	f.mu.Lock()
+	t.queue.Remove(elem)
+	f.head = nil
+	if err == nil {
+		f.decay(t)
+		t.usage += float64(n)
+		t.inUse += n
+	} else {
+		f.forget(name, t)
+	}
+	f.promote()
+	f.mu.Unlock()
+	return err
+}
+
+// Release releases a weight of n previously acquired on behalf of the named
+// tenant.
+func (f *FairShare) Release(name string, n int64) {
+	f.mu.Lock()
+	t, ok := f.tenants[name]
+	if !ok || t.inUse < n {
+		f.mu.Unlock()
+		panic("semaphore: bad release")
+	}
+	t.inUse -= n
+	f.forget(name, t)
+	f.mu.Unlock()
+
+	f.sem.Release(n)
+
+	f.mu.Lock()
+	f.promote()
+	f.mu.Unlock()
+}
+
+// Usage returns the decayed usage and current in-use weight of the named tenant.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (f *FairShare) Usage(name string) (usage float64, inUse int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.tenants[name]
+	if !ok {
+		return 0, 0
+	}
+	f.decay(t)
+	return t.usage, t.inUse
+}
+
+// tenant returns the named tenant, creating it if needed. Must be called with
+// f.mu held.
+func (f *FairShare) tenant(name string) *tenant {
+	t, ok := f.tenants[name]
+	if !ok {
+		t = &tenant{shares: 1, updated: time.Now()}
+		f.tenants[name] = t
+	}
+	return t
+}
+
+// forget drops an unconfigured tenant once it is idle and its usage has
+// decayed away, or right away if usage doesn't decay. Must be called with f.mu
+// held.
+func (f *FairShare) forget(name string, t *tenant) {
+	if t.configured || t.inUse > 0 || t.queue.Len() > 0 {
+		return
+	}
+	f.decay(t)
+	if f.halfLife <= 0 || t.usage < 1 {
+		delete(f.tenants, name)
+	}
+}
+
+// decay brings the usage of t up to date. Must be called with f.mu held.
+func (f *FairShare) decay(t *tenant) {
+	now := time.Now()
+	if f.halfLife > 0 {
+		elapsed := now.Sub(t.updated)
+		t.usage *= math.Exp2(-float64(elapsed) / float64(f.halfLife))
+	}
+	t.updated = now
+}
+
+// promote picks the next waiter allowed to acquire from the backend, unless one
+// is already doing so. Must be called with f.mu held.
+func (f *FairShare) promote() {
+	if f.head != nil {
+		return
+	}
+
+	// Entitlements are computed among the tenants that are using or asking for
+	// capacity.
+	var activeShares int64
+	for _, t := range f.tenants {
+		if t.inUse > 0 || t.queue.Len() > 0 {
+			activeShares += t.shares
+		}
+	}
+	size := f.sem.Size()
+
+	var best *fsWaiter
+	var bestRank float64
+	var bestBorrowing bool
+	for _, t := range f.tenants {
+		front := t.queue.Front()
+		if front == nil {
+			continue
+		}
+		w := front.Value.(*fsWaiter)
+		entitlement := float64(size) * float64(t.shares) / float64(activeShares)
+		borrowing := float64(t.inUse+w.n) > entitlement
+		if borrowing && f.noBorrow && t.inUse > 0 {
+			// A tenant holding nothing may always make progress, otherwise
+			// requests larger than the entitlement would never be admitted.
+			continue
+		}
+
+		f.decay(t)
+		rank := t.usage / float64(t.shares)
+		switch {
+		case best == nil,
+			bestBorrowing && !borrowing,
+			bestBorrowing == borrowing && rank < bestRank:
+			best, bestRank, bestBorrowing = w, rank, borrowing
+		}
+	}
+
+	if best != nil {
+		f.head = best
+		close(best.head)
+	}
+}
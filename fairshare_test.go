@@ -0,0 +1,129 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFairShareOrdersByUsage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	f := NewFairShare(sem, 0)
+
+	// Tenant "a" builds up usage before anyone else asks for capacity.
+	for i := 0; i < 3; i++ {
+		if err := f.Acquire(ctx, "a", 1); err != nil {
+			t.Fatal(err)
+		}
+		f.Release("a", 1)
+	}
+	if err := f.Acquire(ctx, "a", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan string, 3)
+	acquire := func(name string) {
+		if err := f.Acquire(ctx, name, 1); err == nil {
+			order <- name
+			f.Release(name, 1)
+		}
+	}
+
+	// "c" is scheduled first and blocks on the backend; "a" and "b" queue
+	// behind it and are ordered by usage once "c" is admitted.
+	go acquire("c")
+	time.Sleep(10 * time.Millisecond)
+	go acquire("a")
+	time.Sleep(10 * time.Millisecond)
+	go acquire("b")
+	time.Sleep(10 * time.Millisecond)
+
+	f.Release("a", 1)
+
+	got := []string{<-order, <-order, <-order}
+	want := []string{"c", "b", "a"}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("order[%d]: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFairShareNoBorrowing(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4)
+	f := NewFairShare(sem, time.Second)
+	f.SetBorrowing(false)
+
+	if err := f.Acquire(ctx, "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Acquire(ctx, "b", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// "a" is at its entitlement of 2 out of 4 and may not borrow the idle token.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := f.Acquire(tctx, "a", 1); err == nil {
+		t.Fatal("tenant borrowed capacity with borrowing disabled")
+	}
+
+	if err := f.Acquire(ctx, "b", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	f.SetBorrowing(true)
+	f.Release("b", 1)
+	if err := f.Acquire(ctx, "a", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFairShareCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	f := NewFairShare(sem, 0)
+	f.Acquire(ctx, "a", 1)
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := f.Acquire(tctx, "b", 1); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	f.Release("a", 1)
+	if usage, inUse := f.Usage("b"); usage != 0 || inUse != 0 {
+		t.Errorf("canceled tenant has usage %v and in-use %d", usage, inUse)
+	}
+	if !sem.TryAcquire(1) {
+		t.Error("canceled Acquire leaked backend capacity")
+	}
+}
+
+func TestFairShareForgetsIdleTenantsWithoutDecay(t *testing.T) {
+	t.Parallel()
+
+	f := NewFairShare(NewWeighted(2), 0)
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprint("tenant-", i)
+		f.Acquire(context.Background(), name, 2)
+		f.Release(name, 2)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.tenants) != 0 {
+		t.Errorf("kept %d idle tenants, want 0", len(f.tenants))
+	}
+}
@@ -0,0 +1,103 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "sync/atomic"
+
+// The uncontended path. While nothing is queued and the semaphore has none of
+// the options that must see every acquisition and release under s.mu, its
+// usage and size are packed in s.fast.word, and Acquire, TryAcquire and Release
+// of a weight that fits update them with a CAS instead of locking s.mu.
+// Everything else locks s.mu with s.lock, which takes the usage back into
+// s.cur, and s.unlock hands it out again once the semaphore qualifies.
+const (
+	fastBits = 31
+	fastMax  = 1<<fastBits - 1   // Largest size and weight the uncontended path takes.
+	fastOn   = 1 << (2 * fastBits) // Set in s.fast.word while it holds the usage.
+)
+
+// fastPath is the state of the uncontended path.
+type fastPath struct {
+	word     atomic.Uint64 // fastOn | size<<fastBits | cur, or 0 while s.cur holds the usage.
+	acquires atomic.Int64  // Acquisitions made on the uncontended path, for Stats.
+	releases atomic.Int64  // Releases made on the uncontended path, for Stats.
+	peak     atomic.Int64  // Highest usage reached on the uncontended path.
+}
+
+// lock locks s.mu and takes the usage back from the uncontended path, so it
+// can be read and changed in s.cur. Must be used in place of s.mu.Lock.
+func (s *Weighted) lock() {
+	s.mu.Lock()
+	if s.fast.word.Load() != 0 {
+		s.cur = int64(s.fast.word.Swap(0) & fastMax)
+	}
+}
+
+// handOff hands the usage to the uncontended path if nothing is queued and no
+// option needs to see acquisitions and releases. Must be called with s.mu held,
+// right before unlocking it.
+func (s *Weighted) handOff() {
+	if s.state != StateOpen || s.waiters.Len() != 0 || s.impossibleWaiters.Len() != 0 ||
+		s.cur < 0 || s.cur > s.size || s.size > fastMax ||
+		s.expiry != nil || s.holders != nil || s.hooks != nil || s.waits != nil ||
+		s.warning != nil || len(s.signals) != 0 || len(s.idle) != 0 || s.instrumentation() != nil {
+		return
+	}
+	s.fast.word.Store(fastOn | uint64(s.size)<<fastBits | uint64(s.cur))
+}
+
+// fastAcquire acquires a weight of at least n and at most max on the
+// uncontended path, returning the granted weight and whether it could.
+func (s *Weighted) fastAcquire(n, max int64) (int64, bool) {
+	if n < 1 || n > fastMax {
+		return 0, false
+	}
+	for {
+		w := s.fast.word.Load()
+		// Instrumentation set by SetInstrumentation since the hand-off must
+		// see the acquisition.
+		if w == 0 || currentInstrumentation() != nil {
+			return 0, false
+		}
+		cur, size := int64(w&fastMax), int64(w>>fastBits&fastMax)
+		if size-cur < n {
+			return 0, false
+		}
+		granted := size - cur
+		if granted > max {
+			granted = max
+		}
+		if s.fast.word.CompareAndSwap(w, w+uint64(granted)) {
+			s.fast.acquires.Add(1)
+			cur += granted
+			for peak := s.fast.peak.Load(); cur > peak && !s.fast.peak.CompareAndSwap(peak, cur); {
+				peak = s.fast.peak.Load()
+			}
+			return granted, true
+		}
+	}
+}
+
+// fastRelease releases a weight of n on the uncontended path, returning whether
+// it could. Releases of more than is held are left to the slow path, to fail.
+func (s *Weighted) fastRelease(n int64) bool {
+	if n < 1 || n > fastMax {
+		return false
+	}
+	for {
+		w := s.fast.word.Load()
+		if w == 0 || int64(w&fastMax) < n || currentInstrumentation() != nil {
+			return false
+		}
+		if s.fast.word.CompareAndSwap(w, w-uint64(n)) {
+			s.fast.releases.Add(1)
+			return true
+		}
+	}
+}
+
+// fastVersion returns the version accounting for the changes made on the
+// uncontended path. Must be called with s.mu held.
+func (s *Weighted) fastVersion() uint64 {
+	return s.version + uint64(s.fast.acquires.Load()+s.fast.releases.Load())
+}
@@ -0,0 +1,137 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWeightedFastPath(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(3)
+	v := sem.Version()
+
+	sem.Acquire(ctx, 2)
+	tries := []bool{}
+	tries = append(tries, sem.fast.word.Load() != 0)  // true;  taken on the fast path
+	tries = append(tries, sem.TryAcquire(2))          // false; 2/3
+	tries = append(tries, sem.TryAcquireUpTo(5) == 1) // true;  3/3
+	sem.Release(3)
+	// Reading the usage takes it back under s.mu; the next acquisition hands
+	// it out again.
+	tries = append(tries, sem.Current() == 0)        // true
+	tries = append(tries, sem.fast.word.Load() == 0) // true
+	tries = append(tries, sem.TryAcquire(1))         // true;  1/3
+	tries = append(tries, sem.fast.word.Load() != 0) // true
+	sem.Resize(1)
+	tries = append(tries, sem.TryAcquire(1)) // false; 1/1
+	sem.Pause()
+	sem.Release(1)
+	tries = append(tries, sem.TryAcquire(1)) // false; paused
+	sem.Resume()
+	tries = append(tries, sem.TryAcquire(1)) // true;  1/1
+
+	want := []bool{true, false, true, true, true, true, true, false, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	stats := sem.Stats()
+	if stats.Acquires != 4 || stats.Releases != 2 || stats.PeakCurrent != 3 || stats.Current != 1 {
+		t.Errorf("got %+v, want 4 acquires, 2 releases, peak 3 and current 1", stats)
+	}
+	if !sem.ChangedSince(v) {
+		t.Error("version unchanged by uncontended acquisitions")
+	}
+}
+
+func TestWeightedFastPathLeavesOptions(t *testing.T) {
+	t.Parallel()
+
+	tries := []struct {
+		name string
+		opts []Option
+	}{
+		{"WithHooks", []Option{WithHooks(Hooks{OnAcquire: func(int64, time.Duration) {}})}},
+		{"WithWaitTracking", []Option{WithWaitTracking(time.Minute)}},
+		{"WithHolderTracking", []Option{WithHolderTracking(false)}},
+		{"WithInstrumentation", []Option{WithInstrumentation(newRecordingInstrumentation(nil, ""))}},
+	}
+	for i, try := range tries {
+		sem := NewWeighted(1, try.opts...)
+		sem.Acquire(context.Background(), 1)
+		if sem.fast.word.Load() != 0 {
+			t.Errorf("tries[%d]: %s uses the fast path", i, try.name)
+		}
+		sem.Release(1)
+	}
+
+	// Waiters keep the fast path off until they are admitted.
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+	done := make(chan error)
+	go func() { done <- sem.Acquire(context.Background(), 1) }()
+	waitUntil(t, func() bool { return sem.Waiters() == 1 })
+	if sem.TryAcquire(1) || sem.fast.word.Load() != 0 {
+		t.Error("fast path used while a waiter is queued")
+	}
+	sem.Release(1)
+	<-done
+	sem.Release(1)
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
+
+func TestWeightedFastPathResize(t *testing.T) {
+	t.Parallel()
+
+	const size = 4
+	sem := NewWeighted(size)
+	var held, over atomic.Int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if !sem.TryAcquire(1) {
+					continue
+				}
+				if held.Add(1) > size {
+					over.Add(1)
+				}
+				held.Add(-1)
+				sem.Release(1)
+			}
+		}()
+	}
+	for i := range 1000 {
+		// Resizing takes the usage back from the fast path under
+		// concurrent acquisitions and releases without losing any.
+		sem.Resize(int64(i%size) + 1)
+	}
+	sem.Resize(size)
+	close(stop)
+	wg.Wait()
+	if n := over.Load(); n != 0 {
+		t.Errorf("got %d acquisitions over the size", n)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
@@ -0,0 +1,193 @@
+// Package filesem implements a weighted semaphore shared by the processes of
+// a host through a directory of slot lock files, e.g. to bound the concurrent
+// invocations of a CLI tool on one machine.
+//
+// A semaphore of size n is n slot files, each held by at most one process
+// through an exclusive file lock: flock on Unix, LockFileEx on Windows. The
+// OS drops the locks of a process when it exits, so the slots of a process
+// that was killed are free again at once, with no stale lock files to clean
+// up. Every held slot file contains the PID of its holder, for diagnostics.
+//
+// A weight of n is n slots, taken all or nothing: an acquisition that can't
+// take all of them gives back those it took and retries, so two acquisitions
+// never deadlock holding part of their weight each. Blocked acquisitions poll,
+// so they are not FIFO.
+package filesem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Option configures a Semaphore.
+type Option func(*Semaphore)
+
+// WithPollInterval sets how often a blocked Acquire retries. The default is 10
+// milliseconds.
+func WithPollInterval(d time.Duration) Option {
+	if d <= 0 {
+		panic("filesem: bad poll interval")
+	}
+	return func(s *Semaphore) {
+		s.poll = d
+	}
+}
+
+// Semaphore is a semaphore of slot lock files, open in this process. Every
+// process sharing it opens the same directory with the same size.
+type Semaphore struct {
+	dir  string
+	size int64
+	poll time.Duration
+	mu   sync.Mutex
+	held []*os.File // Locked slot files, in order of acquisition.
+}
+
+// Open opens the semaphore of size slots in dir, creating the directory if
+// needed. It returns an error wrapping errors.ErrUnsupported on systems
+// without file locks.
+func Open(dir string, size int64, opts ...Option) (*Semaphore, error) {
+	if size < 0 {
+		return nil, errors.New("filesem: bad size")
+	}
+	if !supported {
+		return nil, fmt.Errorf("filesem: %w", errors.ErrUnsupported)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("filesem: %w", err)
+	}
+	s := &Semaphore{dir: dir, size: size, poll: 10 * time.Millisecond}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() or the error of the file system, and leaves the semaphore
+// unchanged.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	if n > s.size {
+		// Never fits, but may still be canceled.
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	for {
+		ok, err := s.tryAcquire(n)
+		switch {
+		case ok:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		timer := time.NewTimer(s.poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including an error of the file system,
+// returns false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	ok, _ := s.tryAcquire(n)
+	return ok
+}
+
+// tryAcquire locks n free slots, or none. Slots are tried from a random one,
+// so that processes don't all contend for the first.
+func (s *Semaphore) tryAcquire(n int64) (bool, error) {
+	if n > s.size {
+		return false, nil
+	}
+	taken := make([]*os.File, 0, n)
+	start := rand.Int64N(max(s.size, 1))
+	for i := int64(0); i < s.size && int64(len(taken)) < n; i++ {
+		f, err := s.lockSlot((start + i) % s.size)
+		if err != nil {
+			unlockSlots(taken)
+			return false, err
+		}
+		if f != nil {
+			taken = append(taken, f)
+		}
+	}
+	if int64(len(taken)) < n {
+		unlockSlots(taken)
+		return false, nil
+	}
+
+	s.mu.Lock()
+	s.held = append(s.held, taken...)
+	s.mu.Unlock()
+	return true, nil
+}
+
+// lockSlot locks the file of slot i, and returns it, or nil if another
+// process or Semaphore holds it.
+func (s *Semaphore) lockSlot(i int64) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(s.dir, "slot-"+strconv.FormatInt(i, 10)), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("filesem: %w", err)
+	}
+	ok, err := tryLock(f)
+	if err != nil || !ok {
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("filesem: lock %s: %w", f.Name(), err)
+		}
+		return nil, nil
+	}
+	// The PID is only for diagnostics, so failing to record it is fine.
+	if f.Truncate(0) == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return f, nil
+}
+
+// Release releases a weight of n held by this Semaphore. It panics if it holds
+// less.
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	if int64(len(s.held)) < n {
+		s.mu.Unlock()
+		panic("filesem: bad release")
+	}
+	released := s.held[int64(len(s.held))-n:]
+	s.held = s.held[:int64(len(s.held))-n]
+	s.mu.Unlock()
+	unlockSlots(released)
+}
+
+// Close releases every slot held by this Semaphore.
+func (s *Semaphore) Close() error {
+	s.mu.Lock()
+	held := s.held
+	s.held = nil
+	s.mu.Unlock()
+	unlockSlots(held)
+	return nil
+}
+
+// unlockSlots unlocks and closes slot files. Closing a file drops its lock
+// anyway, so the errors of unlocking don't matter.
+func unlockSlots(files []*os.File) {
+	for _, f := range files {
+		f.Truncate(0)
+		unlock(f)
+		f.Close()
+	}
+}
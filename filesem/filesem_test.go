@@ -0,0 +1,122 @@
+package filesem
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Semaphore)(nil)
+
+// openTwice opens a semaphore in a temporary directory twice, as two processes
+// would.
+func openTwice(t *testing.T, size int64) (dir string, a, b *Semaphore) {
+	dir = t.TempDir()
+	a, err := Open(dir, size, WithPollInterval(time.Millisecond))
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	b, err = Open(dir, size, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return dir, a, b
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	_, a, b := openTwice(t, 3)
+
+	tries := []bool{}
+	tries = append(tries, a.TryAcquire(2)) // true;  2/3
+	tries = append(tries, b.TryAcquire(2)) // false; shared with a
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	want := []bool{true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Acquire(ctx, 2) }()
+	time.Sleep(5 * time.Millisecond)
+	a.Release(2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(tctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// A failed acquisition gives back the slots it took.
+	b.Release(3)
+	if !a.TryAcquire(3) {
+		t.Error("slots of failed acquisitions were not given back")
+	}
+}
+
+// TestHolder is not a test, but the process holding a slot for
+// TestSemaphoreReclaim, until it is killed.
+func TestHolder(t *testing.T) {
+	dir := os.Getenv("FILESEM_TEST_HOLDER")
+	if dir == "" {
+		t.Skip("not run by TestSemaphoreReclaim")
+	}
+	s, err := Open(dir, 1)
+	if err != nil || !s.TryAcquire(1) {
+		t.Fatalf("got %v, want the slot held", err)
+	}
+	os.Stdout.WriteString("held\n")
+	select {}
+}
+
+func TestSemaphoreReclaim(t *testing.T) {
+	dir, s, _ := openTwice(t, 1)
+
+	holder := exec.Command(os.Args[0], "-test.run=^TestHolder$")
+	holder.Env = append(os.Environ(), "FILESEM_TEST_HOLDER="+dir)
+	out, err := holder.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := bufio.NewReader(out).ReadString('\n'); err != nil || line != "held\n" {
+		t.Fatalf("got %q, %v from the holder; want held", line, err)
+	}
+
+	if s.TryAcquire(1) {
+		t.Fatal("acquired the slot of a live holder")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "slot-0"))
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(holder.Process.Pid) {
+		t.Errorf("got slot file %q, %v; want the PID of its holder", data, err)
+	}
+
+	// The OS drops the locks of a killed process.
+	holder.Process.Kill()
+	holder.Wait()
+	if !s.TryAcquire(1) {
+		t.Error("slot of a killed holder was not reclaimed")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package filesem
+
+import (
+	"errors"
+	"os"
+)
+
+const supported = false
+
+func tryLock(f *os.File) (bool, error) { return false, errors.ErrUnsupported }
+func unlock(f *os.File) error          { return errors.ErrUnsupported }
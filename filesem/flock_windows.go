@@ -0,0 +1,46 @@
+//go:build windows
+
+package filesem
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const supported = true
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// tryLock locks the first byte of f exclusively if no other open file holds
+// its lock.
+func tryLock(f *os.File) (bool, error) {
+	var ol syscall.Overlapped
+	ok, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	switch {
+	case ok != 0:
+		return true, nil
+	case err == errorLockViolation:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+func unlock(f *os.File) error {
+	var ol syscall.Overlapped
+	if ok, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol))); ok == 0 {
+		return err
+	}
+	return nil
+}
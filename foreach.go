@@ -0,0 +1,44 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ForEach calls fn for every item concurrently, each holding a weight of
+// weight(item) of sem for the duration of its call, or of 1 if weight is nil.
+// Items are started in order, each once its weight is acquired. It waits for
+// every started call and returns their errors joined, in the order of items.
+//
+// A failing call doesn't stop the others. If ctx is done, ForEach starts no
+// more items and the error of ctx is joined after those of the started calls.
+func ForEach[T any](ctx context.Context, sem AcquireReleaser, items []T, weight func(T) int64, fn func(context.Context, T) error) error {
+	errs := make([]error, len(items)+1)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		n := int64(1)
+		if weight != nil {
+			n = weight(item)
+		}
+		err := ctx.Err()
+		if err == nil {
+			// Acquire may succeed in a done ctx.
+			err = sem.Acquire(ctx, n)
+		}
+		if err != nil {
+			errs[len(items)] = err
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(n)
+			errs[i] = fn(ctx, item)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
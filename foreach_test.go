@@ -0,0 +1,61 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEach(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(3)
+	var sum atomic.Int64
+	err := ForEach(context.Background(), sem, []int64{1, 2, 3, 1, 2}, func(n int64) int64 { return n }, func(ctx context.Context, n int64) error {
+		if cur := sem.Current(); cur > 3 {
+			t.Errorf("got current %d, want at most 3", cur)
+		}
+		sum.Add(n)
+		if n == 2 {
+			return fmt.Errorf("item %d", n)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "item 2\nitem 2" {
+		t.Errorf("got %v, want the errors of both items of weight 2", err)
+	}
+	if n := sum.Load(); n != 9 {
+		t.Errorf("got sum %d, want 9", n)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d after ForEach, want 0", cur)
+	}
+}
+
+func TestForEachCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sem := NewWeighted(1)
+	var calls atomic.Int64
+	err := ForEach(ctx, sem, []string{"a", "b", "c"}, nil, func(context.Context, string) error {
+		calls.Add(1)
+		// The next item fails to acquire while this one holds the weight.
+		cancel()
+		for sem.Waiters() != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d calls, want 1", n)
+	}
+}
@@ -0,0 +1,153 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Gate is an admission gate that callers pass through before doing work. While
+// the gate is closed, callers queue in FIFO order; opening it lets them through.
+//
+// OpenGradually reopens a closed gate while admitting the queued backlog at a
+// controlled rate, so a recovering system isn't immediately re-saturated.
+type Gate struct {
+	mu      sync.Mutex
+	open    bool
+	gen     uint64 // Bumped whenever a gradual opening must stop.
+	waiters list.List
+}
+
+// NewGate creates a new gate that is initially open or closed.
+func NewGate(open bool) *Gate {
+	return &Gate{open: open}
+}
+
+// Wait blocks until the gate lets the caller through or ctx is done. On success,
+// returns nil. On failure, returns ctx.Err().
+//
+// If ctx is already done, Wait may still succeed without blocking.
+func (g *Gate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	if g.open && g.waiters.Len() == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := g.waiters.PushBack(ready)
+	g.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		g.mu.Lock()
+		select {
+		case <-ready:
+			err = nil
+		default:
+			g.waiters.Remove(elem)
+		}
+		g.mu.Unlock()
+		return err
+
+	case <-ready:
+		return nil
+	}
+}
+
+// Open opens the gate, letting every queued caller through at once.
+func (g *Gate) Open() {
+	g.mu.Lock()
+	g.gen++
+	g.open = true
+	for g.waiters.Len() > 0 {
+		g.admitFront()
+	}
+	g.mu.Unlock()
+	report(currentInstrumentation(), "semaphore.gate.opens", 1)
+}
+
+// Close closes the gate. Callers arriving afterwards queue until it is opened
+// again. Close stops any gradual opening in progress.
+func (g *Gate) Close() {
+	g.mu.Lock()
+	g.gen++
+	g.open = false
+	g.mu.Unlock()
+	report(currentInstrumentation(), "semaphore.gate.closes", 1)
+}
+
+// OpenGradually opens the gate, letting queued callers through at no more than
+// ratePerSecond. Callers arriving while the backlog is admitted queue behind it;
+// once the queue is empty the gate is fully open.
+func (g *Gate) OpenGradually(ratePerSecond float64) {
+	if ratePerSecond <= 0 {
+		panic("semaphore: bad gate rate")
+	}
+
+	report(currentInstrumentation(), "semaphore.gate.opens", 1)
+	g.mu.Lock()
+	g.gen++
+	gen := g.gen
+	g.open = true
+	if g.waiters.Len() == 0 {
+		g.mu.Unlock()
+		return
+	}
+	g.admitFront()
+	g.mu.Unlock()
+
+	// Rates beyond one caller per nanosecond are admitted as fast as the
+	// ticker allows.
+	interval := time.Duration(float64(time.Second) / ratePerSecond)
+	if interval < time.Nanosecond {
+		interval = time.Nanosecond
+	}
+	go g.meter(gen, interval)
+}
+
+// IsOpen returns whether the gate is open, including while it opens gradually.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (g *Gate) IsOpen() bool {
+	g.mu.Lock()
+	open := g.open
+	g.mu.Unlock()
+	return open
+}
+
+// Waiters returns the number of callers queued at the gate.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (g *Gate) Waiters() int {
+	g.mu.Lock()
+	waiters := g.waiters.Len()
+	g.mu.Unlock()
+	return waiters
+}
+
+// meter admits one queued caller every interval until the queue is empty or the
+// gate changes state.
+func (g *Gate) meter(gen uint64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		g.mu.Lock()
+		if g.gen != gen || g.waiters.Len() == 0 {
+			g.mu.Unlock()
+			return
+		}
+		g.admitFront()
+		g.mu.Unlock()
+	}
+}
+
+// admitFront lets the first queued caller through. Must be called with g.mu
+// held and a non-empty queue.
+func (g *Gate) admitFront() {
+	front := g.waiters.Front()
+	g.waiters.Remove(front)
+	close(front.Value.(chan struct{}))
+}
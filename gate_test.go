@@ -0,0 +1,113 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	g := NewGate(true)
+	if err := g.Wait(ctx); err != nil {
+		t.Fatalf("Wait on an open gate: %v", err)
+	}
+
+	g.Close()
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := g.Wait(tctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if g.Waiters() != 0 {
+		t.Errorf("canceled waiter still queued")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		g.Wait(ctx)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	g.Open()
+	<-done
+}
+
+func TestGateOpenGradually(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	g := NewGate(false)
+
+	const n = 5
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			g.Wait(ctx)
+		}()
+	}
+	for g.Waiters() != n {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	g.OpenGradually(100) // One caller every 10ms.
+	wg.Wait()
+
+	// The first caller goes through immediately, the other four are metered.
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("backlog of %d admitted in %v, want at least 40ms", n, elapsed)
+	}
+	if !g.IsOpen() {
+		t.Error("gate not open after gradual opening")
+	}
+}
+
+func TestGateCloseStopsGradualOpening(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	g := NewGate(false)
+	for i := 0; i < 3; i++ {
+		go g.Wait(ctx)
+	}
+	for g.Waiters() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	g.OpenGradually(50)
+	g.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	if w := g.Waiters(); w != 2 {
+		t.Errorf("got %d waiters after Close, want 2", w)
+	}
+	g.Open()
+}
+
+func TestGateOpenGraduallyHugeRate(t *testing.T) {
+	t.Parallel()
+
+	g := NewGate(false)
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			g.Wait(context.Background())
+			done <- struct{}{}
+		}()
+	}
+	for g.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	g.OpenGradually(1e12)
+	<-done
+	<-done
+}
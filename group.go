@@ -0,0 +1,62 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs functions concurrently under a semaphore and collects the first
+// error, like golang.org/x/sync/errgroup.Group with a weight per function
+// instead of a single limit.
+type Group struct {
+	sem    AcquireReleaser
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	cancel context.CancelCauseFunc
+}
+
+// NewGroup creates a new Group admitting functions on sem, and a context
+// derived from ctx that is canceled when a function of the group first fails
+// or Wait returns, whichever happens first.
+func NewGroup(ctx context.Context, sem AcquireReleaser) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{sem: sem, cancel: cancel}, ctx
+}
+
+// Go blocks until a weight of n is acquired in ctx, then calls fn in a new
+// goroutine, releasing the weight when it returns. If the weight can't be
+// acquired, its error becomes the group's, as if fn had returned it, and fn is
+// not called.
+func (g *Group) Go(ctx context.Context, n int64, fn func() error) {
+	if err := g.sem.Acquire(ctx, n); err != nil {
+		g.fail(err)
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.sem.Release(n)
+		if err := fn(); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until every function started by Go has returned, then returns
+// the first error of the group, if any.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(g.err)
+	return g.err
+}
+
+// fail records err as the group's error, if it is the first.
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel(err)
+	})
+}
@@ -0,0 +1,59 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(4)
+	g, ctx := NewGroup(context.Background(), sem)
+	var calls atomic.Int64
+	for i := 0; i < 16; i++ {
+		g.Go(ctx, int64(1+i%2), func() error {
+			calls.Add(1)
+			if cur := sem.Current(); cur > 4 {
+				t.Errorf("got current %d, want at most 4", cur)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 16 {
+		t.Errorf("got %d calls, want 16", n)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d after Wait, want 0", cur)
+	}
+	if ctx.Err() == nil {
+		t.Error("group context not canceled after Wait")
+	}
+}
+
+func TestGroupFirstError(t *testing.T) {
+	t.Parallel()
+
+	errFirst := errors.New("first")
+	sem := NewWeighted(1)
+	g, ctx := NewGroup(context.Background(), sem)
+	g.Go(ctx, 1, func() error { return errFirst })
+	// The failure cancels ctx, ending the second function either way.
+	g.Go(ctx, 1, func() error {
+		<-ctx.Done()
+		return errors.New("second")
+	})
+	if err := g.Wait(); err != errFirst {
+		t.Errorf("got %v, want the first error", err)
+	}
+	if cause := context.Cause(ctx); cause != errFirst {
+		t.Errorf("got cause %v, want the first error", cause)
+	}
+}
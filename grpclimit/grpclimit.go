@@ -0,0 +1,123 @@
+// Package grpclimit provides gRPC server interceptors that bound the
+// concurrent handlers of a server with a semaphore.Weighted.
+package grpclimit
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+// Option configures the interceptors.
+type Option func(*limiter)
+
+type limiter struct {
+	sem     *semaphore.Weighted
+	weight  func(ctx context.Context, fullMethod string) int64
+	maxWait time.Duration
+	code    codes.Code
+}
+
+// WithWeight sets the weight of a call from its context and full method name,
+// e.g. "/pkg.Service/Method". By default, every call has a weight of 1.
+func WithWeight(fn func(ctx context.Context, fullMethod string) int64) Option {
+	return func(l *limiter) {
+		l.weight = fn
+	}
+}
+
+// WithMaxWait bounds how long a call waits for its weight before it is
+// rejected. By default, calls wait until their deadline or cancellation.
+func WithMaxWait(d time.Duration) Option {
+	if d <= 0 {
+		panic("grpclimit: bad max wait")
+	}
+	return func(l *limiter) {
+		l.maxWait = d
+	}
+}
+
+// WithRejectCode sets the status code of rejected calls. The default is
+// codes.ResourceExhausted.
+func WithRejectCode(c codes.Code) Option {
+	return func(l *limiter) {
+		l.code = c
+	}
+}
+
+func newLimiter(sem *semaphore.Weighted, opts []Option) *limiter {
+	l := &limiter{sem: sem, code: codes.ResourceExhausted}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.weight == nil {
+		l.weight = func(context.Context, string) int64 { return 1 }
+	}
+	return l
+}
+
+// UnaryServerInterceptor returns an interceptor that acquires the weight of
+// every unary call from sem before running its handler, and releases it once
+// the handler returns.
+//
+// Calls that can't acquire their weight, because they waited for longer than
+// WithMaxWait allows, hit their deadline, or sem refused them, e.g. with
+// semaphore.ErrQueueFull, fail with the code set WithRejectCode. Admitted calls
+// carry a semaphore.Token in their context; see semaphore.TokenFromContext.
+func UnaryServerInterceptor(sem *semaphore.Weighted, opts ...Option) grpc.UnaryServerInterceptor {
+	l := newLimiter(sem, opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		tok, err := l.acquire(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer tok.Release()
+		return handler(semaphore.ContextWithToken(ctx, tok), req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that holds the weight of
+// every streaming call from sem for the lifetime of its handler. Rejections
+// are as for UnaryServerInterceptor.
+func StreamServerInterceptor(sem *semaphore.Weighted, opts ...Option) grpc.StreamServerInterceptor {
+	l := newLimiter(sem, opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		tok, err := l.acquire(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer tok.Release()
+		return handler(srv, &stream{ServerStream: ss, ctx: semaphore.ContextWithToken(ss.Context(), tok)})
+	}
+}
+
+// acquire acquires the weight of a call to method, returning a status error
+// with l.code on failure.
+func (l *limiter) acquire(ctx context.Context, method string) (*semaphore.Token, error) {
+	n := l.weight(ctx, method)
+	actx := ctx
+	if l.maxWait > 0 {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithTimeout(ctx, l.maxWait)
+		defer cancel()
+	}
+	if err := l.sem.Acquire(actx, n); err != nil {
+		return nil, status.Errorf(l.code, "grpclimit: %s: %v", method, err)
+	}
+	return semaphore.NewToken(l.sem, n), nil
+}
+
+// stream is a grpc.ServerStream whose context carries the call's token.
+type stream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,77 @@
+package grpclimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	sem := semaphore.NewWeighted(2)
+	weight := func(ctx context.Context, method string) int64 {
+		if method == "/test.Service/Heavy" {
+			return 2
+		}
+		return 1
+	}
+	intercept := UnaryServerInterceptor(sem, WithWeight(weight), WithMaxWait(10*time.Millisecond))
+
+	var admitted bool
+	handler := func(ctx context.Context, req any) (any, error) {
+		_, admitted = semaphore.TokenFromContext(ctx, sem)
+		return sem.Current(), nil
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Heavy"}
+	resp, err := intercept(context.Background(), nil, info, handler)
+	if err != nil || resp != int64(2) || !admitted {
+		t.Errorf("got %v, %v, admitted %t; want 2 in flight, no error, true", resp, err, admitted)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got %d in flight after the call, want 0", cur)
+	}
+
+	sem.Acquire(context.Background(), 2)
+	info = &grpc.UnaryServerInfo{FullMethod: "/test.Service/Light"}
+	if _, err := intercept(context.Background(), nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("got %v, want %v", err, codes.ResourceExhausted)
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	sem := semaphore.NewWeighted(1)
+	intercept := StreamServerInterceptor(sem, WithMaxWait(10*time.Millisecond), WithRejectCode(codes.Unavailable))
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Watch"}
+	ss := fakeStream{ctx: context.Background()}
+
+	err := intercept(nil, ss, info, func(srv any, ss grpc.ServerStream) error {
+		if _, ok := semaphore.TokenFromContext(ss.Context(), sem); !ok {
+			t.Error("stream context carries no token")
+		}
+		// A second stream is rejected while the first holds the weight.
+		err := intercept(nil, ss, info, func(any, grpc.ServerStream) error { return nil })
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("got %v, want %v", err, codes.Unavailable)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got %d in flight after the stream, want 0", cur)
+	}
+}
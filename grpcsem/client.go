@@ -0,0 +1,139 @@
+package grpcsem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	"github.com/sherifabdlnaby/semaphore/internal/holdset"
+)
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithErrorHandler sets a function called with the errors of the calls that
+// can't return them: TryAcquire and Release. By default, they are dropped.
+func WithErrorHandler(fn func(error)) ClientOption {
+	return func(c *Client) {
+		c.onError = fn
+	}
+}
+
+// Client is a client of the semaphore of a Server.
+type Client struct {
+	cc      grpc.ClientConnInterface
+	onError func(error)
+	holds   holdset.Set
+}
+
+// NewClient creates a new Client calling the server of cc.
+func NewClient(cc grpc.ClientConnInterface, opts ...ClientOption) *Client {
+	c := &Client{cc: cc}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() or the error of the call, and leaves the semaphore unchanged.
+func (c *Client) Acquire(ctx context.Context, n int64) error {
+	resp, err := c.acquire(ctx, n, true)
+	switch {
+	case ctx.Err() != nil:
+		if err == nil && resp.acquired {
+			return nil // Acquired as ctx was done.
+		}
+		return ctx.Err()
+	case err != nil:
+		return err
+	case !resp.acquired:
+		return errors.New("grpcsem: acquire: not acquired")
+	}
+	return nil
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including an error of the call, returns
+// false and leaves the semaphore unchanged.
+func (c *Client) TryAcquire(n int64) bool {
+	resp, err := c.acquire(context.Background(), n, false)
+	if err != nil {
+		c.error(err)
+		return false
+	}
+	return resp.acquired
+}
+
+func (c *Client) acquire(ctx context.Context, n int64, wait bool) (*acquireResponse, error) {
+	resp := new(acquireResponse)
+	if err := c.invoke(ctx, "Acquire", &acquireRequest{weight: n, wait: wait}, resp); err != nil {
+		return nil, fmt.Errorf("grpcsem: acquire: %w", err)
+	}
+	if resp.acquired {
+		c.holds.Add(holdset.Hold{ID: resp.holdID, N: n})
+	}
+	return resp, nil
+}
+
+// Release releases a hold with a weight of n. It panics if the client holds
+// none.
+func (c *Client) Release(n int64) {
+	h, ok := c.holds.Take(n)
+	if !ok {
+		panic("grpcsem: bad release")
+	}
+	if err := c.invoke(context.Background(), "Release", &releaseRequest{holdID: h.ID}, &empty{}); err != nil {
+		c.error(fmt.Errorf("grpcsem: release: %w", err))
+	}
+}
+
+// Resize sets the size of the semaphore for every client of the server.
+func (c *Client) Resize(ctx context.Context, n int64) error {
+	if n < 0 {
+		panic("grpcsem: bad resize")
+	}
+	if err := c.invoke(ctx, "Resize", &resizeRequest{size: n}, &empty{}); err != nil {
+		return fmt.Errorf("grpcsem: resize: %w", err)
+	}
+	return nil
+}
+
+// Watch calls fn with the state of the semaphore, then with every change of
+// it, until ctx is done or the call fails, and returns ctx.Err() or the error
+// of the call.
+func (c *Client) Watch(ctx context.Context, fn func(State)) error {
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/Watch", grpc.ForceCodecV2(codec{}))
+	if err != nil {
+		return fmt.Errorf("grpcsem: watch: %w", err)
+	}
+	if err := stream.SendMsg(&empty{}); err != nil {
+		return fmt.Errorf("grpcsem: watch: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("grpcsem: watch: %w", err)
+	}
+	for {
+		var state State
+		if err := stream.RecvMsg(&state); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("grpcsem: watch: %w", err)
+		}
+		fn(state)
+	}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp message) error {
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, resp, grpc.ForceCodecV2(codec{}))
+}
+
+func (c *Client) error(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
@@ -0,0 +1,109 @@
+package grpcsem
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Client)(nil)
+
+// serve serves sem on an in-memory connection, and returns a client of it.
+func serve(t *testing.T, sem *semaphore.Weighted, opts ...Option) *Client {
+	l := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer(ServerCodec())
+	NewServer(sem, opts...).Register(srv)
+	go srv.Serve(l)
+	t.Cleanup(srv.Stop)
+
+	dial := func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }
+	cc, err := grpc.NewClient("passthrough:///bufconn", grpc.WithContextDialer(dial), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewClient(cc)
+}
+
+func TestMessages(t *testing.T) {
+	in := State{Size: 5, Current: -1, Waiters: 3}
+	var out State
+	if err := out.unmarshal(in.marshal()); err != nil || out != in {
+		t.Errorf("got %+v, %v; want %+v, nil", out, err, in)
+	}
+
+	// Fields unknown to a message are skipped.
+	b := (&acquireResponse{holdID: "h", acquired: true}).marshal()
+	var req releaseRequest
+	if err := req.unmarshal(b); err != nil || req.holdID != "h" {
+		t.Errorf("got %+v, %v; want hold h, nil", req, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	sem := semaphore.NewWeighted(3)
+	a, b := serve(t, sem), serve(t, sem)
+
+	tries := []bool{}
+	tries = append(tries, a.TryAcquire(2)) // true;  2/3
+	tries = append(tries, b.TryAcquire(2)) // false; shared with a
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	want := []bool{true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Acquire(ctx, 2) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	a.Release(2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if cur := sem.Current(); cur != 3 {
+		t.Errorf("got current %d, want 3", cur)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(tctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClientWatch(t *testing.T) {
+	sem := semaphore.NewWeighted(2)
+	c := serve(t, sem, WithWatchInterval(time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	states := make(chan State, 16)
+	go c.Watch(ctx, func(s State) { states <- s })
+
+	if s := <-states; s != (State{Size: 2}) {
+		t.Fatalf("got %+v, want the initial state", s)
+	}
+	if err := c.Resize(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-states; s.Size != 4 {
+		t.Errorf("got %+v, want size 4", s)
+	}
+	c.TryAcquire(1)
+	if s := <-states; s.Current != 1 {
+		t.Errorf("got %+v, want current 1", s)
+	}
+}
@@ -0,0 +1,214 @@
+package grpcsem
+
+import (
+	"google.golang.org/grpc/encoding"
+	protoenc "google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The messages of semaphore.proto are encoded by hand, so the package needs no
+// generated code; their encoding is the one of protobuf, so they interoperate
+// with generated code in any language.
+
+// message is a message of semaphore.proto.
+type message interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+type acquireRequest struct {
+	weight int64
+	wait   bool
+}
+
+func (m *acquireRequest) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.weight))
+	return appendVarint(b, 2, boolToVarint(m.wait))
+}
+
+func (m *acquireRequest) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, v uint64) {
+		switch num {
+		case 1:
+			m.weight = int64(v)
+		case 2:
+			m.wait = v != 0
+		}
+	}, nil)
+}
+
+type acquireResponse struct {
+	holdID   string
+	acquired bool
+}
+
+func (m *acquireResponse) marshal() []byte {
+	b := appendString(nil, 1, m.holdID)
+	return appendVarint(b, 2, boolToVarint(m.acquired))
+}
+
+func (m *acquireResponse) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, v uint64) {
+		if num == 2 {
+			m.acquired = v != 0
+		}
+	}, func(num protowire.Number, v []byte) {
+		if num == 1 {
+			m.holdID = string(v)
+		}
+	})
+}
+
+type releaseRequest struct {
+	holdID string
+}
+
+func (m *releaseRequest) marshal() []byte {
+	return appendString(nil, 1, m.holdID)
+}
+
+func (m *releaseRequest) unmarshal(b []byte) error {
+	return unmarshalFields(b, nil, func(num protowire.Number, v []byte) {
+		if num == 1 {
+			m.holdID = string(v)
+		}
+	})
+}
+
+type resizeRequest struct {
+	size int64
+}
+
+func (m *resizeRequest) marshal() []byte {
+	return appendVarint(nil, 1, uint64(m.size))
+}
+
+func (m *resizeRequest) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, v uint64) {
+		if num == 1 {
+			m.size = int64(v)
+		}
+	}, nil)
+}
+
+// empty is ReleaseResponse, ResizeResponse and WatchRequest.
+type empty struct{}
+
+func (m *empty) marshal() []byte          { return nil }
+func (m *empty) unmarshal(b []byte) error { return unmarshalFields(b, nil, nil) }
+
+// State is the state of a semaphore, streamed by Watch.
+type State struct {
+	Size    int64
+	Current int64
+	Waiters int
+}
+
+func (m *State) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.Size))
+	b = appendVarint(b, 2, uint64(m.Current))
+	return appendVarint(b, 3, uint64(m.Waiters))
+}
+
+func (m *State) unmarshal(b []byte) error {
+	return unmarshalFields(b, func(num protowire.Number, v uint64) {
+		switch num {
+		case 1:
+			m.Size = int64(v)
+		case 2:
+			m.Current = int64(v)
+		case 3:
+			m.Waiters = int(v)
+		}
+	}, nil)
+}
+
+// appendVarint appends a varint field, unless it has the default value, as
+// proto3 does.
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendString appends a string field, unless it is empty.
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func boolToVarint(v bool) uint64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// unmarshalFields calls varint or bytes, if not nil, with every field of b of
+// their wire type, and skips the others.
+func unmarshalFields(b []byte, varint func(protowire.Number, uint64), bytes func(protowire.Number, []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if varint != nil {
+				varint(num, v)
+			}
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if bytes != nil {
+				bytes(num, v)
+			}
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// codec encodes the messages of semaphore.proto, and hands any other to the
+// protobuf codec of gRPC, so it can be forced on a server serving other
+// services too.
+type codec struct{}
+
+func (codec) Name() string {
+	return protoenc.Name
+}
+
+func (codec) Marshal(v any) (mem.BufferSlice, error) {
+	if m, ok := v.(message); ok {
+		return mem.BufferSlice{mem.SliceBuffer(m.marshal())}, nil
+	}
+	return encoding.GetCodecV2(protoenc.Name).Marshal(v)
+}
+
+func (codec) Unmarshal(data mem.BufferSlice, v any) error {
+	if m, ok := v.(message); ok {
+		return m.unmarshal(data.Materialize())
+	}
+	return encoding.GetCodecV2(protoenc.Name).Unmarshal(data, v)
+}
@@ -0,0 +1,187 @@
+// Package grpcsem serves a semaphore.Weighted over gRPC, so services in any
+// language can share one semaphore, and provides a client for it satisfying
+// semaphore.AcquireReleaser.
+//
+// The service is described by semaphore.proto. Its messages are encoded by the
+// package itself, so servers need the codec set by ServerCodec, which also
+// encodes the messages of any other service of the server.
+//
+// Holds are tracked by ID on the server, so a client can't release more than it
+// acquired. A client that never releases its holds keeps them: bound the run
+// time of holders, e.g. with semaphore.WithMaxHold, if their clients may crash.
+package grpcsem
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+const serviceName = "semaphore.v1.Semaphore"
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithWatchInterval sets how often Watch checks the semaphore for changes of
+// its usage; changes of its size are streamed at once. The default is 100
+// milliseconds.
+func WithWatchInterval(d time.Duration) Option {
+	if d <= 0 {
+		panic("grpcsem: bad watch interval")
+	}
+	return func(s *Server) {
+		s.interval = d
+	}
+}
+
+// Server serves a semaphore.Weighted to the clients of a gRPC server.
+type Server struct {
+	sem      *semaphore.Weighted
+	interval time.Duration
+	mu       sync.Mutex
+	holds    map[string]int64 // Weight by hold ID.
+}
+
+// NewServer creates a new Server serving sem.
+func NewServer(sem *semaphore.Weighted, opts ...Option) *Server {
+	s := &Server{sem: sem, interval: 100 * time.Millisecond, holds: make(map[string]int64)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ServerCodec returns the option of the gRPC servers that Register is called
+// on.
+func ServerCodec() grpc.ServerOption {
+	return grpc.ForceServerCodecV2(codec{})
+}
+
+// Register registers the service on r, a gRPC server created with
+// ServerCodec.
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	r.RegisterService(&serviceDesc, s)
+}
+
+func (s *Server) acquire(ctx context.Context, req *acquireRequest) (*acquireResponse, error) {
+	if req.weight < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative weight")
+	}
+	if !req.wait {
+		if !s.sem.TryAcquire(req.weight) {
+			return &acquireResponse{}, nil
+		}
+	} else if err := s.sem.Acquire(ctx, req.weight); err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	} else if ctx.Err() != nil {
+		// The client gave up, and would never learn of the hold.
+		s.sem.Release(req.weight)
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	id := rand.Text()
+	s.mu.Lock()
+	s.holds[id] = req.weight
+	s.mu.Unlock()
+	return &acquireResponse{holdID: id, acquired: true}, nil
+}
+
+func (s *Server) release(ctx context.Context, req *releaseRequest) (*empty, error) {
+	s.mu.Lock()
+	n, ok := s.holds[req.holdID]
+	delete(s.holds, req.holdID)
+	s.mu.Unlock()
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown hold")
+	}
+	s.sem.Release(n)
+	return &empty{}, nil
+}
+
+func (s *Server) resize(ctx context.Context, req *resizeRequest) (*empty, error) {
+	if req.size < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative size")
+	}
+	s.sem.Resize(req.size)
+	return &empty{}, nil
+}
+
+// watch sends the state of the semaphore, then every change of it, until the
+// call ends.
+func (s *Server) watch(stream grpc.ServerStream) error {
+	resized, stop := s.sem.SubscribeResize()
+	defer stop()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	var last State
+	for sent := false; ; {
+		st := s.sem.Stats()
+		state := State{Size: st.Size, Current: st.Current, Waiters: st.Waiters}
+		if !sent || state != last {
+			if err := stream.SendMsg(&state); err != nil {
+				return err
+			}
+			last, sent = state, true
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-ticker.C:
+		case <-resized:
+		}
+	}
+}
+
+// unary returns the description of the unary method name, served by fn.
+func unary[Req any, Resp any](name string, fn func(*Server, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req any) (any, error) {
+				return fn(srv.(*Server), ctx, req.(*Req))
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + name}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		unary("Acquire", (*Server).acquire),
+		unary("Release", (*Server).release),
+		unary("Resize", (*Server).resize),
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Watch",
+		ServerStreams: true,
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			if err := stream.RecvMsg(&empty{}); err != nil {
+				return err
+			}
+			return srv.(*Server).watch(stream)
+		},
+	}},
+	Metadata: "semaphore.proto",
+}
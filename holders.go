@@ -0,0 +1,133 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HoldInfo describes a hold of a semaphore tracked WithHolderTracking.
+type HoldInfo struct {
+	Weight   int64
+	Label    string // The identity of the acquiring caller; see Identity.
+	Acquired time.Time
+	Stack    string // Where it was acquired, if stacks are captured.
+}
+
+// holderTracking records the holds of a semaphore created WithHolderTracking.
+type holderTracking struct {
+	stacks bool
+	holds  []*trackedHold // Oldest first.
+}
+
+type trackedHold struct {
+	info     HoldInfo
+	pcs      []uintptr
+	reported bool // Whether the watchdog reported it.
+}
+
+// maxStackDepth is the number of frames captured for a hold.
+const maxStackDepth = 32
+
+// WithHolderTracking makes the semaphore record every hold, with the identity
+// of its caller and, if stacks, the stack it was acquired from, for finding out
+// who holds the capacity of a wedged service; see Holders. It is a debug mode:
+// every acquisition pays for the record, and for capturing the stack.
+//
+// Holds are labelled with the identity of the caller of the acquiring context,
+// so ContextWithCaller labels them; TryAcquire has no context, so its holds are
+// unlabelled. Holds acquired through AcquireChan are not tracked.
+//
+// Releases are by weight, not by holder, so a release of a weight of n is
+// taken to end the newest hold of that weight, or else the newest holds, which
+// keeps holds that are never released, the old ones, listed.
+func WithHolderTracking(stacks bool) Option {
+	return func(s *Weighted) {
+		s.holders = &holderTracking{stacks: stacks}
+	}
+}
+
+// Holders returns the holds of a semaphore created WithHolderTracking, oldest
+// first, or nil for any other semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Holders() []HoldInfo {
+	s.lock()
+	if s.holders == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	// Releases change the weight of holds, so they are copied under s.mu;
+	// their stacks never change, and are formatted after.
+	infos := make([]HoldInfo, len(s.holders.holds))
+	stacks := make([][]uintptr, len(s.holders.holds))
+	for i, h := range s.holders.holds {
+		infos[i], stacks[i] = h.info, h.pcs
+	}
+	s.mu.Unlock()
+
+	for i, pcs := range stacks {
+		if pcs != nil {
+			infos[i].Stack = formatStack(pcs)
+		}
+	}
+	return infos
+}
+
+// trackHolder records a hold of a weight of n acquired by the caller of ctx.
+func (s *Weighted) trackHolder(ctx context.Context, n int64) {
+	h := &trackedHold{info: HoldInfo{Weight: n, Label: s.Identity(ctx), Acquired: time.Now()}}
+	if s.holders.stacks {
+		pcs := make([]uintptr, maxStackDepth)
+		h.pcs = pcs[:runtime.Callers(1, pcs)]
+	}
+	s.lock()
+	s.holders.holds = append(s.holders.holds, h)
+	s.armWatchdog()
+	s.mu.Unlock()
+}
+
+// untrackHolder accounts for a release of a weight of n in the recorded holds.
+// Must be called with s.mu held.
+func (s *Weighted) untrackHolder(n int64) {
+	t := s.holders
+	for i := len(t.holds) - 1; i >= 0; i-- {
+		if t.holds[i].info.Weight == n {
+			t.holds = append(t.holds[:i], t.holds[i+1:]...)
+			return
+		}
+	}
+	for i := len(t.holds) - 1; i >= 0 && n > 0; i-- {
+		h := t.holds[i]
+		if h.info.Weight > n {
+			h.info.Weight -= n
+			return
+		}
+		n -= h.info.Weight
+		t.holds = t.holds[:i]
+	}
+}
+
+// formatStack formats a captured stack like a goroutine's in a panic, without
+// the frames of the semaphore's own methods.
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") && !strings.Contains(f.Function, "semaphore.(*Weighted).") {
+			b.WriteString(f.Function)
+			b.WriteString("\n\t")
+			b.WriteString(f.File)
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(f.Line))
+			b.WriteByte('\n')
+		}
+		if !more {
+			return b.String()
+		}
+	}
+}
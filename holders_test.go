@@ -0,0 +1,78 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWeightedHolders(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(10, WithHolderTracking(true))
+	ctx := ContextWithCaller(context.Background(), "leaky-handler")
+
+	// A handler that forgets to release.
+	leak := func() {
+		if err := sem.Acquire(ctx, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leak()
+	sem.TryAcquire(2)
+	sem.TryAcquire(3)
+	sem.Release(2) // Ends the newest hold of a weight of 2.
+
+	holders := sem.Holders()
+	if len(holders) != 2 {
+		t.Fatalf("got %d holders, want 2", len(holders))
+	}
+	h := holders[0]
+	if h.Weight != 2 || h.Label != "leaky-handler" {
+		t.Errorf("got hold %d of %q, want 2 of %q", h.Weight, h.Label, "leaky-handler")
+	}
+	if !strings.Contains(h.Stack, "TestWeightedHolders.func1") {
+		t.Errorf("got stack\n%s\nwant the leaking function in it", h.Stack)
+	}
+	if strings.Contains(h.Stack, "(*Weighted)") {
+		t.Errorf("got stack\n%s\nwant the semaphore's frames left out", h.Stack)
+	}
+	if holders[1].Weight != 3 || holders[1].Label != "" {
+		t.Errorf("got hold %d of %q, want an unlabelled 3", holders[1].Weight, holders[1].Label)
+	}
+
+	// A release matching no hold ends the newest holds.
+	sem.Release(4)
+	if holders := sem.Holders(); len(holders) != 1 || holders[0].Weight != 1 {
+		t.Errorf("got holders %+v, want a weight of 1 left", holders)
+	}
+
+	if NewWeighted(1).Holders() != nil {
+		t.Error("got holders of an untracked semaphore")
+	}
+}
+
+func TestWeightedHoldersConcurrentRelease(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(100, WithHolderTracking(false))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			sem.TryAcquire(3)
+			sem.Release(1) // Shrinks the hold in place.
+			sem.Release(2)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			sem.Holders()
+		}
+	}
+}
@@ -0,0 +1,67 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "time"
+
+// Hooks are callbacks on the events of a semaphore, for plugging in a logging
+// or metrics system of any kind. Any of them may be nil.
+//
+// Hooks run synchronously on the goroutine of the Acquire or Release call,
+// never under the semaphore's lock, so they must be fast. The end of a wait
+// started by AcquireChan is reported on the goroutine of the queue callbacks
+// instead.
+type Hooks struct {
+	// OnAcquire is called when a weight of n is acquired, after waiting for
+	// waited, which is 0 if the acquisition didn't block.
+	OnAcquire func(n int64, waited time.Duration)
+	// OnRelease is called when a weight of n is released.
+	OnRelease func(n int64)
+	// OnWaitStart is called when an acquisition of a weight of n blocks.
+	OnWaitStart func(n int64)
+	// OnCancel is called when a blocked acquisition of a weight of n ends
+	// without acquiring, because its context was done or the semaphore failed
+	// it.
+	OnCancel func(n int64)
+}
+
+// WithHooks sets the hooks of the semaphore. Without them, the semaphore
+// checks for them at no allocation.
+func WithHooks(h Hooks) Option {
+	return func(s *Weighted) {
+		s.hooks = &h
+	}
+}
+
+// hookAcquire calls the OnAcquire hook, if any.
+func (s *Weighted) hookAcquire(n int64, waited time.Duration) {
+	if s.hooks != nil && s.hooks.OnAcquire != nil {
+		s.hooks.OnAcquire(n, waited)
+	}
+}
+
+// hookRelease calls the OnRelease hook, if any.
+func (s *Weighted) hookRelease(n int64) {
+	if s.hooks != nil && s.hooks.OnRelease != nil {
+		s.hooks.OnRelease(n)
+	}
+}
+
+// hookWaitStart calls the OnWaitStart hook, if any.
+func (s *Weighted) hookWaitStart(n int64) {
+	if s.hooks != nil && s.hooks.OnWaitStart != nil {
+		s.hooks.OnWaitStart(n)
+	}
+}
+
+// hookWaitEnd calls the OnAcquire or OnCancel hook for a wait that started at
+// start and ended with granted and err, if any.
+func (s *Weighted) hookWaitEnd(n int64, start time.Time, granted int64, err error) {
+	if err != nil {
+		if s.hooks.OnCancel != nil {
+			s.hooks.OnCancel(n)
+		}
+		return
+	}
+	s.hookAcquire(granted, time.Since(start))
+}
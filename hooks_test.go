@@ -0,0 +1,106 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWeightedHooks(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var events []string
+	record := func(format string, args ...interface{}) {
+		mu.Lock()
+		events = append(events, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}
+	sem := NewWeighted(2, WithHooks(Hooks{
+		OnAcquire: func(n int64, waited time.Duration) {
+			record("acquire %d blocked=%t", n, waited > 0)
+		},
+		OnRelease:   func(n int64) { record("release %d", n) },
+		OnWaitStart: func(n int64) { record("wait %d", n) },
+		OnCancel:    func(n int64) { record("cancel %d", n) },
+	}))
+
+	ctx := context.Background()
+	sem.Acquire(ctx, 2)
+	canceled, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() { done <- sem.Acquire(canceled, 1) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Resize(3)
+	<-done
+	sem.Release(1)
+	sem.TryAcquire(1)
+
+	want := []string{
+		"acquire 2 blocked=false",
+		"wait 1",
+		"cancel 1",
+		"wait 1",
+		"acquire 1 blocked=true",
+		"release 1",
+		"acquire 1 blocked=false",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("got events %q, want %q", events, want)
+	}
+}
+
+func TestWeightedHooksAcquireChan(t *testing.T) {
+	t.Parallel()
+
+	ended := make(chan string, 2)
+	sem := NewWeighted(1, WithHooks(Hooks{
+		OnAcquire: func(n int64, waited time.Duration) {
+			if waited > 0 {
+				ended <- "acquire"
+			}
+		},
+		OnCancel: func(n int64) { ended <- "cancel" },
+	}))
+	sem.Acquire(context.Background(), 1)
+
+	_, cancel := sem.AcquireChan(1)
+	cancel()
+	if got := <-ended; got != "cancel" {
+		t.Errorf("got %s, want cancel", got)
+	}
+	acquired, _ := sem.AcquireChan(1)
+	sem.Release(1)
+	<-acquired
+	if got := <-ended; got != "acquire" {
+		t.Errorf("got %s, want acquire", got)
+	}
+}
+
+func TestWeightedHooksZeroAlloc(t *testing.T) {
+	sem := NewWeighted(1, WithHooks(Hooks{
+		OnAcquire: func(int64, time.Duration) {},
+		OnRelease: func(int64) {},
+	}))
+	allocs := testing.AllocsPerRun(100, func() {
+		sem.TryAcquire(1)
+		sem.Release(1)
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs per TryAcquire and Release, want 0", allocs)
+	}
+}
@@ -0,0 +1,103 @@
+// Package httplimit bounds the concurrent in-flight requests of an HTTP
+// handler with a semaphore.Weighted.
+package httplimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+// Option configures Middleware.
+type Option func(*limiter)
+
+type limiter struct {
+	sem        *semaphore.Weighted
+	weight     func(*http.Request) int64
+	maxWait    time.Duration
+	retryAfter time.Duration
+	rejected   http.Handler
+}
+
+// WithMaxWait bounds how long a request waits for its weight before it is
+// rejected. By default, requests wait until they are canceled.
+func WithMaxWait(d time.Duration) Option {
+	if d <= 0 {
+		panic("httplimit: bad max wait")
+	}
+	return func(l *limiter) {
+		l.maxWait = d
+	}
+}
+
+// WithRetryAfter sets the Retry-After header of rejected requests to d,
+// rounded up to whole seconds. By default, rejections have no Retry-After.
+func WithRetryAfter(d time.Duration) Option {
+	if d <= 0 {
+		panic("httplimit: bad retry after")
+	}
+	return func(l *limiter) {
+		l.retryAfter = d
+	}
+}
+
+// WithRejectHandler serves rejected requests with h instead of a plain 503
+// Service Unavailable. Retry-After is set before h is called.
+func WithRejectHandler(h http.Handler) Option {
+	return func(l *limiter) {
+		l.rejected = h
+	}
+}
+
+// Middleware returns HTTP middleware that acquires a weight of weight(r) from
+// sem for every request r, and releases it once the handler returns. If weight
+// is nil, every request has a weight of 1.
+//
+// Requests that can't acquire their weight, because they waited for longer
+// than WithMaxWait allows, were canceled, or sem refused them, are rejected
+// with 503 Service Unavailable. Admitted requests carry a semaphore.Token in
+// their context, see semaphore.TokenFromContext, so code further down can tell
+// they were already admitted by sem.
+func Middleware(sem *semaphore.Weighted, weight func(*http.Request) int64, opts ...Option) func(http.Handler) http.Handler {
+	l := &limiter{sem: sem, weight: weight}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.weight == nil {
+		l.weight = func(*http.Request) int64 { return 1 }
+	}
+	if l.rejected == nil {
+		l.rejected = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := l.weight(r)
+			if err := l.acquire(r.Context(), n); err != nil {
+				if l.retryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(l.retryAfter.Seconds()))))
+				}
+				l.rejected.ServeHTTP(w, r)
+				return
+			}
+			tok := semaphore.NewToken(l.sem, n)
+			defer tok.Release()
+			next.ServeHTTP(w, r.WithContext(semaphore.ContextWithToken(r.Context(), tok)))
+		})
+	}
+}
+
+func (l *limiter) acquire(ctx context.Context, n int64) error {
+	if l.maxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.maxWait)
+		defer cancel()
+	}
+	return l.sem.Acquire(ctx, n)
+}
@@ -0,0 +1,66 @@
+package httplimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+func TestMiddleware(t *testing.T) {
+	sem := semaphore.NewWeighted(2)
+	weight := func(r *http.Request) int64 {
+		if r.URL.Path == "/heavy" {
+			return 2
+		}
+		return 1
+	}
+
+	var admitted bool
+	h := Middleware(sem, weight, WithMaxWait(10*time.Millisecond), WithRetryAfter(1500*time.Millisecond))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, admitted = semaphore.TokenFromContext(r.Context(), sem)
+			if cur := sem.Current(); cur != weight(r) {
+				t.Errorf("got %d in flight, want %d", cur, weight(r))
+			}
+		}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/heavy", nil))
+	if rec.Code != http.StatusOK || !admitted {
+		t.Errorf("got status %d, admitted %t; want 200 and true", rec.Code, admitted)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got %d in flight after the request, want 0", cur)
+	}
+
+	// With the semaphore full, requests time out and are rejected.
+	sem.Acquire(t.Context(), 2)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("got Retry-After %q, want 2", got)
+	}
+}
+
+func TestMiddlewareRejectHandler(t *testing.T) {
+	sem := semaphore.NewWeighted(0)
+	reject := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	h := Middleware(sem, nil, WithMaxWait(time.Millisecond), WithRejectHandler(reject))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("request was admitted")
+		}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want 429", rec.Code)
+	}
+}
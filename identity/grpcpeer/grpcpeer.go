@@ -0,0 +1,18 @@
+// Package grpcpeer identifies the callers of a semaphore by their gRPC peer.
+package grpcpeer
+
+import (
+	"context"
+
+	"google.golang.org/grpc/peer"
+)
+
+// Identity is a semaphore.IdentityFunc returning the network address of the
+// gRPC peer of ctx, or "" outside of a gRPC call.
+func Identity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
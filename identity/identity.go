@@ -0,0 +1,25 @@
+// Package identity provides ways to identify the callers of a semaphore, for
+// use with semaphore.WithIdentity, semaphore.WithCallerLimit and
+// semaphore.FairShare.
+package identity
+
+import (
+	"net/http"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+// HeaderMiddleware returns HTTP middleware that identifies every request by the
+// value of the given header, e.g. "X-Tenant-ID", storing it with
+// semaphore.ContextWithCaller so the default semaphore.CallerIdentity finds it.
+// Requests without the header are left unidentified.
+func HeaderMiddleware(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id := r.Header.Get(header); id != "" {
+				r = r.WithContext(semaphore.ContextWithCaller(r.Context(), id))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package identity
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+func TestHeaderMiddleware(t *testing.T) {
+	var got string
+	h := HeaderMiddleware("X-Tenant-ID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = semaphore.CallerIdentity(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Tenant-ID", "acme")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got != "acme" {
+		t.Errorf("got identity %q, want acme", got)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if got != "" {
+		t.Errorf("got identity %q for a request without the header", got)
+	}
+}
@@ -0,0 +1,252 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Instrumentation is where semaphores and the helpers of this package report
+// logs, metrics and traces, so an observability stack is wired once for all of
+// them; see SetInstrumentation and WithInstrumentation.
+//
+// Metrics are named "semaphore.<event>". Those of a Weighted carry its name as
+// the "semaphore" attribute:
+//
+//	semaphore.acquires      counter, admitted acquisitions
+//	semaphore.releases      counter, releases, with their "reason" if given
+//	semaphore.rejections    counter, Acquire calls refused by state or a full queue
+//	semaphore.cancellations counter, Acquire calls that gave up waiting
+//	semaphore.wait          distribution, seconds blocked Acquire calls waited,
+//	                        with exemplars; see ExemplarObserver
+//	semaphore.expirations   counter, weight returned by WithMaxHold
+//
+// The helpers report through the instrumentation of the Weighted they are
+// built on, or the one set by SetInstrumentation:
+//
+//	semaphore.fairshare.acquires       counter, per "tenant"
+//	semaphore.fairshare.cancellations  counter, per "tenant"
+//	semaphore.class.acquires           counter, per "class"
+//	semaphore.class.cancellations      counter, per "class"
+//	semaphore.vector.acquires          counter
+//	semaphore.vector.cancellations     counter
+//	semaphore.gate.opens               counter
+//	semaphore.gate.closes              counter
+//	semaphore.resources.acquires       counter
+//	semaphore.resources.failures       counter
+//	semaphore.dedup.calls              counter, with whether "shared"
+//	semaphore.cost.hold                distribution, seconds, per "label"
+//	semaphore.lease.expirations        counter
+//	semaphore.slo.enforcements         counter, with "resize" and "active"
+//
+// Blocked Acquire calls of a Weighted are traced as "semaphore.wait" spans.
+//
+// One semaphore has one instrumentation; MultiInstrumentation combines
+// several.
+//
+// Implementations must be safe for concurrent use and must not call back into
+// the semaphore.
+type Instrumentation interface {
+	// Logger returns the logger for diagnostics, or nil to disable them.
+	Logger() *slog.Logger
+	// Count adds delta to the named counter.
+	Count(name string, delta int64, attrs ...slog.Attr)
+	// Observe records a value of the named distribution.
+	Observe(name string, value float64, attrs ...slog.Attr)
+	// StartSpan starts a span of the named operation in ctx, returning a func
+	// that ends it with the operation's error.
+	StartSpan(ctx context.Context, name string, attrs ...slog.Attr) (end func(err error))
+}
+
+// ExemplarObserver is implemented by instrumentations that attach exemplars,
+// such as trace IDs, to the values of distributions. When the instrumentation
+// is one, a Weighted observes waits through it with the context of the waiting
+// Acquire call, so an integration can link a wait-time spike to the trace of an
+// affected request.
+type ExemplarObserver interface {
+	// ObserveContext records a value of the named distribution, observed in
+	// ctx.
+	ObserveContext(ctx context.Context, name string, value float64, attrs ...slog.Attr)
+}
+
+type instrumentationHolder struct{ Instrumentation }
+
+var globalInstrumentation atomic.Value // instrumentationHolder
+
+// SetInstrumentation sets the instrumentation of every semaphore and helper
+// that wasn't given one WithInstrumentation, including those already created.
+// A nil inst disables instrumentation, which is the default.
+func SetInstrumentation(inst Instrumentation) {
+	globalInstrumentation.Store(instrumentationHolder{inst})
+}
+
+// currentInstrumentation returns the instrumentation set by
+// SetInstrumentation, or nil.
+func currentInstrumentation() Instrumentation {
+	h, _ := globalInstrumentation.Load().(instrumentationHolder)
+	return h.Instrumentation
+}
+
+// instrumentationOf returns the instrumentation of sem if it is a Weighted, or
+// the one set by SetInstrumentation.
+func instrumentationOf(sem interface{}) Instrumentation {
+	if s, ok := sem.(*Weighted); ok {
+		return s.instrumentation()
+	}
+	return currentInstrumentation()
+}
+
+// observe records a value of the named distribution of inst, observed in ctx,
+// with an exemplar if inst is an ExemplarObserver.
+func observe(ctx context.Context, inst Instrumentation, name string, value float64, attrs ...slog.Attr) {
+	if o, ok := inst.(ExemplarObserver); ok {
+		o.ObserveContext(ctx, name, value, attrs...)
+		return
+	}
+	inst.Observe(name, value, attrs...)
+}
+
+// MultiInstrumentation returns an Instrumentation reporting to each of insts,
+// so logs, metrics and traces can go to different integrations, such as
+// otel.NewInstrumentation for spans and prometheus.NewInstrumentation for
+// wait histograms. Nil insts are skipped.
+//
+// It is an ExemplarObserver, observing in ctx through each of insts that is
+// one. Logger returns the first non-nil logger of insts. StartSpan starts a
+// span in each of insts, returning nil if none of them did.
+func MultiInstrumentation(insts ...Instrumentation) Instrumentation {
+	var m multiInstrumentation
+	for _, inst := range insts {
+		if inst != nil {
+			m = append(m, inst)
+		}
+	}
+	return m
+}
+
+type multiInstrumentation []Instrumentation
+
+func (m multiInstrumentation) Logger() *slog.Logger {
+	for _, inst := range m {
+		if l := inst.Logger(); l != nil {
+			return l
+		}
+	}
+	return nil
+}
+
+func (m multiInstrumentation) Count(name string, delta int64, attrs ...slog.Attr) {
+	for _, inst := range m {
+		inst.Count(name, delta, attrs...)
+	}
+}
+
+func (m multiInstrumentation) Observe(name string, value float64, attrs ...slog.Attr) {
+	for _, inst := range m {
+		inst.Observe(name, value, attrs...)
+	}
+}
+
+func (m multiInstrumentation) ObserveContext(ctx context.Context, name string, value float64, attrs ...slog.Attr) {
+	for _, inst := range m {
+		observe(ctx, inst, name, value, attrs...)
+	}
+}
+
+func (m multiInstrumentation) StartSpan(ctx context.Context, name string, attrs ...slog.Attr) func(err error) {
+	var ends []func(error)
+	for _, inst := range m {
+		if end := inst.StartSpan(ctx, name, attrs...); end != nil {
+			ends = append(ends, end)
+		}
+	}
+	if ends == nil {
+		return nil
+	}
+	return func(err error) {
+		for _, end := range ends {
+			end(err)
+		}
+	}
+}
+
+// report adds delta to the named counter of inst, unless inst is nil.
+func report(inst Instrumentation, name string, delta int64, attrs ...slog.Attr) {
+	if inst != nil {
+		inst.Count(name, delta, attrs...)
+	}
+}
+
+// WithInstrumentation sets the instrumentation of the semaphore, and of the
+// helpers built on it, in place of the one set by SetInstrumentation.
+func WithInstrumentation(inst Instrumentation) Option {
+	return func(s *Weighted) {
+		s.inst = inst
+	}
+}
+
+// WithSampler selects which blocked Acquire calls have their wait observed
+// and traced by the instrumentation. Counters are always counted.
+func WithSampler(sampler *Sampler) Option {
+	return func(s *Weighted) {
+		s.sampler = sampler
+	}
+}
+
+// instrumentation returns the instrumentation of the semaphore, or nil.
+func (s *Weighted) instrumentation() Instrumentation {
+	if s.inst != nil {
+		return s.inst
+	}
+	return currentInstrumentation()
+}
+
+// count adds delta to the named counter of the semaphore, if instrumented.
+func (s *Weighted) count(name string, delta int64) {
+	if inst := s.instrumentation(); inst != nil {
+		inst.Count(name, delta, slog.String("semaphore", s.name))
+	}
+}
+
+// countRelease counts a release for reason, if instrumented.
+func (s *Weighted) countRelease(reason string) {
+	inst := s.instrumentation()
+	if inst == nil {
+		return
+	}
+	if reason == "" {
+		inst.Count("semaphore.releases", 1, slog.String("semaphore", s.name))
+		return
+	}
+	inst.Count("semaphore.releases", 1, slog.String("semaphore", s.name), slog.String("reason", reason))
+}
+
+// startWait starts instrumenting a blocked Acquire call for a weight of n,
+// returning a func that counts its outcome and, if sampled, traces it and
+// records its wait. Returns nil if not instrumented.
+func (s *Weighted) startWait(ctx context.Context, n int64) func(err error) {
+	inst := s.instrumentation()
+	if inst == nil {
+		return nil
+	}
+	name := slog.String("semaphore", s.name)
+	var end func(error)
+	if s.sampler.Sample() {
+		end = inst.StartSpan(ctx, "semaphore.wait", name, slog.Int64("weight", n))
+	}
+	start := time.Now()
+	return func(err error) {
+		if err != nil {
+			inst.Count("semaphore.cancellations", 1, name)
+		} else {
+			inst.Count("semaphore.acquires", 1, name)
+		}
+		if end != nil {
+			observe(ctx, inst, "semaphore.wait", time.Since(start).Seconds(), name)
+			end(err)
+		}
+	}
+}
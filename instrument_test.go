@@ -0,0 +1,305 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingInstrumentation records counters, observations and spans. If only
+// is set, it ignores the events of other semaphores, so it can be installed
+// globally while other tests run.
+type recordingInstrumentation struct {
+	logger   *slog.Logger
+	only     string
+	mu       sync.Mutex
+	counts   map[string]int64
+	reasons  map[string]int64
+	observed map[string]int
+	spans    []string
+}
+
+func newRecordingInstrumentation(logger *slog.Logger, only string) *recordingInstrumentation {
+	return &recordingInstrumentation{
+		logger:   logger,
+		only:     only,
+		counts:   make(map[string]int64),
+		reasons:  make(map[string]int64),
+		observed: make(map[string]int),
+	}
+}
+
+func (r *recordingInstrumentation) ignores(attrs []slog.Attr) bool {
+	if r.only == "" {
+		return false
+	}
+	for _, a := range attrs {
+		if a.Key == "semaphore" {
+			return a.Value.String() != r.only
+		}
+	}
+	return true
+}
+
+func (r *recordingInstrumentation) Logger() *slog.Logger { return r.logger }
+
+func (r *recordingInstrumentation) Count(name string, delta int64, attrs ...slog.Attr) {
+	if r.ignores(attrs) {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[name] += delta
+	for _, a := range attrs {
+		if a.Key == "reason" {
+			r.reasons[a.Value.String()] += delta
+		}
+	}
+}
+
+func (r *recordingInstrumentation) Observe(name string, value float64, attrs ...slog.Attr) {
+	if r.ignores(attrs) {
+		return
+	}
+	r.mu.Lock()
+	r.observed[name]++
+	r.mu.Unlock()
+}
+
+func (r *recordingInstrumentation) StartSpan(ctx context.Context, name string, attrs ...slog.Attr) func(error) {
+	if r.ignores(attrs) {
+		return func(error) {}
+	}
+	return func(err error) {
+		r.mu.Lock()
+		r.spans = append(r.spans, name+": "+errString(err))
+		r.mu.Unlock()
+	}
+}
+
+func (r *recordingInstrumentation) count(name string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[name]
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return err.Error()
+}
+
+// waitUntil polls cond, failing the test if it doesn't hold within a second.
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWeightedInstrumentation(t *testing.T) {
+	t.Parallel()
+
+	inst := newRecordingInstrumentation(nil, "")
+	sem := NewWeighted(1, WithInstrumentation(inst), WithPreallocatedWaiters(1))
+	ctx := context.Background()
+
+	sem.Acquire(ctx, 1)
+	done := make(chan error)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	waitUntil(t, func() bool { return sem.Waiters() == 1 })
+	if err := sem.Acquire(ctx, 1); err != ErrQueueFull {
+		t.Fatalf("got %v, want ErrQueueFull", err)
+	}
+	sem.ReleaseWithReason(1, "success")
+	<-done
+
+	tctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	sem.Acquire(tctx, 1)
+	sem.ReleaseWithReason(1, "error")
+
+	tries := []struct {
+		name string
+		want int64
+	}{
+		{"semaphore.acquires", 2},
+		{"semaphore.releases", 2},
+		{"semaphore.rejections", 1},
+		{"semaphore.cancellations", 1},
+	}
+	for i, try := range tries {
+		if got := inst.count(try.name); got != try.want {
+			t.Errorf("tries[%d]: %s = %d, want %d", i, try.name, got, try.want)
+		}
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.reasons["success"] != 1 || inst.reasons["error"] != 1 {
+		t.Errorf("got release reasons %v, want success and error once each", inst.reasons)
+	}
+	if inst.observed["semaphore.wait"] != 2 {
+		t.Errorf("observed %d waits, want 2", inst.observed["semaphore.wait"])
+	}
+	want := []string{"semaphore.wait: ok", "semaphore.wait: context deadline exceeded"}
+	if strings.Join(inst.spans, ", ") != strings.Join(want, ", ") {
+		t.Errorf("got spans %q, want %q", inst.spans, want)
+	}
+}
+
+func TestWeightedInstrumentationSampler(t *testing.T) {
+	t.Parallel()
+
+	inst := newRecordingInstrumentation(nil, "")
+	sem := NewWeighted(1, WithInstrumentation(inst), WithSampler(NewSampler(2)))
+	ctx := context.Background()
+	sem.Acquire(ctx, 1)
+
+	for i := 0; i < 4; i++ {
+		tctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+		sem.Acquire(tctx, 1)
+		cancel()
+	}
+
+	if got := inst.count("semaphore.cancellations"); got != 4 {
+		t.Errorf("counted %d cancellations, want 4", got)
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.observed["semaphore.wait"] != 2 || len(inst.spans) != 2 {
+		t.Errorf("sampled %d waits and %d spans, want 2 and 2", inst.observed["semaphore.wait"], len(inst.spans))
+	}
+}
+
+func TestHelpersUseSemaphoreInstrumentation(t *testing.T) {
+	t.Parallel()
+
+	inst := newRecordingInstrumentation(nil, "")
+	sem := NewWeighted(2, WithInstrumentation(inst))
+	ctx := context.Background()
+
+	f := NewFairShare(sem, 0)
+	f.Acquire(ctx, "a", 1)
+	f.Release("a", 1)
+
+	NewDedup(sem).Do(ctx, "k", 1, func(context.Context) (interface{}, error) { return nil, nil })
+
+	release, _ := NewCostEstimator(sem, 0.5, time.Millisecond).Acquire(ctx, "q")
+	release()
+
+	m := NewLeaseManager(sem, nil)
+	m.Acquire(ctx, 1, time.Millisecond)
+	waitUntil(t, func() bool { return inst.count("semaphore.lease.expirations") == 1 })
+
+	tries := []string{"semaphore.fairshare.acquires", "semaphore.dedup.calls"}
+	for i, name := range tries {
+		if got := inst.count(name); got != 1 {
+			t.Errorf("tries[%d]: %s = %d, want 1", i, name, got)
+		}
+	}
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.observed["semaphore.cost.hold"] != 1 {
+		t.Errorf("observed %d cost holds, want 1", inst.observed["semaphore.cost.hold"])
+	}
+}
+
+func TestSetInstrumentation(t *testing.T) {
+	var out syncBuffer
+	inst := newRecordingInstrumentation(slog.New(slog.NewTextHandler(&out, nil)), "global")
+	SetInstrumentation(inst)
+	t.Cleanup(func() { SetInstrumentation(nil) })
+
+	// Semaphores without instrumentation of their own use the global one,
+	// including its logger for utilization warnings.
+	sem := NewWeighted(1, WithName("global"), WithUtilizationWarning(nil, 1, 0, time.Hour))
+	sem.Acquire(context.Background(), 1)
+	if got := inst.count("semaphore.acquires"); got != 1 {
+		t.Errorf("global instrumentation counted %d acquires, want 1", got)
+	}
+	waitUntil(t, func() bool { return strings.Contains(out.String(), "sustained high utilization") })
+	sem.Release(1)
+
+	own := newRecordingInstrumentation(nil, "")
+	NewWeighted(1, WithName("global"), WithInstrumentation(own)).TryAcquire(1)
+	if got := inst.count("semaphore.acquires"); got != 1 {
+		t.Errorf("semaphore with its own instrumentation reported globally")
+	}
+
+	SetInstrumentation(nil)
+	sem.TryAcquire(1)
+	if got := inst.count("semaphore.acquires"); got != 1 {
+		t.Errorf("instrumentation reported after being unset")
+	}
+}
+
+type traceKey struct{}
+
+// exemplarInstrumentation records the trace carried by the context of every
+// observation.
+type exemplarInstrumentation struct {
+	*recordingInstrumentation
+	exemplars chan string
+}
+
+func (e exemplarInstrumentation) ObserveContext(ctx context.Context, name string, value float64, attrs ...slog.Attr) {
+	e.Observe(name, value, attrs...)
+	trace, _ := ctx.Value(traceKey{}).(string)
+	e.exemplars <- trace
+}
+
+func TestWeightedInstrumentationExemplars(t *testing.T) {
+	t.Parallel()
+
+	inst := exemplarInstrumentation{newRecordingInstrumentation(nil, ""), make(chan string, 1)}
+	sem := NewWeighted(1, WithInstrumentation(inst))
+	sem.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), traceKey{}, "trace-1"), time.Millisecond)
+	defer cancel()
+	sem.Acquire(ctx, 1)
+	if trace := <-inst.exemplars; trace != "trace-1" {
+		t.Errorf("got exemplar %q, want %q", trace, "trace-1")
+	}
+}
+
+func TestMultiInstrumentation(t *testing.T) {
+	t.Parallel()
+
+	rec := newRecordingInstrumentation(nil, "")
+	ex := exemplarInstrumentation{newRecordingInstrumentation(nil, ""), make(chan string, 1)}
+	sem := NewWeighted(1, WithInstrumentation(MultiInstrumentation(nil, rec, ex)))
+	sem.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), traceKey{}, "trace-1"), time.Millisecond)
+	defer cancel()
+	sem.Acquire(ctx, 1)
+	if trace := <-ex.exemplars; trace != "trace-1" {
+		t.Errorf("got exemplar %q, want %q", trace, "trace-1")
+	}
+	for i, r := range []*recordingInstrumentation{rec, ex.recordingInstrumentation} {
+		r.mu.Lock()
+		if r.counts["semaphore.acquires"] != 1 || r.counts["semaphore.cancellations"] != 1 {
+			t.Errorf("tries[%d]: got counts %v, want 1 acquire and 1 cancellation", i, r.counts)
+		}
+		if len(r.spans) != 1 {
+			t.Errorf("tries[%d]: got spans %v, want 1", i, r.spans)
+		}
+		r.mu.Unlock()
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.observed["semaphore.wait"] != 1 {
+		t.Errorf("got %d waits observed, want 1", rec.observed["semaphore.wait"])
+	}
+}
@@ -0,0 +1,38 @@
+package semaphore
+
+import "context"
+
+// Acquirer is the acquiring side of a semaphore.
+type Acquirer interface {
+	Acquire(ctx context.Context, n int64) error
+	TryAcquire(n int64) bool
+}
+
+// Releaser is the releasing side of a semaphore.
+type Releaser interface {
+	Release(n int64)
+}
+
+// Resizer is a semaphore whose size can be read and changed.
+type Resizer interface {
+	Size() int64
+	Resize(n int64)
+}
+
+// AcquireReleaser groups Acquirer and Releaser. It is what the helpers of this
+// package acquire through, so they can be given a test double instead of a
+// Weighted.
+type AcquireReleaser interface {
+	Acquirer
+	Releaser
+}
+
+// AcquireReleaseResizer groups Acquirer, Releaser and Resizer, for the helpers
+// that also read or adapt the size.
+type AcquireReleaseResizer interface {
+	Acquirer
+	Releaser
+	Resizer
+}
+
+var _ AcquireReleaseResizer = (*Weighted)(nil)
@@ -0,0 +1,37 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+)
+
+// countingDouble is a test double admitting everything and counting calls.
+type countingDouble struct {
+	acquires, releases int
+}
+
+func (d *countingDouble) Acquire(ctx context.Context, n int64) error { d.acquires++; return nil }
+func (d *countingDouble) TryAcquire(n int64) bool                    { d.acquires++; return true }
+func (d *countingDouble) Release(n int64)                            { d.releases++ }
+
+func TestHelpersAcceptDoubles(t *testing.T) {
+	t.Parallel()
+
+	d := &countingDouble{}
+	ctx := context.Background()
+
+	if _, _, err := NewDedup(d).Do(ctx, "k", 1, func(context.Context) (interface{}, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	c := NewComposite(d, 1)
+	if err := c.Acquire(ctx, "k", 1); err != nil {
+		t.Fatal(err)
+	}
+	c.Release("k", 1)
+
+	if d.acquires != 2 || d.releases != 2 {
+		t.Errorf("double saw %d acquires and %d releases, want 2 and 2", d.acquires, d.releases)
+	}
+}
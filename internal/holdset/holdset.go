@@ -0,0 +1,60 @@
+// Package holdset tracks the holds a process has on a distributed semaphore,
+// so that the backends can offer Release(n) like semaphore.Weighted: holds of
+// equal weight are interchangeable, and releasing a weight of n gives up any
+// hold of that weight.
+package holdset
+
+import "sync"
+
+// Hold is a hold on a distributed semaphore, identified by the backend.
+type Hold struct {
+	ID string
+	N  int64
+}
+
+// Set is a set of holds. The zero value is an empty set.
+type Set struct {
+	mu    sync.Mutex
+	holds []Hold // Oldest first.
+}
+
+// Add adds a hold to the set.
+func (s *Set) Add(h Hold) {
+	s.mu.Lock()
+	s.holds = append(s.holds, h)
+	s.mu.Unlock()
+}
+
+// Take removes the oldest hold of weight n from the set and returns it.
+func (s *Set) Take(n int64) (Hold, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range s.holds {
+		if h.N == n {
+			s.holds = append(s.holds[:i], s.holds[i+1:]...)
+			return h, true
+		}
+	}
+	return Hold{}, false
+}
+
+// Remove removes the hold with the given ID from the set, reporting whether it
+// was there.
+func (s *Set) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, h := range s.holds {
+		if h.ID == id {
+			s.holds = append(s.holds[:i], s.holds[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// All returns the holds of the set, oldest first.
+func (s *Set) All() []Hold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Hold(nil), s.holds...)
+}
@@ -0,0 +1,23 @@
+package holdset
+
+import "testing"
+
+func TestSet(t *testing.T) {
+	var s Set
+	s.Add(Hold{ID: "a", N: 1})
+	s.Add(Hold{ID: "b", N: 2})
+	s.Add(Hold{ID: "c", N: 1})
+
+	if h, ok := s.Take(1); !ok || h.ID != "a" {
+		t.Errorf("got %+v, %t; want the oldest hold of weight 1", h, ok)
+	}
+	if _, ok := s.Take(3); ok {
+		t.Error("took a hold of a weight never added")
+	}
+	if !s.Remove("b") || s.Remove("b") {
+		t.Error("Remove didn't remove b exactly once")
+	}
+	if all := s.All(); len(all) != 1 || all[0].ID != "c" {
+		t.Errorf("got %+v, want only c", all)
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"io"
+)
+
+// LimitedCopy copies from src to dst like io.Copy, in chunks of at most chunk
+// bytes, holding a weight of one per byte from sem for each chunk while it is
+// read and written. With sem sized in bytes, it bounds the memory used by all
+// the copies sharing it.
+//
+// LimitedCopy stops when ctx is done, returning the bytes copied so far and
+// ctx.Err().
+func LimitedCopy(ctx context.Context, dst io.Writer, src io.Reader, sem AcquireReleaser, chunk int64) (int64, error) {
+	if chunk <= 0 {
+		panic("semaphore: bad chunk size")
+	}
+	buf := make([]byte, chunk)
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		if err := sem.Acquire(ctx, chunk); err != nil {
+			return written, err
+		}
+		nr, rerr := src.Read(buf)
+		var werr error
+		if nr > 0 {
+			var nw int
+			nw, werr = dst.Write(buf[:nr])
+			written += int64(nw)
+			if werr == nil && nw < nr {
+				werr = io.ErrShortWrite
+			}
+		}
+		sem.Release(chunk)
+
+		switch {
+		case werr != nil:
+			return written, werr
+		case rerr == io.EOF:
+			return written, nil
+		case rerr != nil:
+			return written, rerr
+		}
+	}
+}
+
+// LimitedReader is an io.Reader that holds a weight of one per byte from a
+// semaphore while reading, for at most a chunk at a time.
+type LimitedReader struct {
+	ctx   context.Context
+	r     io.Reader
+	sem   AcquireReleaser
+	chunk int64
+}
+
+// NewLimitedReader returns a LimitedReader reading from r in chunks of at most
+// chunk bytes, acquiring their weight from sem with ctx.
+func NewLimitedReader(ctx context.Context, r io.Reader, sem AcquireReleaser, chunk int64) *LimitedReader {
+	if chunk <= 0 {
+		panic("semaphore: bad chunk size")
+	}
+	return &LimitedReader{ctx: ctx, r: r, sem: sem, chunk: chunk}
+}
+
+// Read reads up to a chunk into p once its weight is acquired. If the weight
+// can't be acquired, Read returns 0 and the error of the acquisition.
+func (r *LimitedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return r.r.Read(p)
+	}
+	n := min(int64(len(p)), r.chunk)
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := r.sem.Acquire(r.ctx, n); err != nil {
+		return 0, err
+	}
+	defer r.sem.Release(n)
+	return r.r.Read(p[:n])
+}
+
+// LimitedWriter is an io.Writer that holds a weight of one per byte from a
+// semaphore while writing, for at most a chunk at a time.
+type LimitedWriter struct {
+	ctx   context.Context
+	w     io.Writer
+	sem   AcquireReleaser
+	chunk int64
+}
+
+// NewLimitedWriter returns a LimitedWriter writing to w in chunks of at most
+// chunk bytes, acquiring their weight from sem with ctx.
+func NewLimitedWriter(ctx context.Context, w io.Writer, sem AcquireReleaser, chunk int64) *LimitedWriter {
+	if chunk <= 0 {
+		panic("semaphore: bad chunk size")
+	}
+	return &LimitedWriter{ctx: ctx, w: w, sem: sem, chunk: chunk}
+}
+
+// Write writes p a chunk at a time, acquiring the weight of each chunk before
+// writing it. If a weight can't be acquired, Write returns the bytes written
+// so far and the error of the acquisition.
+func (w *LimitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := min(int64(len(p)-written), w.chunk)
+		if err := w.ctx.Err(); err != nil {
+			return written, err
+		}
+		if err := w.sem.Acquire(w.ctx, n); err != nil {
+			return written, err
+		}
+		nw, err := w.w.Write(p[written : written+int(n)])
+		w.sem.Release(n)
+		written += nw
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
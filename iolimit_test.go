@@ -0,0 +1,76 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// peakWriter records the weight held on sem whenever it is written to.
+type peakWriter struct {
+	bytes.Buffer
+	sem  *Weighted
+	peak int64
+}
+
+func (w *peakWriter) Write(p []byte) (int, error) {
+	w.peak = max(w.peak, w.sem.Current())
+	return w.Buffer.Write(p)
+}
+
+func TestLimitedCopy(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(8)
+	dst := &peakWriter{sem: sem}
+	src := strings.Repeat("semaphore", 10)
+
+	n, err := LimitedCopy(context.Background(), dst, strings.NewReader(src), sem, 4)
+	if err != nil || n != int64(len(src)) {
+		t.Fatalf("got %d, %v; want %d, nil", n, err, len(src))
+	}
+	if dst.String() != src {
+		t.Errorf("got %q, want %q", dst.String(), src)
+	}
+	if dst.peak != 4 {
+		t.Errorf("got peak weight %d, want 4", dst.peak)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := LimitedCopy(ctx, io.Discard, strings.NewReader(src), sem, 4); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestLimitedReaderWriter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(3)
+	dst := &peakWriter{sem: sem}
+	src := "read and written three bytes at a time"
+
+	w := NewLimitedWriter(ctx, dst, sem, 3)
+	if n, err := w.Write([]byte(src)); err != nil || n != len(src) {
+		t.Fatalf("got %d, %v; want %d, nil", n, err, len(src))
+	}
+	if dst.peak != 3 {
+		t.Errorf("got peak weight %d, want 3", dst.peak)
+	}
+
+	got, err := io.ReadAll(NewLimitedReader(ctx, &dst.Buffer, sem, 3))
+	if err != nil || string(got) != src {
+		t.Errorf("got %q, %v; want %q, nil", got, err, src)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
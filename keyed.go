@@ -0,0 +1,178 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyedWeighted is a collection of semaphores, one per key (e.g. per host or
+// per tenant), created on first use with a shared size and options.
+//
+// A key's semaphore is evicted once it has had no holders or waiters for the
+// idle duration, so a KeyedWeighted over an unbounded key space stays bounded
+// by the keys in recent use. Unlike Composite, keys are not limited together.
+type KeyedWeighted[K comparable] struct {
+	size int64
+	idle time.Duration
+	opts []Option
+
+	mu      sync.Mutex
+	keys    map[K]*keyedEntry
+	swept   time.Time
+	created int64
+	evicted int64
+}
+
+type keyedEntry struct {
+	sem  *Weighted
+	refs int       // Acquisitions in progress.
+	used time.Time // Last time the key was acquired or released.
+}
+
+// KeyedStats aggregates the state of every key of a KeyedWeighted.
+type KeyedStats struct {
+	Keys    int   // Keys currently in the collection.
+	Current int64 // Weight held across all keys.
+	Waiters int   // Waiters across all keys.
+	Created int64 // Keys created since creation, including evicted ones.
+	Evicted int64 // Keys evicted since creation.
+}
+
+// NewKeyedWeighted creates a new KeyedWeighted whose keys get semaphores of
+// the given size, configured with opts, that are evicted after being idle for
+// the idle duration. An idle duration of zero evicts keys as soon as they are
+// unused.
+func NewKeyedWeighted[K comparable](size int64, idle time.Duration, opts ...Option) *KeyedWeighted[K] {
+	if idle < 0 {
+		panic("semaphore: bad idle duration")
+	}
+	return &KeyedWeighted[K]{size: size, idle: idle, opts: opts, keys: make(map[K]*keyedEntry)}
+}
+
+// Acquire acquires a weight of n for key, blocking until the key's semaphore
+// has the resources available or ctx is done. On success, returns nil. On
+// failure, returns the error of the key's semaphore and leaves it unchanged.
+func (k *KeyedWeighted[K]) Acquire(ctx context.Context, key K, n int64) error {
+	e := k.ref(key)
+	err := e.sem.Acquire(ctx, n)
+	k.unref(key, e)
+	return err
+}
+
+// TryAcquire acquires a weight of n for key without blocking. On success,
+// returns true. On failure, returns false and leaves the key's semaphore
+// unchanged.
+func (k *KeyedWeighted[K]) TryAcquire(key K, n int64) bool {
+	e := k.ref(key)
+	success := e.sem.TryAcquire(n)
+	k.unref(key, e)
+	return success
+}
+
+// Release releases a weight of n for key.
+func (k *KeyedWeighted[K]) Release(key K, n int64) {
+	k.mu.Lock()
+	e, ok := k.keys[key]
+	k.mu.Unlock()
+	if !ok {
+		panic("semaphore: bad release")
+	}
+	e.sem.Release(n)
+
+	k.mu.Lock()
+	e.used = time.Now()
+	k.evictIdle(key, e, e.used)
+	k.mu.Unlock()
+}
+
+// Key returns the semaphore of key, if the collection has one. Acquiring it
+// directly bypasses idle tracking, so it may be evicted while held.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (k *KeyedWeighted[K]) Key(key K) (*Weighted, bool) {
+	k.mu.Lock()
+	e, ok := k.keys[key]
+	k.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return e.sem, true
+}
+
+// Len returns the number of keys in the collection.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (k *KeyedWeighted[K]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.keys)
+}
+
+// Stats returns the state of every key summed together, and the number of
+// keys created and evicted.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (k *KeyedWeighted[K]) Stats() KeyedStats {
+	k.mu.Lock()
+	stats := KeyedStats{Keys: len(k.keys), Created: k.created, Evicted: k.evicted}
+	sems := make([]*Weighted, 0, len(k.keys))
+	for _, e := range k.keys {
+		sems = append(sems, e.sem)
+	}
+	k.mu.Unlock()
+
+	for _, sem := range sems {
+		snap := sem.Snapshot()
+		stats.Current += snap.Current
+		stats.Waiters += snap.Waiters
+	}
+	return stats
+}
+
+// ref returns the entry of key, creating it if needed, and marks it in use so
+// that it isn't evicted. Keys idle for longer than k.idle are swept at most
+// once per idle duration.
+func (k *KeyedWeighted[K]) ref(key K) *keyedEntry {
+	now := time.Now()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.idle > 0 && now.Sub(k.swept) >= k.idle {
+		for key, e := range k.keys {
+			k.evictIdle(key, e, now)
+		}
+		k.swept = now
+	}
+
+	e, ok := k.keys[key]
+	if !ok {
+		e = &keyedEntry{sem: NewWeighted(k.size, k.opts...)}
+		k.keys[key] = e
+		k.created++
+	}
+	e.refs++
+	return e
+}
+
+// unref drops the in-progress reference taken by ref.
+func (k *KeyedWeighted[K]) unref(key K, e *keyedEntry) {
+	k.mu.Lock()
+	e.refs--
+	e.used = time.Now()
+	k.evictIdle(key, e, e.used)
+	k.mu.Unlock()
+}
+
+// evictIdle removes e from the collection if nobody holds, waits on or is
+// acquiring it and it has been unused for k.idle as of now. Must be called
+// with k.mu held.
+func (k *KeyedWeighted[K]) evictIdle(key K, e *keyedEntry, now time.Time) {
+	if e.refs > 0 || now.Sub(e.used) < k.idle || k.keys[key] != e {
+		return
+	}
+	// With no acquisition in progress, weight can only be released meanwhile.
+	if snap := e.sem.Snapshot(); snap.Current > 0 || snap.Waiters > 0 {
+		return
+	}
+	delete(k.keys, key)
+	k.evicted++
+}
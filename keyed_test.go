@@ -0,0 +1,87 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKeyedWeighted(t *testing.T) {
+	t.Parallel()
+
+	k := NewKeyedWeighted[string](2, 0)
+
+	tries := []bool{}
+	tries = append(tries, k.TryAcquire("a", 2)) // true;  a = 2/2
+	tries = append(tries, k.TryAcquire("a", 1)) // false; a is full
+	tries = append(tries, k.TryAcquire("b", 1)) // true;  b = 1/2, keys don't share
+	tries = append(tries, k.TryAcquire("c", 3)) // false; c can never fit
+
+	want := []bool{true, false, true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	if got := k.Stats(); got != (KeyedStats{Keys: 2, Current: 3, Created: 3, Evicted: 1}) {
+		t.Errorf("got stats %+v", got)
+	}
+
+	// A waiter keeps its key alive.
+	done := make(chan error)
+	go func() { done <- k.Acquire(context.Background(), "a", 1) }()
+	sem, _ := k.Key("a")
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	k.Release("a", 2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if _, ok := k.Key("a"); !ok {
+		t.Fatal("held key was evicted")
+	}
+
+	k.Release("a", 1)
+	k.Release("b", 1)
+	if got := k.Len(); got != 0 {
+		t.Errorf("got %d keys, want 0", got)
+	}
+}
+
+func TestKeyedWeightedIdle(t *testing.T) {
+	t.Parallel()
+
+	k := NewKeyedWeighted[int](1, 20*time.Millisecond)
+
+	if !k.TryAcquire(1, 1) {
+		t.Fatal("TryAcquire failed")
+	}
+	k.Release(1, 1)
+	if _, ok := k.Key(1); !ok {
+		t.Fatal("key was evicted before being idle")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	k.TryAcquire(2, 1) // Triggers a sweep.
+	if _, ok := k.Key(1); ok {
+		t.Error("idle key was not evicted")
+	}
+	if _, ok := k.Key(2); !ok {
+		t.Error("key in use was evicted")
+	}
+}
+
+func TestKeyedWeightedRelease(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("releasing an unknown key didn't panic")
+		}
+	}()
+	NewKeyedWeighted[string](1, 0).Release("a", 1)
+}
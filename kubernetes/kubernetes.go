@@ -0,0 +1,402 @@
+// Package kubernetes implements a weighted semaphore shared by many pods,
+// stored in a ConfigMap through the Kubernetes API server, for bounding the
+// concurrency of a Deployment's pods cluster-wide without other
+// infrastructure, e.g. to run at most 10 migrations at once.
+//
+// Every acquisition is an entry of the ConfigMap with an expiry: the pod
+// renews the expiry of its holds in the background, and holds that expire,
+// because their pod crashed or was partitioned from the API server, are
+// deleted by the next update. Every update is a compare-and-swap on the
+// ConfigMap's resource version, retried on conflict, so concurrent pods never
+// overwrite each other's holds; a renewal that finds a hold gone reports it
+// lost rather than recreating it. Admission is not FIFO, as blocked
+// acquisitions poll.
+//
+// Expiries are set with the clock of the pod, like the renew times of
+// coordination.k8s.io Leases, so the clocks of the nodes must agree to well
+// within the ttl of holds.
+package kubernetes
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore/internal/holdset"
+)
+
+// ErrConflict is returned by Client.Update when the ConfigMap changed since
+// its resource version was read.
+var ErrConflict = errors.New("kubernetes: conflict")
+
+// Client reads and writes the data of a ConfigMap. It is satisfied by a small
+// adapter of any Kubernetes client, e.g. for k8s.io/client-go:
+//
+//	type adapter struct{ v1.ConfigMapInterface }
+//
+//	func (a adapter) Get(ctx context.Context, name string) (map[string]string, string, error) {
+//		cm, err := a.ConfigMapInterface.Get(ctx, name, metav1.GetOptions{})
+//		if apierrors.IsNotFound(err) {
+//			return nil, "", nil
+//		}
+//		if err != nil {
+//			return nil, "", err
+//		}
+//		return cm.Data, cm.ResourceVersion, nil
+//	}
+//
+//	func (a adapter) Update(ctx context.Context, name string, data map[string]string, version string) error {
+//		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: version}, Data: data}
+//		var err error
+//		if version == "" {
+//			_, err = a.Create(ctx, cm, metav1.CreateOptions{})
+//		} else {
+//			_, err = a.ConfigMapInterface.Update(ctx, cm, metav1.UpdateOptions{})
+//		}
+//		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+//			return kubernetes.ErrConflict
+//		}
+//		return err
+//	}
+type Client interface {
+	// Get returns the data and resource version of the ConfigMap, or a nil
+	// map and an empty version if it doesn't exist.
+	Get(ctx context.Context, name string) (data map[string]string, version string, err error)
+
+	// Update replaces the data of the ConfigMap if its resource version is
+	// still version, or creates it if version is empty, and otherwise
+	// returns ErrConflict.
+	Update(ctx context.Context, name string, data map[string]string, version string) error
+}
+
+// Option configures a Semaphore.
+type Option func(*Semaphore)
+
+// WithTTL sets how long holds last unless renewed, every third of it. The
+// default is 30 seconds.
+func WithTTL(d time.Duration) Option {
+	if d < time.Millisecond {
+		panic("kubernetes: bad ttl")
+	}
+	return func(s *Semaphore) {
+		s.ttl = d
+	}
+}
+
+// WithPollInterval sets how often a blocked Acquire retries. The default is
+// one second, to spare the API server.
+func WithPollInterval(d time.Duration) Option {
+	if d <= 0 {
+		panic("kubernetes: bad poll interval")
+	}
+	return func(s *Semaphore) {
+		s.poll = d
+	}
+}
+
+// WithErrorHandler sets a function called with the errors of the calls that
+// can't return them: TryAcquire, Release, Resize and renewals. By default,
+// they are dropped.
+func WithErrorHandler(fn func(error)) Option {
+	return func(s *Semaphore) {
+		s.onError = fn
+	}
+}
+
+// WithOnLost sets a function called with the weight of every hold that
+// expired before it could be renewed, so its weight may already be held by
+// another pod.
+func WithOnLost(fn func(n int64)) Option {
+	return func(s *Semaphore) {
+		s.onLost = fn
+	}
+}
+
+// Semaphore is a weighted semaphore stored in a ConfigMap. Every pod sharing
+// it creates its own Semaphore with the same ConfigMap name.
+type Semaphore struct {
+	client  Client
+	name    string
+	size    int64
+	ttl     time.Duration
+	poll    time.Duration
+	onError func(error)
+	onLost  func(n int64)
+	holds   holdset.Set
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// New creates a new Semaphore stored in the ConfigMap name, with the given
+// size unless one was set by Resize. The ConfigMap is created by the first
+// acquisition if it doesn't exist.
+func New(client Client, name string, size int64, opts ...Option) *Semaphore {
+	s := &Semaphore{
+		client: client,
+		name:   name,
+		size:   size,
+		ttl:    30 * time.Second,
+		poll:   time.Second,
+		stop:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	go s.renew()
+	return s
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() or the error of the client, and leaves the semaphore unchanged.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	for {
+		ok, err := s.tryAcquire(ctx, n)
+		switch {
+		case ok:
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return err
+		}
+
+		timer := time.NewTimer(s.poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including an error of the client,
+// returns false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	ok, err := s.tryAcquire(context.Background(), n)
+	if err != nil {
+		s.error(err)
+	}
+	return ok
+}
+
+func (s *Semaphore) tryAcquire(ctx context.Context, n int64) (bool, error) {
+	id := holdPrefix + rand.Text()
+	admitted := false
+	err := s.update(ctx, func(data map[string]string, now time.Time) bool {
+		size := s.size
+		if v, err := strconv.ParseInt(data[sizeKey], 10, 64); err == nil {
+			size = v
+		}
+		admitted = used(data)+n <= size
+		if admitted {
+			data[id] = formatHold(n, now.Add(s.ttl))
+		}
+		return admitted
+	})
+	if err != nil {
+		return false, fmt.Errorf("kubernetes: acquire: %w", err)
+	}
+	if admitted {
+		s.holds.Add(holdset.Hold{ID: id, N: n})
+	}
+	return admitted, nil
+}
+
+// Release releases a hold with a weight of n. It panics if the pod holds
+// none.
+func (s *Semaphore) Release(n int64) {
+	h, ok := s.holds.Take(n)
+	if !ok {
+		panic("kubernetes: bad release")
+	}
+	err := s.update(context.Background(), func(data map[string]string, now time.Time) bool {
+		_, ok := data[h.ID]
+		delete(data, h.ID)
+		return ok
+	})
+	if err != nil {
+		s.error(fmt.Errorf("kubernetes: release: %w", err))
+	}
+}
+
+// Resize sets the size of the semaphore for every pod sharing it.
+func (s *Semaphore) Resize(n int64) {
+	if n < 0 {
+		panic("kubernetes: bad resize")
+	}
+	err := s.update(context.Background(), func(data map[string]string, now time.Time) bool {
+		data[sizeKey] = strconv.FormatInt(n, 10)
+		return true
+	})
+	if err != nil {
+		s.error(fmt.Errorf("kubernetes: resize: %w", err))
+	}
+}
+
+// Size returns the size of the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Size(ctx context.Context) (int64, error) {
+	data, _, err := s.client.Get(ctx, s.name)
+	if err != nil {
+		return 0, fmt.Errorf("kubernetes: %w", err)
+	}
+	if v, err := strconv.ParseInt(data[sizeKey], 10, 64); err == nil {
+		return v, nil
+	}
+	return s.size, nil
+}
+
+// Current returns the weight held by every pod sharing the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Current(ctx context.Context) (int64, error) {
+	data, _, err := s.client.Get(ctx, s.name)
+	if err != nil {
+		return 0, fmt.Errorf("kubernetes: %w", err)
+	}
+	data = clone(data)
+	purge(data, time.Now())
+	return used(data), nil
+}
+
+// Close stops renewing the holds of the pod, which then expire unless they
+// are released.
+func (s *Semaphore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// renew renews the holds of the pod every third of their ttl, until Close,
+// in a single update.
+func (s *Semaphore) renew() {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		holds := s.holds.All()
+		if len(holds) == 0 {
+			continue
+		}
+		var gone []holdset.Hold
+		err := s.update(context.Background(), func(data map[string]string, now time.Time) bool {
+			gone = gone[:0]
+			for _, h := range holds {
+				if _, ok := data[h.ID]; !ok {
+					gone = append(gone, h)
+					continue
+				}
+				data[h.ID] = formatHold(h.N, now.Add(s.ttl))
+			}
+			return len(gone) < len(holds)
+		})
+		if err != nil {
+			s.error(fmt.Errorf("kubernetes: renew: %w", err))
+			continue
+		}
+		for _, h := range gone {
+			// A hold released meanwhile is gone too, but isn't lost.
+			if s.holds.Remove(h.ID) && s.onLost != nil {
+				s.onLost(h.N)
+			}
+		}
+	}
+}
+
+// update applies fn to the data of the ConfigMap, with expired holds purged,
+// and writes it back if fn or the purge changed it, retrying on conflict.
+func (s *Semaphore) update(ctx context.Context, fn func(data map[string]string, now time.Time) bool) error {
+	for {
+		data, version, err := s.client.Get(ctx, s.name)
+		if err != nil {
+			return err
+		}
+		data, now := clone(data), time.Now()
+		purged := purge(data, now)
+		if !fn(data, now) && !purged {
+			return nil
+		}
+		err = s.client.Update(ctx, s.name, data, version)
+		if err != ErrConflict {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Semaphore) error(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// The ConfigMap holds the size set by Resize under sizeKey, and every hold
+// under holdPrefix and its ID, as its weight and the Unix time of its expiry
+// in milliseconds.
+const (
+	sizeKey    = "size"
+	holdPrefix = "hold."
+)
+
+func formatHold(n int64, expires time.Time) string {
+	return strconv.FormatInt(n, 10) + "/" + strconv.FormatInt(expires.UnixMilli(), 10)
+}
+
+// parseHold returns the weight and the expiry of a hold, or ok false if v is
+// malformed.
+func parseHold(v string) (n int64, expires time.Time, ok bool) {
+	weight, expiry, found := strings.Cut(v, "/")
+	n, err1 := strconv.ParseInt(weight, 10, 64)
+	ms, err2 := strconv.ParseInt(expiry, 10, 64)
+	if !found || err1 != nil || err2 != nil {
+		return 0, time.Time{}, false
+	}
+	return n, time.UnixMilli(ms), true
+}
+
+// purge deletes the holds of data expired at now, and malformed ones, and
+// reports whether there were any.
+func purge(data map[string]string, now time.Time) bool {
+	purged := false
+	for k, v := range data {
+		if !strings.HasPrefix(k, holdPrefix) {
+			continue
+		}
+		if _, expires, ok := parseHold(v); !ok || !expires.After(now) {
+			delete(data, k)
+			purged = true
+		}
+	}
+	return purged
+}
+
+// used returns the weight of the holds of data.
+func used(data map[string]string) int64 {
+	sum := int64(0)
+	for k, v := range data {
+		if n, _, ok := parseHold(v); ok && strings.HasPrefix(k, holdPrefix) {
+			sum += n
+		}
+	}
+	return sum
+}
+
+func clone(data map[string]string) map[string]string {
+	c := make(map[string]string, len(data)+1)
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
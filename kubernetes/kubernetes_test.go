@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Semaphore)(nil)
+
+// fakeClient stores a single ConfigMap in memory, with the optimistic
+// concurrency of the API server.
+type fakeClient struct {
+	mu      sync.Mutex
+	data    map[string]string
+	version int
+}
+
+func (c *fakeClient) Get(ctx context.Context, name string) (map[string]string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version == 0 {
+		return nil, "", nil
+	}
+	return maps.Clone(c.data), strconv.Itoa(c.version), nil
+}
+
+func (c *fakeClient) Update(ctx context.Context, name string, data map[string]string, version string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if (version == "" && c.version != 0) || (version != "" && version != strconv.Itoa(c.version)) {
+		return ErrConflict
+	}
+	c.data = maps.Clone(data)
+	c.version++
+	return nil
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	c := &fakeClient{}
+	a := New(c, "migrations", 3, WithPollInterval(time.Millisecond))
+	defer a.Close()
+	b := New(c, "migrations", 3, WithPollInterval(time.Millisecond))
+	defer b.Close()
+
+	tries := []bool{}
+	tries = append(tries, a.TryAcquire(2)) // true;  2/3
+	tries = append(tries, b.TryAcquire(2)) // false; shared with a
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	want := []bool{true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Acquire(ctx, 2) }()
+	time.Sleep(5 * time.Millisecond)
+	a.Release(2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if cur, err := a.Current(ctx); err != nil || cur != 3 {
+		t.Errorf("got current %d, %v; want 3, nil", cur, err)
+	}
+
+	a.Resize(5)
+	if size, err := b.Size(ctx); err != nil || size != 5 {
+		t.Errorf("got size %d, %v; want 5, nil", size, err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(tctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSemaphoreConflicts(t *testing.T) {
+	ctx := context.Background()
+	c := &fakeClient{}
+
+	// Pods racing to update the ConfigMap never overwrite each other's holds.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := New(c, "migrations", 8)
+			defer s.Close()
+			if !s.TryAcquire(1) {
+				t.Error("TryAcquire failed")
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := New(c, "migrations", 8)
+	defer s.Close()
+	if cur, _ := s.Current(ctx); cur != 8 {
+		t.Errorf("got current %d, want 8", cur)
+	}
+}
+
+func TestSemaphoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := &fakeClient{}
+	ttl := 30 * time.Millisecond
+
+	// The holds of a live pod are renewed.
+	live := New(c, "migrations", 1, WithTTL(ttl))
+	defer live.Close()
+	if !live.TryAcquire(1) {
+		t.Fatal("TryAcquire failed")
+	}
+	time.Sleep(3 * ttl)
+	if cur, _ := live.Current(ctx); cur != 1 {
+		t.Fatalf("got current %d, want the renewed hold", cur)
+	}
+	live.Release(1)
+
+	// Those of a crashed one expire, and are reported lost if it comes back.
+	lost := make(chan int64, 1)
+	crashed := New(c, "migrations", 1, WithTTL(ttl), WithOnLost(func(n int64) { lost <- n }))
+	defer crashed.Close()
+	if !crashed.TryAcquire(1) {
+		t.Fatal("TryAcquire failed")
+	}
+	c.mu.Lock()
+	for k, v := range c.data {
+		if n, _, ok := parseHold(v); ok {
+			c.data[k] = formatHold(n, time.Now())
+		}
+	}
+	c.mu.Unlock()
+	if !live.TryAcquire(1) {
+		t.Error("expired hold was not reclaimed")
+	}
+	if n := <-lost; n != 1 {
+		t.Errorf("got lost weight %d, want 1", n)
+	}
+}
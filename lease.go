@@ -0,0 +1,198 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLeaseEnded is returned by Renew of a lease that was released or expired.
+var ErrLeaseEnded = errors.New("semaphore: lease released or expired")
+
+// LeaseManager grants time-limited holds on a Weighted. A lease that is not
+// renewed before its TTL runs out is released automatically, so a wedged
+// holder can't keep the capacity forever.
+type LeaseManager struct {
+	sem      AcquireReleaser
+	onExpire func(*Lease)
+	mu       sync.Mutex
+	active   int
+}
+
+// Lease is a hold on a weight of a LeaseManager's semaphore.
+type Lease struct {
+	m        *LeaseManager
+	n        int64
+	ttl      time.Duration
+	mu       sync.Mutex
+	timer    *time.Timer
+	expires  time.Time
+	done     bool
+	expired  chan struct{} // Closed when the lease expires.
+	onExpire func(*Lease)
+}
+
+// NewLeaseManager creates a new LeaseManager granting leases on sem. If
+// onExpire is not nil, it is called in its own goroutine for every lease that
+// expires.
+func NewLeaseManager(sem AcquireReleaser, onExpire func(*Lease)) *LeaseManager {
+	return &LeaseManager{sem: sem, onExpire: onExpire}
+}
+
+// Acquire acquires a lease with a weight of n and the given ttl, blocking until
+// resources are available or ctx is done. On success, returns the lease. On
+// failure, returns ctx.Err() and leaves the semaphore unchanged.
+func (m *LeaseManager) Acquire(ctx context.Context, n int64, ttl time.Duration) (*Lease, error) {
+	if ttl <= 0 {
+		panic("semaphore: bad lease ttl")
+	}
+	if err := m.sem.Acquire(ctx, n); err != nil {
+		return nil, err
+	}
+	return m.grant(n, ttl), nil
+}
+
+// AcquireLease acquires a lease on s with a weight of n and the given ttl,
+// blocking until resources are available or ctx is done: the weight returns to
+// s once the lease expires, unless it is renewed before. It is a shorthand for
+// the Acquire of a LeaseManager of s without expiry callback; set one on the
+// lease with OnExpire.
+func (s *Weighted) AcquireLease(ctx context.Context, n int64, ttl time.Duration) (*Lease, error) {
+	return NewLeaseManager(s, nil).Acquire(ctx, n, ttl)
+}
+
+// TryAcquire acquires a lease with a weight of n and the given ttl without
+// blocking. On success, returns the lease and true. On failure, returns false
+// and leaves the semaphore unchanged.
+func (m *LeaseManager) TryAcquire(n int64, ttl time.Duration) (*Lease, bool) {
+	if ttl <= 0 {
+		panic("semaphore: bad lease ttl")
+	}
+	if !m.sem.TryAcquire(n) {
+		return nil, false
+	}
+	return m.grant(n, ttl), true
+}
+
+// Active returns the number of leases that are neither released nor expired.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (m *LeaseManager) Active() int {
+	m.mu.Lock()
+	active := m.active
+	m.mu.Unlock()
+	return active
+}
+
+func (m *LeaseManager) grant(n int64, ttl time.Duration) *Lease {
+	l := &Lease{m: m, n: n, ttl: ttl, expired: make(chan struct{})}
+	m.mu.Lock()
+	m.active++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	l.expires = time.Now().Add(ttl)
+	l.timer = time.AfterFunc(ttl, l.expire)
+	l.mu.Unlock()
+	return l
+}
+
+// Weight returns the weight held by the lease.
+func (l *Lease) Weight() int64 {
+	return l.n
+}
+
+// Deadline returns the time at which the lease expires unless renewed.
+func (l *Lease) Deadline() time.Time {
+	l.mu.Lock()
+	expires := l.expires
+	l.mu.Unlock()
+	return expires
+}
+
+// Expired returns a channel that is closed when the lease expires. Holders can
+// select on it to notice that their capacity was taken back.
+func (l *Lease) Expired() <-chan struct{} {
+	return l.expired
+}
+
+// OnExpire sets fn to be called in its own goroutine when the lease expires,
+// besides the callback of its LeaseManager. If the lease already expired, fn
+// is called at once; if it was released, never.
+func (l *Lease) OnExpire(fn func(*Lease)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.expired:
+		go fn(l)
+	default:
+		l.onExpire = fn
+	}
+}
+
+// Renew extends the lease by its ttl from now. Returns ctx.Err() without
+// renewing if ctx is done, so a holder whose work was canceled lets the lease
+// run out, or ErrLeaseEnded if the lease was already released or has expired.
+func (l *Lease) Renew(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done {
+		return ErrLeaseEnded
+	}
+	// Stop fails if the timer already fired; expire is then waiting for l.mu
+	// and will see the renewed deadline.
+	l.timer.Stop()
+	l.expires = time.Now().Add(l.ttl)
+	l.timer.Reset(l.ttl)
+	return nil
+}
+
+// Release releases the weight held by the lease. Returns false if the lease was
+// already released or has expired, in which case the semaphore is unchanged.
+func (l *Lease) Release() bool {
+	l.mu.Lock()
+	if l.done {
+		l.mu.Unlock()
+		return false
+	}
+	l.done = true
+	l.timer.Stop()
+	l.mu.Unlock()
+
+	l.m.finish(l.n)
+	return true
+}
+
+func (l *Lease) expire() {
+	l.mu.Lock()
+	if l.done || time.Now().Before(l.expires) {
+		// Released, or renewed after the timer fired.
+		l.mu.Unlock()
+		return
+	}
+	l.done = true
+	close(l.expired)
+	onExpire := l.onExpire
+	l.mu.Unlock()
+
+	l.m.finish(l.n)
+	report(instrumentationOf(l.m.sem), "semaphore.lease.expirations", 1)
+	if l.m.onExpire != nil {
+		go l.m.onExpire(l)
+	}
+	if onExpire != nil {
+		go onExpire(l)
+	}
+}
+
+func (m *LeaseManager) finish(n int64) {
+	m.mu.Lock()
+	m.active--
+	m.mu.Unlock()
+	m.sem.Release(n)
+}
@@ -0,0 +1,111 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaseExpires(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	expired := make(chan *Lease, 1)
+	m := NewLeaseManager(sem, func(l *Lease) { expired <- l })
+
+	l, err := m.Acquire(ctx, 2, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Active() != 1 {
+		t.Errorf("got %d active leases, want 1", m.Active())
+	}
+
+	<-l.Expired()
+	if got := <-expired; got != l {
+		t.Errorf("expiry callback got %p, want %p", got, l)
+	}
+	if !sem.TryAcquire(2) {
+		t.Error("expired lease did not release its weight")
+	}
+	if l.Release() {
+		t.Error("Release of an expired lease returned true")
+	}
+	if err := l.Renew(ctx); err != ErrLeaseEnded {
+		t.Errorf("Renew of an expired lease = %v, want ErrLeaseEnded", err)
+	}
+	if m.Active() != 0 {
+		t.Errorf("got %d active leases, want 0", m.Active())
+	}
+}
+
+func TestLeaseRenew(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	m := NewLeaseManager(sem, nil)
+
+	l, ok := m.TryAcquire(1, 20*time.Millisecond)
+	if !ok {
+		t.Fatal("TryAcquire failed on an idle semaphore")
+	}
+	for i := 0; i < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if err := l.Renew(context.Background()); err != nil {
+			t.Fatalf("Renew of a live lease = %v", err)
+		}
+	}
+
+	select {
+	case <-l.Expired():
+		t.Fatal("renewed lease expired")
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deadline := l.Deadline()
+	if err := l.Renew(ctx); err != context.Canceled {
+		t.Errorf("Renew with a canceled context = %v, want context.Canceled", err)
+	}
+	if !l.Deadline().Equal(deadline) {
+		t.Error("Renew with a canceled context extended the lease")
+	}
+
+	if !l.Release() {
+		t.Error("Release of a live lease returned false")
+	}
+	if l.Release() {
+		t.Error("second Release returned true")
+	}
+	if sem.Current() != 0 {
+		t.Errorf("got current %d, want 0", sem.Current())
+	}
+}
+
+func TestWeightedAcquireLease(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	l, err := sem.AcquireLease(context.Background(), 1, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := make(chan *Lease, 2)
+	l.OnExpire(func(l *Lease) { expired <- l })
+
+	// A hung holder never renews, so its weight comes back.
+	if got := <-expired; got != l {
+		t.Errorf("expiry callback got %p, want %p", got, l)
+	}
+	if !sem.TryAcquire(1) {
+		t.Error("expired lease did not release its weight")
+	}
+
+	// A callback set once the lease expired runs at once.
+	l.OnExpire(func(l *Lease) { expired <- l })
+	<-expired
+}
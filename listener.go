@@ -0,0 +1,66 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// LimitListener returns a Listener that accepts a connection only once it
+// acquired a weight of weightPerConn from s, and releases it when the
+// connection is closed. Unlike a flat connection count, s can be shared with
+// other work, or resized, to bound the total cost of the connections.
+//
+// Accept blocks while s is full, and fails with net.ErrClosed once the
+// listener is closed.
+func LimitListener(l net.Listener, s *Weighted, weightPerConn int64) net.Listener {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &limitListener{Listener: l, sem: s, n: weightPerConn, ctx: ctx, cancel: cancel}
+}
+
+type limitListener struct {
+	net.Listener
+	sem    *Weighted
+	n      int64
+	ctx    context.Context // Canceled on Close, to unblock Accept.
+	cancel context.CancelFunc
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if err := l.ctx.Err(); err != nil {
+		return nil, net.ErrClosed
+	}
+	if err := l.sem.Acquire(l.ctx, l.n); err != nil {
+		if l.ctx.Err() != nil {
+			return nil, net.ErrClosed
+		}
+		return nil, err
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		l.sem.Release(l.n)
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: sync.OnceFunc(func() { l.sem.Release(l.n) })}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.cancel()
+	return err
+}
+
+// limitConn is a connection of a limitListener, releasing its weight on the
+// first Close.
+type limitConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
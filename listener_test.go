@@ -0,0 +1,84 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimitListener(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sem := NewWeighted(3)
+	l := LimitListener(inner, sem, 2)
+	defer l.Close()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	defer dial().Close()
+	defer dial().Close()
+
+	first, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur := sem.Current(); cur != 2 {
+		t.Errorf("got current %d, want 2", cur)
+	}
+
+	// The second connection doesn't fit until the first is closed.
+	accepted := make(chan net.Conn)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- c
+	}()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	first.Close()
+	first.Close()
+	second := <-accepted
+	if cur := sem.Current(); cur != 2 {
+		t.Errorf("got current %d, want 2", cur)
+	}
+	second.Close()
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+}
+
+func TestLimitListenerClose(t *testing.T) {
+	t.Parallel()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := LimitListener(inner, NewWeighted(0), 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("got %v, want %v", err, net.ErrClosed)
+	}
+}
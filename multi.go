@@ -0,0 +1,73 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+)
+
+// weightedIDs numbers semaphores in creation order.
+var weightedIDs atomic.Uint64
+
+// Request is a weight to acquire on a semaphore, as part of AcquireMultiple.
+type Request struct {
+	Sem *Weighted
+	N   int64
+}
+
+// AcquireMultiple acquires the weights of reqs on their semaphores as a unit,
+// blocking until all of them are acquired or ctx is done. On success, returns
+// nil. On failure, returns the error of the failed acquisition and releases
+// whatever was acquired so far.
+//
+// Semaphores are always acquired in the same canonical order, whatever the
+// order of reqs, so callers whose requests overlap can't deadlock each other.
+// Requests on the same semaphore are acquired together.
+func AcquireMultiple(ctx context.Context, reqs []Request) error {
+	held := canonical(reqs)
+	for i, h := range held {
+		if err := h.sem.Acquire(ctx, h.n); err != nil {
+			releaseHeld(held[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+// TryAcquireMultiple acquires the weights of reqs on their semaphores as a
+// unit without blocking. On success, returns true. On failure, returns false
+// and leaves every semaphore unchanged.
+func TryAcquireMultiple(reqs []Request) bool {
+	held := canonical(reqs)
+	for i, h := range held {
+		if !h.sem.TryAcquire(h.n) {
+			releaseHeld(held[:i])
+			return false
+		}
+	}
+	return true
+}
+
+// ReleaseMultiple releases the weights of reqs on their semaphores.
+func ReleaseMultiple(reqs []Request) {
+	releaseHeld(canonical(reqs))
+}
+
+// canonical merges the requests on the same semaphore and sorts them by
+// semaphore creation order.
+func canonical(reqs []Request) []heldResource {
+	held := make([]heldResource, 0, len(reqs))
+	index := make(map[*Weighted]int, len(reqs))
+	for _, r := range reqs {
+		if i, ok := index[r.Sem]; ok {
+			held[i].n += r.N
+			continue
+		}
+		index[r.Sem] = len(held)
+		held = append(held, heldResource{sem: r.Sem, n: r.N})
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].sem.id < held[j].sem.id })
+	return held
+}
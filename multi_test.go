@@ -0,0 +1,71 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireMultiple(t *testing.T) {
+	t.Parallel()
+
+	a, b := NewWeighted(2), NewWeighted(1)
+
+	tries := []bool{}
+	tries = append(tries, TryAcquireMultiple([]Request{{a, 1}, {b, 1}})) // true;  a = 1/2, b = 1/1
+	tries = append(tries, TryAcquireMultiple([]Request{{a, 1}, {b, 1}})) // false; b is full
+	tries = append(tries, TryAcquireMultiple([]Request{{a, 1}, {a, 1}})) // false; a would be 3/2
+
+	want := []bool{true, false, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+	if a.Current() != 1 {
+		t.Errorf("got a current %d, want 1", a.Current())
+	}
+
+	// A failed acquisition rolls back the semaphores acquired before it.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := AcquireMultiple(ctx, []Request{{b, 1}, {a, 1}}); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if a.Current() != 1 {
+		t.Errorf("got a current %d, want 1", a.Current())
+	}
+
+	ReleaseMultiple([]Request{{b, 1}, {a, 1}})
+	if a.Current() != 0 || b.Current() != 0 {
+		t.Errorf("got current %d and %d, want 0", a.Current(), b.Current())
+	}
+}
+
+func TestAcquireMultipleNoDeadlock(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	a, b := NewWeighted(1), NewWeighted(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		reqs := []Request{{a, 1}, {b, 1}}
+		if i%2 == 1 {
+			reqs = []Request{{b, 1}, {a, 1}}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := AcquireMultiple(ctx, reqs); err != nil {
+				t.Error(err)
+				return
+			}
+			ReleaseMultiple(reqs)
+		}()
+	}
+	wg.Wait()
+}
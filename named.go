@@ -0,0 +1,120 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sort"
+)
+
+// Resources is a Vector whose dimensions are named, e.g.
+// {"cpu": 2, "memGB": 4, "gpus": 1}. Requests are maps of weights per
+// dimension, and dimensions they leave out are requested with a weight of 0.
+//
+// As with Vector, a request is admitted only when every dimension fits, so the
+// resources are granted atomically.
+type Resources struct {
+	vec   *Vector
+	names []string
+	index map[string]int
+}
+
+// NewResources creates a new Resources with the given maximum combined weight
+// per dimension. The set of dimensions is fixed at creation.
+func NewResources(size map[string]int64) *Resources {
+	names := make([]string, 0, len(size))
+	for name := range size {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := &Resources{names: names, index: make(map[string]int, len(names))}
+	vec := make([]int64, len(names))
+	for i, name := range names {
+		r.index[name] = i
+		vec[i] = size[name]
+	}
+	r.vec = NewVector(vec...)
+	return r
+}
+
+// Acquire acquires the requested weight of every dimension, blocking until all
+// of them are available or ctx is done. On success, returns nil. On failure,
+// returns ctx.Err(), or ErrUnknownResource if req names a dimension r doesn't
+// have, and leaves r unchanged.
+func (r *Resources) Acquire(ctx context.Context, req map[string]int64) error {
+	n, ok := r.vector(req)
+	if !ok {
+		return ErrUnknownResource
+	}
+	return r.vec.Acquire(ctx, n...)
+}
+
+// TryAcquire acquires the requested weight of every dimension without
+// blocking. On success, returns true. On failure, including when req names a
+// dimension r doesn't have, returns false and leaves r unchanged.
+func (r *Resources) TryAcquire(req map[string]int64) bool {
+	n, ok := r.vector(req)
+	return ok && r.vec.TryAcquire(n...)
+}
+
+// Release releases the requested weight of every dimension.
+func (r *Resources) Release(req map[string]int64) {
+	n, ok := r.vector(req)
+	if !ok {
+		panic("semaphore: bad release")
+	}
+	r.vec.Release(n...)
+}
+
+// Resize resizes the dimensions in size, keeping the others as they are.
+func (r *Resources) Resize(size map[string]int64) {
+	vec := r.vec.Size()
+	for name, n := range size {
+		i, ok := r.index[name]
+		if !ok {
+			panic("semaphore: bad resize")
+		}
+		vec[i] = n
+	}
+	r.vec.Resize(vec...)
+}
+
+// Current returns the current usage per dimension.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (r *Resources) Current() map[string]int64 {
+	return r.named(r.vec.Current())
+}
+
+// Size returns the maximum size per dimension.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (r *Resources) Size() map[string]int64 {
+	return r.named(r.vec.Size())
+}
+
+// Waiters returns the number of currently waiting Acquire calls.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (r *Resources) Waiters() int {
+	return r.vec.Waiters()
+}
+
+// vector converts req to a weight per dimension, in the order of r.names.
+func (r *Resources) vector(req map[string]int64) ([]int64, bool) {
+	n := make([]int64, len(r.names))
+	for name, w := range req {
+		i, ok := r.index[name]
+		if !ok {
+			return nil, false
+		}
+		n[i] = w
+	}
+	return n, true
+}
+
+func (r *Resources) named(vec []int64) map[string]int64 {
+	m := make(map[string]int64, len(vec))
+	for i, n := range vec {
+		m[r.names[i]] = n
+	}
+	return m
+}
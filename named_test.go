@@ -0,0 +1,62 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResources(t *testing.T) {
+	t.Parallel()
+
+	r := NewResources(map[string]int64{"cpu": 4, "memGB": 8, "gpus": 1})
+
+	tries := []bool{}
+	tries = append(tries, r.TryAcquire(map[string]int64{"cpu": 2, "gpus": 1}))  // true;  cpu 2/4, gpus 1/1
+	tries = append(tries, r.TryAcquire(map[string]int64{"cpu": 1, "gpus": 1}))  // false; gpus doesn't fit
+	tries = append(tries, r.TryAcquire(map[string]int64{"cpu": 2, "memGB": 8})) // true;  cpu 4/4, memGB 8/8
+	tries = append(tries, r.TryAcquire(map[string]int64{"disk": 1}))            // false; unknown dimension
+
+	want := []bool{true, false, true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+	if got, want := r.Current(), map[string]int64{"cpu": 4, "memGB": 8, "gpus": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got current %v, want %v", got, want)
+	}
+
+	if err := r.Acquire(context.Background(), map[string]int64{"disk": 1}); err != ErrUnknownResource {
+		t.Errorf("got %v, want %v", err, ErrUnknownResource)
+	}
+
+	r.Release(map[string]int64{"cpu": 2, "gpus": 1})
+	r.Release(map[string]int64{"cpu": 2, "memGB": 8})
+	if got, want := r.Current(), map[string]int64{"cpu": 0, "memGB": 0, "gpus": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got current %v, want %v", got, want)
+	}
+}
+
+func TestResourcesResize(t *testing.T) {
+	t.Parallel()
+
+	r := NewResources(map[string]int64{"cpu": 2, "gpus": 0})
+
+	done := make(chan error)
+	go func() { done <- r.Acquire(context.Background(), map[string]int64{"cpu": 1, "gpus": 1}) }()
+	for r.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	r.Resize(map[string]int64{"gpus": 1})
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if got, want := r.Size(), map[string]int64{"cpu": 2, "gpus": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got size %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+// Package namedsem implements a weighted semaphore shared by the processes of
+// a host through a named semaphore of the operating system: a POSIX named
+// semaphore, from sem_open, on Linux, macOS and FreeBSD, which needs cgo, and a
+// semaphore object, from CreateSemaphore, on Windows. It needs no daemon, and
+// interoperates with programs in other languages using the same primitive.
+//
+// A weight of n is n units of the OS semaphore, taken all or nothing: an
+// acquisition that can't take all of them gives back those it took and
+// retries, so two acquisitions never deadlock holding part of their weight
+// each. Blocked acquisitions poll, so they are not FIFO, and a large weight
+// waits for enough units to be free at once.
+//
+// The OS keeps no record of who holds the units, so those of a process that
+// crashes are lost until the semaphore is recreated; see package broker for a
+// semaphore that reclaims them.
+package namedsem
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Option configures a Semaphore.
+type Option func(*Semaphore)
+
+// WithPollInterval sets how often a blocked Acquire retries. The default is 10
+// milliseconds.
+func WithPollInterval(d time.Duration) Option {
+	if d <= 0 {
+		panic("namedsem: bad poll interval")
+	}
+	return func(s *Semaphore) {
+		s.poll = d
+	}
+}
+
+// Semaphore is a named semaphore of the operating system, open in this
+// process.
+type Semaphore struct {
+	h    handle
+	poll time.Duration
+	mu   sync.Mutex
+	held int64 // Units held by this process.
+}
+
+// Open opens the named semaphore called name, creating it with size units if
+// it doesn't exist. The name must not contain slashes or backslashes. It
+// returns an error wrapping errors.ErrUnsupported on systems without named
+// semaphores, including Unix systems without cgo.
+func Open(name string, size int64, opts ...Option) (*Semaphore, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, errors.New("namedsem: bad name")
+	}
+	if size < 0 || size > maxSize {
+		return nil, errors.New("namedsem: bad size")
+	}
+	h, err := open(name, size)
+	if err != nil {
+		return nil, err
+	}
+	s := &Semaphore{h: h, poll: 10 * time.Millisecond}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Remove removes the named semaphore called name, so the next Open creates it
+// anew. Processes that have it open keep using the old one. On Windows, where
+// a semaphore object lives while it is open, it does nothing.
+func Remove(name string) error {
+	return remove(name)
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() or the error of the OS, and leaves the semaphore unchanged.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	for {
+		ok, err := s.tryAcquire(n)
+		switch {
+		case ok:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		timer := time.NewTimer(s.poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including an error of the OS, returns
+// false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	ok, _ := s.tryAcquire(n)
+	return ok
+}
+
+// tryAcquire takes n units, or none.
+func (s *Semaphore) tryAcquire(n int64) (bool, error) {
+	for taken := int64(0); taken < n; taken++ {
+		ok, err := s.h.tryWait()
+		if err != nil || !ok {
+			if taken > 0 {
+				s.h.post(taken)
+			}
+			return false, err
+		}
+	}
+	s.mu.Lock()
+	s.held += n
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Release releases a weight of n held by this process. It panics if the
+// process holds less.
+func (s *Semaphore) Release(n int64) {
+	s.mu.Lock()
+	if s.held < n {
+		s.mu.Unlock()
+		panic("namedsem: bad release")
+	}
+	s.held -= n
+	s.mu.Unlock()
+	if n > 0 {
+		s.h.post(n)
+	}
+}
+
+// Close closes the semaphore in this process. Units it still holds stay
+// taken.
+func (s *Semaphore) Close() error {
+	return s.h.close()
+}
@@ -0,0 +1,21 @@
+//go:build !windows && !(cgo && (linux || darwin || freebsd))
+
+package namedsem
+
+import (
+	"errors"
+	"fmt"
+)
+
+const maxSize = 1<<63 - 1 // Open fails anyway.
+
+var errUnsupported = fmt.Errorf("namedsem: %w", errors.ErrUnsupported)
+
+type handle struct{}
+
+func open(name string, size int64) (handle, error) { return handle{}, errUnsupported }
+func remove(name string) error                     { return errUnsupported }
+
+func (handle) tryWait() (bool, error) { return false, errUnsupported }
+func (handle) post(n int64) error     { return errUnsupported }
+func (handle) close() error           { return errUnsupported }
@@ -0,0 +1,103 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package namedsem
+
+/*
+#cgo linux LDFLAGS: -pthread
+#include <errno.h>
+#include <fcntl.h>
+#include <semaphore.h>
+#include <stdlib.h>
+
+static sem_t *open_sem(const char *name, unsigned value, int *err) {
+	sem_t *s = sem_open(name, O_CREAT, 0600, value);
+	if (s == SEM_FAILED) {
+		*err = errno;
+		return NULL;
+	}
+	return s;
+}
+
+static int try_wait(sem_t *s) {
+	while (sem_trywait(s) != 0) {
+		if (errno != EINTR) {
+			return errno;
+		}
+	}
+	return 0;
+}
+
+static int post(sem_t *s) {
+	return sem_post(s) == 0 ? 0 : errno;
+}
+
+static int close_sem(sem_t *s) {
+	return sem_close(s) == 0 ? 0 : errno;
+}
+
+static int unlink_sem(const char *name) {
+	return sem_unlink(name) == 0 ? 0 : errno;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const maxSize = 1<<31 - 1 // SEM_VALUE_MAX of Linux and macOS.
+
+type handle struct {
+	sem *C.sem_t
+}
+
+func open(name string, size int64) (handle, error) {
+	cname := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(cname))
+	var errno C.int
+	sem := C.open_sem(cname, C.unsigned(size), &errno)
+	if sem == nil {
+		return handle{}, fmt.Errorf("namedsem: sem_open: %w", syscall.Errno(errno))
+	}
+	return handle{sem: sem}, nil
+}
+
+func remove(name string) error {
+	cname := C.CString("/" + name)
+	defer C.free(unsafe.Pointer(cname))
+	if errno := C.unlink_sem(cname); errno != 0 {
+		return fmt.Errorf("namedsem: sem_unlink: %w", syscall.Errno(errno))
+	}
+	return nil
+}
+
+// tryWait takes a unit if one is free.
+func (h handle) tryWait() (bool, error) {
+	switch errno := syscall.Errno(C.try_wait(h.sem)); errno {
+	case 0:
+		return true, nil
+	case syscall.EAGAIN:
+		return false, nil
+	default:
+		return false, fmt.Errorf("namedsem: sem_trywait: %w", errno)
+	}
+}
+
+// post gives back n units.
+func (h handle) post(n int64) error {
+	for ; n > 0; n-- {
+		if errno := C.post(h.sem); errno != 0 {
+			return fmt.Errorf("namedsem: sem_post: %w", syscall.Errno(errno))
+		}
+	}
+	return nil
+}
+
+func (h handle) close() error {
+	if errno := C.close_sem(h.sem); errno != 0 {
+		return fmt.Errorf("namedsem: sem_close: %w", syscall.Errno(errno))
+	}
+	return nil
+}
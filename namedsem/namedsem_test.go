@@ -0,0 +1,87 @@
+package namedsem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Semaphore)(nil)
+
+// openTwice opens a semaphore with a name of its own to the test twice, as two
+// processes would.
+func openTwice(t *testing.T, size int64) (*Semaphore, *Semaphore) {
+	name := fmt.Sprintf("namedsem-test-%d-%d", os.Getpid(), time.Now().UnixNano())
+	a, err := Open(name, size, WithPollInterval(time.Millisecond))
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close(); Remove(name) })
+	b, err := Open(name, size, WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return a, b
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	a, b := openTwice(t, 3)
+
+	tries := []bool{}
+	tries = append(tries, a.TryAcquire(2)) // true;  2/3
+	tries = append(tries, b.TryAcquire(2)) // false; shared with a
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	want := []bool{true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Acquire(ctx, 2) }()
+	time.Sleep(5 * time.Millisecond)
+	a.Release(2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(tctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// A failed acquisition gives back the units it took.
+	b.Release(3)
+	if !a.TryAcquire(3) {
+		t.Error("units of failed acquisitions were not given back")
+	}
+}
+
+func TestSemaphoreBadRelease(t *testing.T) {
+	a, _ := openTwice(t, 1)
+	defer func() {
+		if recover() == nil {
+			t.Error("Release of a weight not held didn't panic")
+		}
+	}()
+	a.Release(1)
+}
+
+func TestOpenBadName(t *testing.T) {
+	if _, err := Open("a/b", 1); err == nil {
+		t.Error("got nil, want an error")
+	}
+}
@@ -0,0 +1,68 @@
+//go:build windows
+
+package namedsem
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const maxSize = 1<<31 - 1 // The maximum count of a semaphore object.
+
+var (
+	kernel32            = syscall.NewLazyDLL("kernel32.dll")
+	procCreateSemaphore = kernel32.NewProc("CreateSemaphoreW")
+	procReleaseSema     = kernel32.NewProc("ReleaseSemaphore")
+)
+
+const (
+	waitObject0 = 0x00000000
+	waitTimeout = 0x00000102
+)
+
+type handle struct {
+	h syscall.Handle
+}
+
+func open(name string, size int64) (handle, error) {
+	wname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return handle{}, fmt.Errorf("namedsem: %w", err)
+	}
+	// The counts are ignored if the semaphore exists.
+	h, _, err := procCreateSemaphore.Call(0, uintptr(size), uintptr(max(size, 1)), uintptr(unsafe.Pointer(wname)))
+	if h == 0 {
+		return handle{}, fmt.Errorf("namedsem: CreateSemaphore: %w", err)
+	}
+	return handle{h: syscall.Handle(h)}, nil
+}
+
+func remove(name string) error {
+	return nil
+}
+
+// tryWait takes a unit if one is free.
+func (h handle) tryWait() (bool, error) {
+	event, err := syscall.WaitForSingleObject(h.h, 0)
+	switch event {
+	case waitObject0:
+		return true, nil
+	case waitTimeout:
+		return false, nil
+	default:
+		return false, fmt.Errorf("namedsem: WaitForSingleObject: %w", err)
+	}
+}
+
+// post gives back n units.
+func (h handle) post(n int64) error {
+	if ok, _, err := procReleaseSema.Call(uintptr(h.h), uintptr(n), 0); ok == 0 {
+		return fmt.Errorf("namedsem: ReleaseSemaphore: %w", err)
+	}
+	return nil
+}
+
+func (h handle) close() error {
+	return syscall.CloseHandle(h.h)
+}
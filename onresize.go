@@ -0,0 +1,86 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// ResizeEvent describes a change of a semaphore's size.
+type ResizeEvent struct {
+	Old, New int64
+}
+
+type resizeHook struct {
+	fn func(old, new int64)
+}
+
+// OnResize registers fn to be called whenever the size of the semaphore
+// changes, by any of the Resize methods, and returns a function that
+// unregisters it. Resizes to the same size are not reported.
+//
+// Callbacks run in order on the goroutine of the queue callbacks, never under
+// the semaphore's lock.
+func (s *Weighted) OnResize(fn func(old, new int64)) (stop func()) {
+	h := s.addResizeHook(fn)
+	return func() {
+		s.lock()
+		s.removeResizeHook(h)
+		s.mu.Unlock()
+	}
+}
+
+// SubscribeResize returns a channel receiving an event whenever the size of
+// the semaphore changes, and a function that unsubscribes it. Events a slow
+// receiver hasn't taken yet are coalesced into one, from the oldest size not
+// yet reported to the latest, so the latest size is never lost.
+//
+// stop closes the channel once the events of the resizes made before it are
+// delivered, so a receiver ranging over it ends.
+func (s *Weighted) SubscribeResize() (events <-chan ResizeEvent, stop func()) {
+	ch := make(chan ResizeEvent, 1)
+	h := s.addResizeHook(func(old, new int64) {
+		e := ResizeEvent{Old: old, New: new}
+		select {
+		case pending := <-ch:
+			e.Old = pending.Old
+		default:
+		}
+		// The dispatcher is the only sender, so there is room now.
+		ch <- e
+	})
+	return ch, func() {
+		s.lock()
+		if s.removeResizeHook(h) {
+			// After the hook's pending calls, on the dispatcher that runs them.
+			s.callbacks.post(func() { close(ch) })
+		}
+		s.mu.Unlock()
+	}
+}
+
+// addResizeHook registers fn as a resize hook.
+func (s *Weighted) addResizeHook(fn func(old, new int64)) *resizeHook {
+	h := &resizeHook{fn: fn}
+	s.lock()
+	s.resizeHooks = append(s.resizeHooks, h)
+	s.mu.Unlock()
+	return h
+}
+
+// removeResizeHook unregisters h, returning whether it was registered. Must be
+// called with s.mu held.
+func (s *Weighted) removeResizeHook(h *resizeHook) bool {
+	for i, hook := range s.resizeHooks {
+		if hook == h {
+			s.resizeHooks = append(s.resizeHooks[:i:i], s.resizeHooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// resized posts the resize hooks for a change of size from old to new. Must be
+// called with s.mu held.
+func (s *Weighted) resized(old, new int64) {
+	for _, h := range s.resizeHooks {
+		fn := h.fn
+		s.callbacks.post(func() { fn(old, new) })
+	}
+}
@@ -0,0 +1,87 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "testing"
+
+func TestWeightedOnResize(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	events := make(chan ResizeEvent, 4)
+	stop := sem.OnResize(func(old, new int64) {
+		events <- ResizeEvent{old, new}
+	})
+	sem.Resize(4)
+	sem.Resize(4) // Not a change.
+	sem.ResizeBy(-1)
+	for i, want := range []ResizeEvent{{2, 4}, {4, 3}} {
+		if got := <-events; got != want {
+			t.Errorf("event %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	stop()
+	sem.Resize(8)
+	done := make(chan struct{})
+	sem.OnResize(func(old, new int64) { close(done) })
+	sem.Resize(9)
+	<-done // Callbacks run in order: the stopped one would have run by now.
+	select {
+	case e := <-events:
+		t.Errorf("got %+v after stop", e)
+	default:
+	}
+}
+
+func TestWeightedSubscribeResize(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	block := make(chan struct{})
+	sem.OnResize(func(old, new int64) { <-block })
+	events, stop := sem.SubscribeResize()
+	defer stop()
+	done := make(chan struct{})
+	sem.OnResize(func(old, new int64) {
+		if new == 5 {
+			close(done)
+		}
+	})
+
+	// Events the subscriber doesn't take are coalesced.
+	sem.Resize(2)
+	sem.Resize(3)
+	sem.Resize(5)
+	close(block)
+	<-done
+	if e, want := <-events, (ResizeEvent{Old: 1, New: 5}); e != want {
+		t.Errorf("got %+v, want %+v", e, want)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("got %+v after the coalesced event", e)
+	default:
+	}
+}
+
+func TestWeightedSubscribeResizeStop(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	events, stop := sem.SubscribeResize()
+	sem.Resize(2)
+	stop()
+	stop()
+	sem.Resize(3)
+
+	// The event of the resize before stop is delivered, then the channel is
+	// closed.
+	var got []ResizeEvent
+	for e := range events {
+		got = append(got, e)
+	}
+	if len(got) != 1 || got[0] != (ResizeEvent{Old: 1, New: 2}) {
+		t.Errorf("got %+v, want only {Old:1 New:2}", got)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"errors"
+	"time"
+)
+
+// Option configures a Weighted at construction time. Options are applied in
+// order, so a later option overrides an earlier one setting the same thing.
+type Option func(*Weighted)
+
+// ErrBadRelease and ErrBadResize are reported to the misuse handler set
+// WithMisuseHandler, in place of the panics of Release and Resize.
+var (
+	ErrBadRelease = errors.New("semaphore: bad release")
+	ErrBadResize  = errors.New("semaphore: bad resize")
+)
+
+// WithName names the semaphore, for diagnostics.
+func WithName(name string) Option {
+	return func(s *Weighted) {
+		s.name = name
+	}
+}
+
+// WithoutBypass makes the semaphore ignore contexts marked by WithBypass, for
+// hardened deployments where no caller may skip admission.
+func WithoutBypass() Option {
+	return func(s *Weighted) {
+		s.noBypass = true
+	}
+}
+
+// WithDefaultWeight sets the weight used by AcquireDefault and ReleaseDefault,
+// which is 1 otherwise.
+func WithDefaultWeight(n int64) Option {
+	if n <= 0 {
+		panic("semaphore: bad default weight")
+	}
+	return func(s *Weighted) {
+		s.defaultWeight = n
+	}
+}
+
+// WithMaxWait bounds how long Acquire waits in the queue: a waiter that is not
+// admitted within d fails with context.DeadlineExceeded, whatever the deadline
+// of its own context.
+func WithMaxWait(d time.Duration) Option {
+	if d <= 0 {
+		panic("semaphore: bad max wait")
+	}
+	return func(s *Weighted) {
+		s.maxWait = d
+	}
+}
+
+// WithQueueCallbacks sets callbacks for the edges of the waiter queue:
+// onFirstBlocked is called when an Acquire blocks on an empty queue, and
+// onQueueEmpty when the last queued waiter leaves it, whether admitted or
+// canceled. They are the natural points to start and stop auxiliary capacity.
+//
+// Callbacks run in order on a goroutine of their own, never under the
+// semaphore's lock. Either may be nil.
+func WithQueueCallbacks(onFirstBlocked, onQueueEmpty func()) Option {
+	return func(s *Weighted) {
+		s.onFirstBlocked = onFirstBlocked
+		s.onQueueEmpty = onQueueEmpty
+	}
+}
+
+// WithMisuseHandler makes the semaphore report misuse to fn instead of
+// panicking, for services that would rather log a bug than crash on it: a
+// Release of more than is held reports ErrBadRelease and releases what is
+// held, and a Resize to a negative size reports ErrBadResize and is ignored.
+//
+// The handler runs on the goroutine of the queue callbacks, never under the
+// semaphore's lock.
+func WithMisuseHandler(fn func(error)) Option {
+	return func(s *Weighted) {
+		s.onMisuse = fn
+	}
+}
+
+// misused posts err to the misuse handler. Must be called with s.mu held.
+func (s *Weighted) misused(err error) {
+	fn := s.onMisuse
+	s.callbacks.post(func() { fn(err) })
+}
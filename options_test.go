@@ -0,0 +1,41 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWeightedMisuseHandler(t *testing.T) {
+	t.Parallel()
+
+	misuses := make(chan error, 2)
+	sem := NewWeighted(2, WithMisuseHandler(func(err error) { misuses <- err }))
+	sem.Acquire(context.Background(), 1)
+
+	sem.Release(2)
+	if err := <-misuses; err != ErrBadRelease {
+		t.Errorf("got %v, want ErrBadRelease", err)
+	}
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d after over-release, want 0", cur)
+	}
+
+	sem.Resize(-1)
+	if err := <-misuses; err != ErrBadResize {
+		t.Errorf("got %v, want ErrBadResize", err)
+	}
+	if size := sem.Size(); size != 2 {
+		t.Errorf("got size %d after bad resize, want 2", size)
+	}
+}
+
+func TestOptionsAppliedInOrder(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1, WithName("first"), WithDefaultWeight(2), WithName("second"))
+	if name, weight := sem.Name(), sem.defaultWeight; name != "second" || weight != 2 {
+		t.Errorf("got name %q and default weight %d, want \"second\" and 2", name, weight)
+	}
+}
@@ -0,0 +1,159 @@
+// Package otel traces the waits of semaphores with OpenTelemetry, so queueing
+// in a semaphore shows up in distributed traces instead of as unexplained
+// latency.
+//
+//	inst := otel.NewInstrumentation(nil)
+//	sem := semaphore.NewWeighted(10, semaphore.WithName("db"), semaphore.WithInstrumentation(inst))
+//
+// Only blocked Acquire calls are traced, as sampled by semaphore.WithSampler;
+// those admitted immediately cost nothing.
+//
+// TraceExemplar links the wait histogram of the prometheus package to these
+// traces.
+package otel
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	otelglobal "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+// Option configures an Instrumentation.
+type Option func(*Instrumentation)
+
+// WithEvents records each wait as an event of the span already active in the
+// waiting call's context, instead of as a child span of it. Waits outside of a
+// recording span are not recorded.
+func WithEvents() Option {
+	return func(i *Instrumentation) {
+		i.events = true
+	}
+}
+
+// Instrumentation is a semaphore.Instrumentation tracing waits. Each blocked
+// Acquire becomes a "semaphore.wait" span with these attributes:
+//
+//	semaphore.name     the name of the semaphore; see semaphore.WithName
+//	semaphore.weight   the requested weight
+//	semaphore.outcome  "acquired", "canceled" or "failed"
+//
+// A wait that didn't acquire ends the span with an error status.
+//
+// It records nothing else: logs and metrics are left to another integration.
+type Instrumentation struct {
+	tracer trace.Tracer
+	events bool
+}
+
+var _ semaphore.Instrumentation = (*Instrumentation)(nil)
+
+// NewInstrumentation creates an Instrumentation tracing with tp, or with the
+// global tracer provider if tp is nil.
+func NewInstrumentation(tp trace.TracerProvider, opts ...Option) *Instrumentation {
+	if tp == nil {
+		tp = otelglobal.GetTracerProvider()
+	}
+	i := &Instrumentation{tracer: tp.Tracer("github.com/sherifabdlnaby/semaphore")}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Logger returns nil.
+func (i *Instrumentation) Logger() *slog.Logger {
+	return nil
+}
+
+// Count does nothing.
+func (i *Instrumentation) Count(name string, delta int64, attrs ...slog.Attr) {}
+
+// Observe does nothing.
+func (i *Instrumentation) Observe(name string, value float64, attrs ...slog.Attr) {}
+
+// StartSpan starts a span of the wait in ctx, or, WithEvents, notes its start
+// to record an event when it ends.
+func (i *Instrumentation) StartSpan(ctx context.Context, name string, attrs ...slog.Attr) func(err error) {
+	kvs := attributes(attrs)
+	if i.events {
+		span := trace.SpanFromContext(ctx)
+		if !span.IsRecording() {
+			return func(error) {}
+		}
+		start := time.Now()
+		return func(err error) {
+			kvs = append(kvs, outcome(err), attribute.Float64("semaphore.wait_seconds", time.Since(start).Seconds()))
+			span.AddEvent(name, trace.WithTimestamp(start), trace.WithAttributes(kvs...))
+		}
+	}
+
+	_, span := i.tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+	return func(err error) {
+		span.SetAttributes(outcome(err))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// TraceExemplar returns the exemplar labels of a wait observed in ctx: the
+// "trace_id" and "span_id" of the sampled span of ctx, or nil if there is
+// none. It is meant as the Exemplar of a prometheus.Instrumentation, linking
+// wait-time spikes to traces:
+//
+//	hist := semprom.NewInstrumentation(nil)
+//	hist.Exemplar = otel.TraceExemplar
+//	inst := semaphore.MultiInstrumentation(otel.NewInstrumentation(nil), hist)
+func TraceExemplar(ctx context.Context) prom.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return nil
+	}
+	return prom.Labels{"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String()}
+}
+
+// outcome returns the outcome attribute of a wait that ended with err.
+func outcome(err error) attribute.KeyValue {
+	switch {
+	case err == nil:
+		return attribute.String("semaphore.outcome", "acquired")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return attribute.String("semaphore.outcome", "canceled")
+	default:
+		return attribute.String("semaphore.outcome", "failed")
+	}
+}
+
+// attributes converts the attributes reported by a semaphore to span
+// attributes, under the "semaphore." namespace.
+func attributes(attrs []slog.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs)+2)
+	for _, a := range attrs {
+		key := "semaphore." + a.Key
+		if a.Key == "semaphore" {
+			key = "semaphore.name"
+		}
+		switch v := a.Value.Resolve(); v.Kind() {
+		case slog.KindInt64:
+			kvs = append(kvs, attribute.Int64(key, v.Int64()))
+		case slog.KindBool:
+			kvs = append(kvs, attribute.Bool(key, v.Bool()))
+		case slog.KindFloat64:
+			kvs = append(kvs, attribute.Float64(key, v.Float64()))
+		default:
+			kvs = append(kvs, attribute.String(key, v.String()))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,169 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/sherifabdlnaby/semaphore"
+	semprom "github.com/sherifabdlnaby/semaphore/prometheus"
+)
+
+// blockOnce makes a single Acquire of sem in ctx wait, then admits it or, if
+// cancel, cancels it.
+func blockOnce(t *testing.T, sem *semaphore.Weighted, ctx context.Context, cancel bool) {
+	t.Helper()
+	sem.Acquire(context.Background(), 1)
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	done := make(chan error)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if cancel {
+		stop()
+	} else {
+		sem.Release(1)
+	}
+	<-done
+	sem.Release(1) // Ours if canceled, the waiter's otherwise.
+}
+
+func attr(kvs []attribute.KeyValue, key string) attribute.Value {
+	for _, kv := range kvs {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestInstrumentationSpans(t *testing.T) {
+	t.Parallel()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	sem := semaphore.NewWeighted(1, semaphore.WithName("db"), semaphore.WithInstrumentation(NewInstrumentation(tp)))
+
+	blockOnce(t, sem, context.Background(), false)
+	blockOnce(t, sem, context.Background(), true)
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	tries := []struct {
+		outcome string
+		status  codes.Code
+	}{
+		{"acquired", codes.Unset},
+		{"canceled", codes.Error},
+	}
+	for i, try := range tries {
+		span := spans[i]
+		if span.Name() != "semaphore.wait" {
+			t.Errorf("tries[%d]: got span %q, want semaphore.wait", i, span.Name())
+		}
+		kvs := span.Attributes()
+		if name := attr(kvs, "semaphore.name").AsString(); name != "db" {
+			t.Errorf("tries[%d]: got semaphore.name %q, want db", i, name)
+		}
+		if weight := attr(kvs, "semaphore.weight").AsInt64(); weight != 1 {
+			t.Errorf("tries[%d]: got semaphore.weight %d, want 1", i, weight)
+		}
+		if outcome := attr(kvs, "semaphore.outcome").AsString(); outcome != try.outcome {
+			t.Errorf("tries[%d]: got semaphore.outcome %q, want %q", i, outcome, try.outcome)
+		}
+		if code := span.Status().Code; code != try.status {
+			t.Errorf("tries[%d]: got status %v, want %v", i, code, try.status)
+		}
+	}
+}
+
+func TestInstrumentationEvents(t *testing.T) {
+	t.Parallel()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	sem := semaphore.NewWeighted(1, semaphore.WithInstrumentation(NewInstrumentation(tp, WithEvents())))
+
+	// Waits outside of a span are not recorded.
+	blockOnce(t, sem, context.Background(), false)
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	blockOnce(t, sem, ctx, false)
+	span.End()
+
+	spans := sr.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want only the request's", len(spans))
+	}
+	events := spans[0].Events()
+	if len(events) != 1 || events[0].Name != "semaphore.wait" {
+		t.Fatalf("got events %v, want one semaphore.wait", events)
+	}
+	if outcome := attr(events[0].Attributes, "semaphore.outcome").AsString(); outcome != "acquired" {
+		t.Errorf("got semaphore.outcome %q, want acquired", outcome)
+	}
+}
+
+func TestTraceExemplar(t *testing.T) {
+	t.Parallel()
+
+	if labels := TraceExemplar(context.Background()); labels != nil {
+		t.Errorf("got %v outside a span, want nil", labels)
+	}
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	hist := semprom.NewInstrumentation(nil)
+	hist.Exemplar = TraceExemplar
+	sem := semaphore.NewWeighted(1, semaphore.WithName("db"),
+		semaphore.WithInstrumentation(semaphore.MultiInstrumentation(NewInstrumentation(tp), hist)))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "request")
+	blockOnce(t, sem, ctx, false)
+	span.End()
+	traceID := span.SpanContext().TraceID().String()
+
+	spans := sr.Ended()
+	if len(spans) != 2 || spans[0].Name() != "semaphore.wait" {
+		t.Fatalf("got %d spans, want a semaphore.wait span and the request's", len(spans))
+	}
+	if got := spans[0].SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("got span in trace %s, want %s", got, traceID)
+	}
+
+	reg := prom.NewRegistry()
+	reg.MustRegister(hist)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || len(mfs[0].GetMetric()) != 1 {
+		t.Fatalf("got %d metric families, want semaphore_wait_seconds", len(mfs))
+	}
+	var exemplars int
+	for _, b := range mfs[0].GetMetric()[0].GetHistogram().GetBucket() {
+		e := b.GetExemplar()
+		if e == nil {
+			continue
+		}
+		exemplars++
+		for _, l := range e.GetLabel() {
+			if l.GetName() == "trace_id" && l.GetValue() != traceID {
+				t.Errorf("got exemplar trace_id %s, want %s", l.GetValue(), traceID)
+			}
+		}
+	}
+	if exemplars != 1 {
+		t.Errorf("got %d exemplars, want 1", exemplars)
+	}
+}
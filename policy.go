@@ -0,0 +1,38 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// QueuePolicy is the order in which waiters of equal priority are admitted.
+type QueuePolicy int
+
+const (
+	// FIFO admits the longest-waiting waiter first. It is the default.
+	FIFO QueuePolicy = iota
+	// LIFO admits the most recently arrived waiter first. Under overload, the
+	// newest waiters are the likeliest to still have a client waiting on them,
+	// while the oldest time out in the queue.
+	LIFO
+)
+
+// WithQueuePolicy sets the order in which queued waiters are admitted. It has
+// no effect together with WithScheduler.
+func WithQueuePolicy(p QueuePolicy) Option {
+	if p != FIFO && p != LIFO {
+		panic("semaphore: bad queue policy")
+	}
+	return func(s *Weighted) {
+		s.lifo = p == LIFO
+	}
+}
+
+// next returns the queued waiter to admit next under the queue policy and
+// priorities. Must be called with s.mu held and the queue non-empty.
+func (s *Weighted) next() *waiter {
+	if s.prioritized {
+		return s.highestPriority()
+	}
+	if s.lifo {
+		return s.waiters.Back()
+	}
+	return s.waiters.Front()
+}
@@ -0,0 +1,62 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedLIFO(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1, WithQueuePolicy(LIFO))
+	sem.Acquire(ctx, 1)
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			sem.Acquire(ctx, 1)
+			order <- i
+		}()
+		for sem.Waiters() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for want := 2; want >= 0; want-- {
+		sem.Release(1)
+		if got := <-order; got != want {
+			t.Fatalf("admitted waiter %d, want %d", got, want)
+		}
+	}
+	sem.Release(1)
+}
+
+func TestWeightedLIFOPriority(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1, WithQueuePolicy(LIFO))
+	sem.Acquire(ctx, 1)
+
+	order := make(chan int, 3)
+	for i, priority := range []int{1, 1, 0} {
+		go func() {
+			sem.AcquireWithPriority(ctx, 1, priority)
+			order <- i
+		}()
+		for sem.Waiters() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// Higher priority first, the newest first among equals.
+	for _, want := range []int{1, 0, 2} {
+		sem.Release(1)
+		if got := <-order; got != want {
+			t.Fatalf("admitted waiter %d, want %d", got, want)
+		}
+	}
+	sem.Release(1)
+}
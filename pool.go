@@ -0,0 +1,116 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool is a pool of resources, such as connections, of which at most size are
+// handed out at once. Returned resources are kept for reuse, most recently
+// returned first, and new ones are created on demand.
+type Pool[T any] struct {
+	sem     *Weighted
+	newFunc func(context.Context) (T, error)
+	close   func(T)
+	mu      sync.Mutex
+	free    []T
+}
+
+// NewPool creates a new Pool handing out at most size resources at once,
+// created with newFunc. If closeFunc is not nil, it is called with the
+// resources the pool drops: discarded ones, and those returned while the pool
+// already keeps as many as its size.
+func NewPool[T any](size int64, newFunc func(context.Context) (T, error), closeFunc func(T)) *Pool[T] {
+	return &Pool[T]{sem: NewWeighted(size), newFunc: newFunc, close: closeFunc}
+}
+
+// Get returns a resource, blocking until fewer than size are handed out or ctx
+// is done. It reuses a returned resource if there is one, or else creates one
+// with ctx. On failure, returns ctx.Err() or the error of the creation.
+func (p *Pool[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+	if err := p.sem.Acquire(ctx, 1); err != nil {
+		return zero, err
+	}
+
+	p.mu.Lock()
+	if n := len(p.free); n > 0 {
+		v := p.free[n-1]
+		p.free[n-1] = zero
+		p.free = p.free[:n-1]
+		p.mu.Unlock()
+		return v, nil
+	}
+	p.mu.Unlock()
+
+	v, err := p.newFunc(ctx)
+	if err != nil {
+		p.sem.Release(1)
+		return zero, err
+	}
+	return v, nil
+}
+
+// Put returns a resource obtained from Get to the pool.
+func (p *Pool[T]) Put(v T) {
+	p.mu.Lock()
+	keep := int64(len(p.free)) < p.sem.Size()
+	if keep {
+		p.free = append(p.free, v)
+	}
+	p.mu.Unlock()
+	if !keep && p.close != nil {
+		p.close(v)
+	}
+	p.sem.Release(1)
+}
+
+// Discard drops a resource obtained from Get instead of returning it, e.g.
+// because it is broken, making room for a new one.
+func (p *Pool[T]) Discard(v T) {
+	if p.close != nil {
+		p.close(v)
+	}
+	p.sem.Release(1)
+}
+
+// Resize sets the number of resources the pool hands out at once. Resources
+// kept beyond a smaller size are dropped.
+func (p *Pool[T]) Resize(size int64) {
+	p.sem.Resize(size)
+
+	p.mu.Lock()
+	var dropped []T
+	if extra := int64(len(p.free)) - size; extra > 0 {
+		dropped = append(dropped, p.free[:extra]...)
+		p.free = append(p.free[:0], p.free[extra:]...)
+	}
+	p.mu.Unlock()
+	if p.close != nil {
+		for _, v := range dropped {
+			p.close(v)
+		}
+	}
+}
+
+// Size returns the number of resources the pool hands out at once.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (p *Pool[T]) Size() int64 {
+	return p.sem.Size()
+}
+
+// InUse returns the number of resources handed out.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (p *Pool[T]) InUse() int64 {
+	return p.sem.Current()
+}
+
+// Idle returns the number of resources kept for reuse.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (p *Pool[T]) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.free)
+}
@@ -0,0 +1,66 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	created, closed := 0, 0
+	p := NewPool(2, func(context.Context) (int, error) {
+		created++
+		return created, nil
+	}, func(int) { closed++ })
+
+	a, _ := p.Get(ctx)
+	b, _ := p.Get(ctx)
+	if a != 1 || b != 2 {
+		t.Fatalf("got %d and %d, want 1 and 2", a, b)
+	}
+
+	// The pool is exhausted until a resource is returned.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(tctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	p.Put(b)
+	if v, _ := p.Get(ctx); v != b {
+		t.Errorf("got %d, want the returned %d", v, b)
+	}
+	p.Discard(b)
+	if v, _ := p.Get(ctx); v != 3 {
+		t.Errorf("got %d, want a new 3", v)
+	}
+	p.Put(a)
+	p.Put(3)
+
+	p.Resize(1)
+	if idle := p.Idle(); idle != 1 {
+		t.Errorf("got %d idle, want 1", idle)
+	}
+	if closed != 2 {
+		t.Errorf("got %d closed, want 2", closed)
+	}
+}
+
+func TestPoolNewFails(t *testing.T) {
+	t.Parallel()
+
+	errNew := errors.New("dial failed")
+	p := NewPool(1, func(context.Context) (int, error) { return 0, errNew }, nil)
+	if _, err := p.Get(context.Background()); err != errNew {
+		t.Fatalf("got %v, want %v", err, errNew)
+	}
+	if n := p.InUse(); n != 0 {
+		t.Errorf("got %d in use after a failed creation, want 0", n)
+	}
+}
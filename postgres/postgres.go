@@ -0,0 +1,318 @@
+// Package postgres implements a weighted semaphore shared by many processes,
+// stored in PostgreSQL tables, for services that already run PostgreSQL and
+// want to bound the total concurrency of their replicas without new
+// infrastructure.
+//
+// Every acquisition is a row of a holds table with an expiry: the process
+// renews the expiry of its holds in the background, and holds that expire,
+// because their process crashed or lost its connection, are deleted by the
+// next acquisition. Admission runs in a transaction that locks the
+// semaphore's row, so it is atomic; it is not FIFO, as blocked acquisitions
+// poll.
+//
+// The package works with any database/sql driver for PostgreSQL, e.g.
+// github.com/jackc/pgx/v5/stdlib, and needs the tables of Schema.
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore/internal/holdset"
+)
+
+// Schema creates the tables shared by every semaphore of a database.
+const Schema = `
+CREATE TABLE IF NOT EXISTS semaphore_sizes (
+	name text PRIMARY KEY,
+	size bigint NOT NULL
+);
+CREATE TABLE IF NOT EXISTS semaphore_holds (
+	id         text PRIMARY KEY,
+	name       text NOT NULL,
+	weight     bigint NOT NULL,
+	expires_at timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS semaphore_holds_name ON semaphore_holds (name, expires_at);
+`
+
+// Option configures a Semaphore.
+type Option func(*Semaphore)
+
+// WithTTL sets how long holds last unless renewed, every third of it. The
+// default is 10 seconds.
+func WithTTL(d time.Duration) Option {
+	if d < time.Millisecond {
+		panic("postgres: bad ttl")
+	}
+	return func(s *Semaphore) {
+		s.ttl = d
+	}
+}
+
+// WithPollInterval sets how often a blocked Acquire retries. The default is
+// 100 milliseconds.
+func WithPollInterval(d time.Duration) Option {
+	if d <= 0 {
+		panic("postgres: bad poll interval")
+	}
+	return func(s *Semaphore) {
+		s.poll = d
+	}
+}
+
+// WithErrorHandler sets a function called with the errors of the calls that
+// can't return them: TryAcquire, Release, Resize and renewals. By default,
+// they are dropped.
+func WithErrorHandler(fn func(error)) Option {
+	return func(s *Semaphore) {
+		s.onError = fn
+	}
+}
+
+// WithOnLost sets a function called with the weight of every hold that
+// expired before it could be renewed, so its weight may already be held by
+// someone else.
+func WithOnLost(fn func(n int64)) Option {
+	return func(s *Semaphore) {
+		s.onLost = fn
+	}
+}
+
+// Semaphore is a weighted semaphore stored in PostgreSQL. Every process
+// sharing it creates its own Semaphore with the same name.
+type Semaphore struct {
+	db      *sql.DB
+	name    string
+	size    int64
+	ttl     time.Duration
+	poll    time.Duration
+	onError func(error)
+	onLost  func(n int64)
+	holds   holdset.Set
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// New creates a new Semaphore stored under name, with the given size unless
+// one was set by Resize.
+func New(db *sql.DB, name string, size int64, opts ...Option) *Semaphore {
+	s := &Semaphore{
+		db:   db,
+		name: name,
+		size: size,
+		ttl:  10 * time.Second,
+		poll: 100 * time.Millisecond,
+		stop: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	go s.renew()
+	return s
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() or the error of the database, and leaves the semaphore unchanged.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	for {
+		ok, err := s.tryAcquire(ctx, n)
+		switch {
+		case ok:
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return err
+		}
+
+		timer := time.NewTimer(s.poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including an error of the database,
+// returns false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	ok, err := s.tryAcquire(context.Background(), n)
+	if err != nil {
+		s.error(err)
+	}
+	return ok
+}
+
+func (s *Semaphore) tryAcquire(ctx context.Context, n int64) (bool, error) {
+	id := rand.Text()
+	ok, err := s.admit(ctx, id, n)
+	if err != nil {
+		return false, fmt.Errorf("postgres: acquire: %w", err)
+	}
+	if ok {
+		s.holds.Add(holdset.Hold{ID: id, N: n})
+	}
+	return ok, nil
+}
+
+// admit inserts the hold id with a weight of n if it fits, in a transaction
+// holding the lock of the semaphore's row.
+func (s *Semaphore) admit(ctx context.Context, id string, n int64) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, ensureSizeQuery, s.name, s.size); err != nil {
+		return false, err
+	}
+	var size, used int64
+	if err := tx.QueryRowContext(ctx, lockSizeQuery, s.name).Scan(&size); err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, purgeQuery, s.name); err != nil {
+		return false, err
+	}
+	if err := tx.QueryRowContext(ctx, usedQuery, s.name).Scan(&used); err != nil {
+		return false, err
+	}
+	if used+n > size {
+		return false, tx.Commit() // Keep the purge.
+	}
+	if _, err := tx.ExecContext(ctx, insertHoldQuery, id, s.name, n, s.ttl.Milliseconds()); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Release releases a hold with a weight of n. It panics if the process holds
+// none.
+func (s *Semaphore) Release(n int64) {
+	h, ok := s.holds.Take(n)
+	if !ok {
+		panic("postgres: bad release")
+	}
+	if _, err := s.db.ExecContext(context.Background(), deleteHoldQuery, h.ID); err != nil {
+		s.error(fmt.Errorf("postgres: release: %w", err))
+	}
+}
+
+// Resize sets the size of the semaphore for every process sharing it.
+func (s *Semaphore) Resize(n int64) {
+	if n < 0 {
+		panic("postgres: bad resize")
+	}
+	if _, err := s.db.ExecContext(context.Background(), resizeQuery, s.name, n); err != nil {
+		s.error(fmt.Errorf("postgres: resize: %w", err))
+	}
+}
+
+// Size returns the size of the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Size(ctx context.Context) (int64, error) {
+	size := s.size
+	err := s.db.QueryRowContext(ctx, sizeQuery, s.name).Scan(&size)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("postgres: %w", err)
+	}
+	return size, nil
+}
+
+// Current returns the weight held by every process sharing the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Current(ctx context.Context) (int64, error) {
+	var used int64
+	if err := s.db.QueryRowContext(ctx, currentQuery, s.name).Scan(&used); err != nil {
+		return 0, fmt.Errorf("postgres: %w", err)
+	}
+	return used, nil
+}
+
+// Close stops renewing the holds of the process, which then expire unless
+// they are released.
+func (s *Semaphore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// renew renews the holds of the process every third of their ttl, until
+// Close.
+func (s *Semaphore) renew() {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for _, h := range s.holds.All() {
+			res, err := s.db.ExecContext(context.Background(), renewQuery, h.ID, s.ttl.Milliseconds())
+			if err != nil {
+				s.error(fmt.Errorf("postgres: renew: %w", err))
+				continue
+			}
+			renewed, err := res.RowsAffected()
+			if err != nil {
+				s.error(fmt.Errorf("postgres: renew: %w", err))
+				continue
+			}
+			// A hold released meanwhile is gone too, but isn't lost.
+			if renewed == 0 && s.holds.Remove(h.ID) && s.onLost != nil {
+				s.onLost(h.N)
+			}
+		}
+	}
+}
+
+func (s *Semaphore) error(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// The queries use the database's clock, so the clocks of the processes
+// sharing a semaphore don't need to agree.
+const (
+	// ensureSizeQuery takes the name and the default size.
+	ensureSizeQuery = `INSERT INTO semaphore_sizes (name, size) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING`
+
+	// lockSizeQuery takes the name, and serializes admissions to it.
+	lockSizeQuery = `SELECT size FROM semaphore_sizes WHERE name = $1 FOR UPDATE`
+
+	// purgeQuery takes the name.
+	purgeQuery = `DELETE FROM semaphore_holds WHERE name = $1 AND expires_at <= now()`
+
+	// usedQuery takes the name.
+	usedQuery = `SELECT COALESCE(SUM(weight), 0) FROM semaphore_holds WHERE name = $1`
+
+	// insertHoldQuery takes the hold ID, the name, its weight and its ttl in
+	// milliseconds.
+	insertHoldQuery = `INSERT INTO semaphore_holds (id, name, weight, expires_at) VALUES ($1, $2, $3, now() + $4::bigint * interval '1 millisecond')`
+
+	// deleteHoldQuery takes the hold ID.
+	deleteHoldQuery = `DELETE FROM semaphore_holds WHERE id = $1`
+
+	// renewQuery takes the hold ID and its ttl in milliseconds, and affects no
+	// row if the hold already expired.
+	renewQuery = `UPDATE semaphore_holds SET expires_at = now() + $2::bigint * interval '1 millisecond' WHERE id = $1 AND expires_at > now()`
+
+	// resizeQuery takes the name and the new size.
+	resizeQuery = `INSERT INTO semaphore_sizes (name, size) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET size = excluded.size`
+
+	// sizeQuery takes the name.
+	sizeQuery = `SELECT size FROM semaphore_sizes WHERE name = $1`
+
+	// currentQuery takes the name.
+	currentQuery = `SELECT COALESCE(SUM(weight), 0) FROM semaphore_holds WHERE name = $1 AND expires_at > now()`
+)
@@ -0,0 +1,225 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Semaphore)(nil)
+
+// fakeDB runs the queries of the package against in-memory tables,
+// implemented in Go. Transactions don't roll back, but run one at a time, as
+// the lock of lockSizeQuery would make them.
+type fakeDB struct {
+	tx    sync.Mutex
+	mu    sync.Mutex
+	sizes map[string]int64
+	holds map[string]*fakeHold
+}
+
+type fakeHold struct {
+	name    string
+	weight  int64
+	expires time.Time
+}
+
+func newFakeDB() *sql.DB {
+	return sql.OpenDB(&fakeDB{sizes: make(map[string]int64), holds: make(map[string]*fakeHold)})
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{db}, nil }
+func (db *fakeDB) Open(string) (driver.Conn, error)             { return fakeConn{db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return db }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{c.db, query}, nil }
+func (c fakeConn) Close() error                              { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	c.db.tx.Lock()
+	return fakeTx{c.db}, nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx fakeTx) Commit() error   { tx.db.tx.Unlock(); return nil }
+func (tx fakeTx) Rollback() error { tx.db.tx.Unlock(); return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now, affected := time.Now(), int64(0)
+	switch s.query {
+	case ensureSizeQuery:
+		if _, ok := db.sizes[args[0].(string)]; !ok {
+			db.sizes[args[0].(string)] = args[1].(int64)
+			affected++
+		}
+	case resizeQuery:
+		db.sizes[args[0].(string)] = args[1].(int64)
+		affected++
+	case purgeQuery:
+		for id, h := range db.holds {
+			if h.name == args[0].(string) && !h.expires.After(now) {
+				delete(db.holds, id)
+				affected++
+			}
+		}
+	case insertHoldQuery:
+		ttl := time.Duration(args[3].(int64)) * time.Millisecond
+		db.holds[args[0].(string)] = &fakeHold{name: args[1].(string), weight: args[2].(int64), expires: now.Add(ttl)}
+		affected++
+	case deleteHoldQuery:
+		if _, ok := db.holds[args[0].(string)]; ok {
+			delete(db.holds, args[0].(string))
+			affected++
+		}
+	case renewQuery:
+		if h, ok := db.holds[args[0].(string)]; ok && h.expires.After(now) {
+			h.expires = now.Add(time.Duration(args[1].(int64)) * time.Millisecond)
+			affected++
+		}
+	default:
+		return nil, errors.New("unknown query")
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	now, name := time.Now(), args[0].(string)
+	switch s.query {
+	case lockSizeQuery, sizeQuery:
+		size, ok := db.sizes[name]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{values: []int64{size}}, nil
+	case usedQuery, currentQuery:
+		used := int64(0)
+		for _, h := range db.holds {
+			if h.name == name && (s.query == usedQuery || h.expires.After(now)) {
+				used += h.weight
+			}
+		}
+		return &fakeRows{values: []int64{used}}, nil
+	}
+	return nil, errors.New("unknown query")
+}
+
+// fakeRows has one row per value, of a single column.
+type fakeRows struct{ values []int64 }
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeDB()
+	a := New(db, "jobs", 3, WithPollInterval(time.Millisecond))
+	defer a.Close()
+	b := New(db, "jobs", 3, WithPollInterval(time.Millisecond))
+	defer b.Close()
+
+	tries := []bool{}
+	tries = append(tries, a.TryAcquire(2)) // true;  2/3
+	tries = append(tries, b.TryAcquire(2)) // false; shared with a
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	want := []bool{true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Acquire(ctx, 2) }()
+	time.Sleep(5 * time.Millisecond)
+	a.Release(2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if cur, err := a.Current(ctx); err != nil || cur != 3 {
+		t.Errorf("got current %d, %v; want 3, nil", cur, err)
+	}
+
+	a.Resize(5)
+	if size, err := b.Size(ctx); err != nil || size != 5 {
+		t.Errorf("got size %d, %v; want 5, nil", size, err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(tctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSemaphoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	sqlDB := newFakeDB()
+	ttl := 30 * time.Millisecond
+
+	// The holds of a live process are renewed.
+	live := New(sqlDB, "jobs", 1, WithTTL(ttl))
+	defer live.Close()
+	if !live.TryAcquire(1) {
+		t.Fatal("TryAcquire failed")
+	}
+	time.Sleep(3 * ttl)
+	if cur, _ := live.Current(ctx); cur != 1 {
+		t.Fatalf("got current %d, want the renewed hold", cur)
+	}
+	live.Release(1)
+
+	// Those of a crashed one expire, and are reported lost if it comes back.
+	lost := make(chan int64, 1)
+	crashed := New(sqlDB, "jobs", 1, WithTTL(ttl), WithOnLost(func(n int64) { lost <- n }))
+	defer crashed.Close()
+	if !crashed.TryAcquire(1) {
+		t.Fatal("TryAcquire failed")
+	}
+	db := sqlDB.Driver().(*fakeDB)
+	db.mu.Lock()
+	for _, h := range db.holds {
+		h.expires = time.Now()
+	}
+	db.mu.Unlock()
+	if !live.TryAcquire(1) {
+		t.Error("expired hold was not reclaimed")
+	}
+	if n := <-lost; n != 1 {
+		t.Errorf("got lost weight %d, want 1", n)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned by Acquire when it would have to wait but the
+// waiter queue is full.
+var ErrQueueFull = errors.New("semaphore: waiter queue is full")
+
+// WithPreallocatedWaiters allocates the state of n waiters, including their
+// notification channels, at construction, and bounds the queue to them: an
+// Acquire that would have to wait while n others are waiting fails immediately
+// with ErrQueueFull.
+//
+// With it, acquiring, releasing and resizing the semaphore never allocate, for
+// latency-critical code that can't afford GC pressure from synchronization.
+// Options that start timers or run callbacks, such as WithMaxWait,
+// WithProgress, WithMaxHold and WithQueueCallbacks, still allocate for their
+// own work, and so does reporting to an Instrumentation, whether set
+// WithInstrumentation or by SetInstrumentation.
+func WithPreallocatedWaiters(n int) Option {
+	if n < 0 {
+		panic("semaphore: bad preallocated waiters")
+	}
+	return func(s *Weighted) {
+		s.slots = &waiterList{}
+		waiters := make([]waiter, n)
+		for i := range waiters {
+			waiters[i].ready = make(chan struct{}, 1)
+			s.slots.PushBack(&waiters[i])
+		}
+	}
+}
+
+// waiterPool recycles the waiters, along with their ready channels, of
+// semaphores without preallocated waiters, so that a blocked Acquire doesn't
+// need to allocate either.
+var waiterPool = sync.Pool{
+	New: func() any { return &waiter{ready: make(chan struct{}, 1)} },
+}
+
+// newWaiter returns a waiter for a weight of at least n and at most max, or
+// nil if the queue is full or the preallocated waiters are all taken. Must be
+// called with s.mu held.
+func (s *Weighted) newWaiter(n, max int64) *waiter {
+	if s.queueFull() {
+		return nil
+	}
+	var w *waiter
+	if s.slots == nil {
+		w = waiterPool.Get().(*waiter)
+	} else if w = s.slots.Front(); w == nil {
+		return nil
+	} else {
+		s.slots.Remove(w)
+	}
+	w.n, w.max, w.granted, w.err, w.strict, w.priority, w.skipped, w.all = n, max, 0, nil, false, 0, 0, false
+	return w
+}
+
+// freeWaiter returns w, which has left the queue and has nothing left to
+// receive, to the preallocated waiters or to waiterPool. Must be called with
+// s.mu held if s has preallocated waiters.
+func (s *Weighted) freeWaiter(w *waiter) {
+	w.ctx = nil
+	if s.slots != nil {
+		s.slots.PushBack(w)
+	} else {
+		waiterPool.Put(w)
+	}
+}
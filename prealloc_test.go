@@ -0,0 +1,135 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWeightedPreallocatedQueueFull(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1, WithPreallocatedWaiters(1))
+	sem.Acquire(ctx, 1)
+
+	done := make(chan error)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := sem.Acquire(ctx, 1); err != ErrQueueFull {
+		t.Fatalf("Acquire with a full queue = %v, want ErrQueueFull", err)
+	}
+
+	sem.Release(1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	sem.Release(1)
+
+	// The slot is free again.
+	sem.Acquire(ctx, 1)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	sem.Release(1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWeightedPreallocatedZeroAlloc(t *testing.T) {
+	ctx := context.Background()
+	sem := NewWeighted(1, WithPreallocatedWaiters(1))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	// A helper releases the weight held by the test once the test's Acquire is
+	// queued, so every run blocks and is woken.
+	kick := make(chan struct{})
+	go func() {
+		for range kick {
+			for sem.Waiters() == 0 {
+				runtime.Gosched()
+			}
+			sem.Release(1)
+		}
+	}()
+	defer close(kick)
+
+	tries := []struct {
+		name string
+		fn   func()
+	}{
+		{"TryAcquire/Release", func() {
+			sem.TryAcquire(1)
+			sem.Release(1)
+		}},
+		{"Acquire/Release", func() {
+			sem.Acquire(ctx, 1)
+			sem.Release(1)
+		}},
+		{"Acquire blocked", func() {
+			sem.Acquire(ctx, 1)
+			kick <- struct{}{}
+			sem.Acquire(ctx, 1)
+			sem.Release(1)
+		}},
+		{"Acquire canceled", func() {
+			sem.Acquire(ctx, 1)
+			sem.Acquire(canceled, 1)
+			sem.Release(1)
+		}},
+		{"Resize", func() {
+			sem.Acquire(ctx, 1)
+			sem.Acquire(canceled, 2)
+			sem.Resize(2)
+			sem.Resize(1)
+			sem.Release(1)
+		}},
+	}
+	for i, try := range tries {
+		if allocs := testing.AllocsPerRun(100, try.fn); allocs != 0 {
+			t.Errorf("tries[%d] %s: got %v allocs, want 0", i, try.name, allocs)
+		}
+	}
+}
+
+func BenchmarkWeightedAcquireBlocked(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Pooled", nil},
+		{"Preallocated", []Option{WithPreallocatedWaiters(1)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ctx := context.Background()
+			sem := NewWeighted(1, bench.opts...)
+			sem.Acquire(ctx, 1)
+
+			// Every Acquire blocks until the helper releases the weight held
+			// before it.
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < b.N; i++ {
+					for sem.Waiters() == 0 {
+						runtime.Gosched()
+					}
+					sem.Release(1)
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sem.Acquire(ctx, 1)
+			}
+			<-done
+		})
+	}
+}
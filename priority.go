@@ -0,0 +1,74 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"time"
+)
+
+// AcquireWithPriority acquires the semaphore with a weight of n, as Acquire
+// does, ahead of queued waiters of lower priority. Acquire calls have priority
+// 0; higher values are admitted first, and waiters of equal priority in FIFO
+// order.
+//
+// Admission still never skips the waiter picked next: a high-priority waiter
+// that doesn't fit blocks the lower-priority ones, so they can't starve it.
+// Lower-priority waiters can starve under a steady stream of higher-priority
+// ones, unless the semaphore is created WithPriorityAging.
+func (s *Weighted) AcquireWithPriority(ctx context.Context, n int64, priority int) error {
+	_, err := s.acquire(ctx, request{n: n, max: n, priority: priority})
+	return err
+}
+
+// WithPriorityAging raises the priority of a queued waiter by one for every d
+// it has waited, so waiters of low priority are eventually admitted however
+// many of higher priority arrive. Without it, priorities are fixed.
+func WithPriorityAging(d time.Duration) Option {
+	if d <= 0 {
+		panic("semaphore: bad priority aging")
+	}
+	return func(s *Weighted) {
+		s.priorityAging = d
+	}
+}
+
+// effectivePriority returns the priority of w at now, including aging. Must be
+// called with s.mu held.
+func (s *Weighted) effectivePriority(w *waiter, now time.Time) float64 {
+	p := float64(w.priority)
+	if s.priorityAging > 0 {
+		p += float64(now.Sub(w.enqueued)) / float64(s.priorityAging)
+	}
+	return p
+}
+
+// highestPriority returns the queued waiter to admit next: the one of highest
+// effective priority, the earliest queued among equals, or the latest under
+// LIFO. Must be called with s.mu held and the queue non-empty.
+func (s *Weighted) highestPriority() *waiter {
+	now := time.Now()
+	best := s.waiters.Front()
+	bestPriority := s.effectivePriority(best, now)
+	for w := best.Next(); w != nil; w = w.Next() {
+		if p := s.effectivePriority(w, now); p > bestPriority || (s.lifo && p == bestPriority) {
+			best, bestPriority = w, p
+		}
+	}
+	return best
+}
+
+// outranksQueue reports whether a new request of the given priority would be
+// admitted before every queued waiter. Must be called with s.mu held.
+func (s *Weighted) outranksQueue(priority int) bool {
+	if s.scheduler != nil {
+		return false
+	}
+	if priority == 0 && !s.prioritized {
+		// Under LIFO, the newest waiter goes first.
+		return s.lifo
+	}
+	w := s.highestPriority()
+	p := s.effectivePriority(w, time.Now())
+	return float64(priority) > p || (s.lifo && float64(priority) == p)
+}
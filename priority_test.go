@@ -0,0 +1,95 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedAcquireWithPriority(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	sem.Acquire(ctx, 1)
+
+	order := make(chan int, 3)
+	for i, priority := range []int{0, 5, 1} {
+		go func(i, priority int) {
+			sem.AcquireWithPriority(ctx, 1, priority)
+			order <- i
+			sem.Release(1)
+		}(i, priority)
+		for sem.Waiters() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	var priorities []int
+	for w := range sem.Waiting {
+		priorities = append(priorities, w.Priority)
+	}
+	if len(priorities) != 3 || priorities[0] != 0 || priorities[1] != 5 || priorities[2] != 1 {
+		t.Errorf("Waiting reported priorities %v, want [0 5 1]", priorities)
+	}
+
+	sem.Release(1)
+	for _, want := range []int{1, 2, 0} {
+		if got := <-order; got != want {
+			t.Errorf("admitted waiter %d, want %d", got, want)
+		}
+	}
+}
+
+func TestWeightedPriorityOvertakesBlockedQueue(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	sem.Acquire(ctx, 1)
+	go sem.Acquire(ctx, 2) // Blocks the queue.
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := sem.AcquireWithPriority(tctx, 1, 1); err != nil {
+		t.Fatalf("high-priority Acquire waited behind a blocked queue: %v", err)
+	}
+	sem.Release(2)
+}
+
+func TestWeightedPriorityAging(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1, WithPriorityAging(time.Millisecond))
+	sem.Acquire(ctx, 1)
+
+	order := make(chan string, 2)
+	go func() {
+		sem.AcquireWithPriority(ctx, 1, 0)
+		order <- "old"
+		sem.Release(1)
+	}()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		sem.AcquireWithPriority(ctx, 1, 5)
+		order <- "new"
+		sem.Release(1)
+	}()
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sem.Release(1)
+	if first := <-order; first != "old" {
+		t.Errorf("admitted the %s waiter first, want the aged one", first)
+	}
+	<-order
+}
@@ -0,0 +1,49 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "time"
+
+// Progress describes an Acquire call that has been blocked for a while.
+type Progress struct {
+	// Weight is the weight the call asks for.
+	Weight int64
+	// Elapsed is how long the call has been blocked.
+	Elapsed time.Duration
+	// Position is the number of waiters queued ahead of the call.
+	Position int
+	// Impossible is whether the weight exceeds the semaphore's size, so the
+	// call waits for a Resize rather than for releases.
+	Impossible bool
+}
+
+// WithProgress makes blocked Acquire calls invoke fn every interval until they
+// return, so interactive tools can show progress and servers can log slow
+// admissions. fn runs on the blocked caller's goroutine.
+func WithProgress(every time.Duration, fn func(Progress)) Option {
+	if every <= 0 {
+		panic("semaphore: bad progress interval")
+	}
+	return func(s *Weighted) {
+		s.progressEvery = every
+		s.onProgress = fn
+	}
+}
+
+// progress reports the progress of w, if it is still queued.
+func (s *Weighted) progress(w *waiter) {
+	s.lock()
+	p := Progress{Weight: w.n, Elapsed: time.Since(w.enqueued)}
+	queued := w.list != nil
+	if queued {
+		for e := w.list.Front(); e != w; e = e.Next() {
+			p.Position++
+		}
+		p.Impossible = w.list == &s.impossibleWaiters
+	}
+	s.mu.Unlock()
+
+	if queued {
+		s.onProgress(p)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedProgress(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	reports := make(chan Progress, 100)
+	sem := NewWeighted(2, WithProgress(5*time.Millisecond, func(p Progress) {
+		reports <- p
+	}))
+	sem.Acquire(ctx, 2)
+
+	go sem.Acquire(ctx, 1)
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan struct{})
+	go func() {
+		sem.Acquire(ctx, 1)
+		close(done)
+	}()
+
+	var last Progress
+	for last.Position != 1 {
+		last = <-reports
+	}
+	if last.Weight != 1 || last.Elapsed <= 0 || last.Impossible {
+		t.Errorf("got %+v for the second waiter", last)
+	}
+
+	sem.Release(2)
+	<-done
+}
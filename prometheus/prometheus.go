@@ -0,0 +1,171 @@
+// Package prometheus exports the state of semaphores as Prometheus metrics.
+//
+// Collector exposes the size, usage, queue length and cumulative counters of a
+// Weighted, read from its Stats when scraped. Instrumentation records the time
+// blocked Acquire calls waited, as a histogram per semaphore name:
+//
+//	sem := semaphore.NewWeighted(10, semaphore.WithName("db"), semaphore.WithInstrumentation(inst))
+//	prometheus.MustRegister(semprom.Collector(sem, "db"), inst)
+package prometheus
+
+import (
+	"context"
+	"log/slog"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+type collector struct {
+	s     *semaphore.Weighted
+	descs struct {
+		size, inUse, waiters, peakInUse, peakWaiters *prom.Desc
+		acquires, releases, cancellations, tooLarge  *prom.Desc
+	}
+}
+
+// Collector returns a collector of the metrics of s, labeled with name as the
+// "semaphore" label:
+//
+//	semaphore_size                gauge, see Weighted.Size
+//	semaphore_in_use              gauge, see Weighted.Current
+//	semaphore_waiters             gauge, see Weighted.Waiters
+//	semaphore_peak_in_use         gauge, highest weight held at once
+//	semaphore_peak_waiters        gauge, longest queue
+//	semaphore_acquires_total      counter, successful acquisitions
+//	semaphore_releases_total      counter, Release calls
+//	semaphore_cancellations_total counter, waits abandoned by their context
+//	semaphore_too_large_total     counter, acquisitions failed for their size
+func Collector(s *semaphore.Weighted, name string) prom.Collector {
+	c := &collector{s: s}
+	labels := prom.Labels{"semaphore": name}
+	desc := func(name, help string) *prom.Desc {
+		return prom.NewDesc("semaphore_"+name, help, nil, labels)
+	}
+	c.descs.size = desc("size", "Maximum combined weight of the semaphore.")
+	c.descs.inUse = desc("in_use", "Weight currently held.")
+	c.descs.waiters = desc("waiters", "Acquire calls currently waiting.")
+	c.descs.peakInUse = desc("peak_in_use", "Highest weight held at once.")
+	c.descs.peakWaiters = desc("peak_waiters", "Most Acquire calls waiting at once.")
+	c.descs.acquires = desc("acquires_total", "Successful acquisitions.")
+	c.descs.releases = desc("releases_total", "Release calls.")
+	c.descs.cancellations = desc("cancellations_total", "Waits abandoned because their context was done.")
+	c.descs.tooLarge = desc("too_large_total", "Acquisitions failed for exceeding the size.")
+	return c
+}
+
+func (c *collector) Describe(ch chan<- *prom.Desc) {
+	for _, d := range []*prom.Desc{
+		c.descs.size, c.descs.inUse, c.descs.waiters, c.descs.peakInUse, c.descs.peakWaiters,
+		c.descs.acquires, c.descs.releases, c.descs.cancellations, c.descs.tooLarge,
+	} {
+		ch <- d
+	}
+}
+
+func (c *collector) Collect(ch chan<- prom.Metric) {
+	stats := c.s.Stats()
+	gauge := func(d *prom.Desc, v float64) {
+		ch <- prom.MustNewConstMetric(d, prom.GaugeValue, v)
+	}
+	counter := func(d *prom.Desc, v int64) {
+		ch <- prom.MustNewConstMetric(d, prom.CounterValue, float64(v))
+	}
+	gauge(c.descs.size, float64(stats.Size))
+	gauge(c.descs.inUse, float64(stats.Current))
+	gauge(c.descs.waiters, float64(stats.Waiters))
+	gauge(c.descs.peakInUse, float64(stats.PeakCurrent))
+	gauge(c.descs.peakWaiters, float64(stats.PeakWaiters))
+	counter(c.descs.acquires, stats.Acquires)
+	counter(c.descs.releases, stats.Releases)
+	counter(c.descs.cancellations, stats.Cancellations)
+	counter(c.descs.tooLarge, stats.TooLarge)
+}
+
+// Instrumentation is a semaphore.Instrumentation recording the waits of
+// blocked Acquire calls in the semaphore_wait_seconds histogram, labeled by the
+// name of the semaphore. It is also the prom.Collector of the histogram.
+//
+// It records nothing else: counters are exported by Collector, and spans and
+// logs are left to another integration.
+type Instrumentation struct {
+	wait *prom.HistogramVec
+
+	// Exemplar, if set, returns the exemplar labels of a wait observed in ctx,
+	// typically the trace ID of the waiting request, or nil for none.
+	Exemplar func(ctx context.Context) prom.Labels
+}
+
+var (
+	_ semaphore.Instrumentation  = (*Instrumentation)(nil)
+	_ semaphore.ExemplarObserver = (*Instrumentation)(nil)
+)
+
+// NewInstrumentation creates an Instrumentation with the given histogram
+// buckets, in seconds, or prom.DefBuckets if nil.
+func NewInstrumentation(buckets []float64) *Instrumentation {
+	if buckets == nil {
+		buckets = prom.DefBuckets
+	}
+	return &Instrumentation{wait: prom.NewHistogramVec(prom.HistogramOpts{
+		Name:    "semaphore_wait_seconds",
+		Help:    "Time blocked Acquire calls waited.",
+		Buckets: buckets,
+	}, []string{"semaphore"})}
+}
+
+// Logger returns nil.
+func (i *Instrumentation) Logger() *slog.Logger {
+	return nil
+}
+
+// Count does nothing.
+func (i *Instrumentation) Count(name string, delta int64, attrs ...slog.Attr) {}
+
+// Observe records a wait, if name is "semaphore.wait".
+func (i *Instrumentation) Observe(name string, value float64, attrs ...slog.Attr) {
+	i.ObserveContext(context.Background(), name, value, attrs...)
+}
+
+// ObserveContext records a wait observed in ctx, with its exemplar, if name is
+// "semaphore.wait".
+func (i *Instrumentation) ObserveContext(ctx context.Context, name string, value float64, attrs ...slog.Attr) {
+	if name != "semaphore.wait" {
+		return
+	}
+	o := i.wait.WithLabelValues(semaphoreName(attrs))
+	if i.Exemplar != nil {
+		if labels := i.Exemplar(ctx); labels != nil {
+			o.(prom.ExemplarObserver).ObserveWithExemplar(value, labels)
+			return
+		}
+	}
+	o.Observe(value)
+}
+
+// StartSpan returns a func that does nothing; it must not return nil, or the
+// semaphore wouldn't observe the wait.
+func (i *Instrumentation) StartSpan(ctx context.Context, name string, attrs ...slog.Attr) func(err error) {
+	return func(error) {}
+}
+
+// Describe implements prom.Collector.
+func (i *Instrumentation) Describe(ch chan<- *prom.Desc) {
+	i.wait.Describe(ch)
+}
+
+// Collect implements prom.Collector.
+func (i *Instrumentation) Collect(ch chan<- prom.Metric) {
+	i.wait.Collect(ch)
+}
+
+// semaphoreName returns the value of the "semaphore" attribute, or "".
+func semaphoreName(attrs []slog.Attr) string {
+	for _, a := range attrs {
+		if a.Key == "semaphore" {
+			return a.Value.String()
+		}
+	}
+	return ""
+}
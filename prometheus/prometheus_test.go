@@ -0,0 +1,81 @@
+package prometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := semaphore.NewWeighted(2)
+	sem.Acquire(ctx, 2)
+	sem.Release(1)
+	go sem.Acquire(ctx, 2)
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	want := `
+# HELP semaphore_acquires_total Successful acquisitions.
+# TYPE semaphore_acquires_total counter
+semaphore_acquires_total{semaphore="db"} 1
+# HELP semaphore_in_use Weight currently held.
+# TYPE semaphore_in_use gauge
+semaphore_in_use{semaphore="db"} 1
+# HELP semaphore_releases_total Release calls.
+# TYPE semaphore_releases_total counter
+semaphore_releases_total{semaphore="db"} 1
+# HELP semaphore_size Maximum combined weight of the semaphore.
+# TYPE semaphore_size gauge
+semaphore_size{semaphore="db"} 2
+# HELP semaphore_waiters Acquire calls currently waiting.
+# TYPE semaphore_waiters gauge
+semaphore_waiters{semaphore="db"} 1
+`
+	err := testutil.CollectAndCompare(Collector(sem, "db"), strings.NewReader(want),
+		"semaphore_acquires_total", "semaphore_in_use", "semaphore_releases_total", "semaphore_size", "semaphore_waiters")
+	if err != nil {
+		t.Error(err)
+	}
+	if problems, err := testutil.CollectAndLint(Collector(sem, "db")); err != nil || len(problems) > 0 {
+		t.Errorf("lint: %v %v", problems, err)
+	}
+	sem.Release(1)
+}
+
+func TestInstrumentation(t *testing.T) {
+	t.Parallel()
+
+	inst := NewInstrumentation([]float64{1})
+	inst.Exemplar = func(ctx context.Context) prom.Labels {
+		return prom.Labels{"trace_id": "abc"}
+	}
+	ctx := context.Background()
+	sem := semaphore.NewWeighted(1, semaphore.WithName("db"), semaphore.WithInstrumentation(inst))
+	sem.Acquire(ctx, 1)
+	done := make(chan error)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release(1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if n := testutil.CollectAndCount(inst, "semaphore_wait_seconds"); n != 1 {
+		t.Errorf("got %d wait histograms, want the one of \"db\"", n)
+	}
+	if problems, err := testutil.CollectAndLint(inst); err != nil || len(problems) > 0 {
+		t.Errorf("lint: %v %v", problems, err)
+	}
+}
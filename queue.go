@@ -0,0 +1,49 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "math/bits"
+
+// QueueBreakdown describes the distribution of the weights queued waiters ask
+// for.
+type QueueBreakdown struct {
+	// Waiters is the number of queued waiters.
+	Waiters int
+	// Weight is the combined weight of the queued waiters.
+	Weight int64
+	// Buckets[i] counts the waiters asking for a weight in (2^(i-1), 2^i], so
+	// Buckets[0] counts waiters of weight 1 or less.
+	Buckets []int
+	// Impossible counts the waiters asking for more than the semaphore's size.
+	Impossible int
+}
+
+// QueueBreakdown returns the distribution of the queued waiters' weights, which
+// tells apart many small waiters from a few that want the whole semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) QueueBreakdown() QueueBreakdown {
+	s.lock()
+	defer s.mu.Unlock()
+	var b QueueBreakdown
+	b.add(&s.waiters)
+	b.add(&s.impossibleWaiters)
+	b.Impossible = s.impossibleWaiters.Len()
+	return b
+}
+
+func (b *QueueBreakdown) add(l *waiterList) {
+	for w := l.Front(); w != nil; w = w.Next() {
+		n := w.n
+		b.Waiters++
+		b.Weight += n
+
+		i := 0
+		if n > 1 {
+			i = bits.Len64(uint64(n - 1))
+		}
+		for len(b.Buckets) <= i {
+			b.Buckets = append(b.Buckets, 0)
+		}
+		b.Buckets[i]++
+	}
+}
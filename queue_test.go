@@ -0,0 +1,82 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedQueueBreakdown(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(8)
+	sem.Acquire(ctx, 8)
+	for _, n := range []int64{1, 1, 3, 8, 9} {
+		go sem.Acquire(ctx, n)
+	}
+	for sem.Waiters() != 5 {
+		time.Sleep(time.Millisecond)
+	}
+
+	b := sem.QueueBreakdown()
+	if b.Waiters != 5 || b.Weight != 22 || b.Impossible != 1 {
+		t.Errorf("got %+v, want 5 waiters, weight 22, 1 impossible", b)
+	}
+	want := []int{2, 0, 1, 1, 1} // 1, 1 | - | 3 | 8 | 9
+	if len(b.Buckets) != len(want) {
+		t.Fatalf("got buckets %v, want %v", b.Buckets, want)
+	}
+	for i := range want {
+		if b.Buckets[i] != want[i] {
+			t.Errorf("bucket[%d]: got %d, want %d", i, b.Buckets[i], want[i])
+		}
+	}
+}
+
+func TestWeightedQueueCallbacks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	events := make(chan string, 10)
+	sem := NewWeighted(1, WithQueueCallbacks(
+		func() { events <- "blocked" },
+		func() { events <- "empty" },
+	))
+
+	sem.Acquire(ctx, 1)
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			sem.Acquire(ctx, 1)
+			sem.Release(1)
+			done <- struct{}{}
+		}()
+	}
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release(1)
+	<-done
+	<-done
+
+	// A canceled waiter empties the queue too.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	sem.Acquire(ctx, 1)
+	sem.Acquire(tctx, 1)
+
+	want := []string{"blocked", "empty", "blocked", "empty"}
+	for i, w := range want {
+		if got := <-events; got != w {
+			t.Errorf("event[%d]: got %q, want %q", i, got, w)
+		}
+	}
+	select {
+	case got := <-events:
+		t.Errorf("unexpected event %q", got)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
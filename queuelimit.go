@@ -0,0 +1,22 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// WithMaxWaiters bounds the waiter queue to n: an Acquire that would have to
+// wait while n others are waiting fails immediately with ErrQueueFull, so an
+// overloaded service sheds load instead of piling up blocked goroutines.
+// Unlike WithPreallocatedWaiters, it allocates waiters as they queue.
+func WithMaxWaiters(n int) Option {
+	if n <= 0 {
+		panic("semaphore: bad max waiters")
+	}
+	return func(s *Weighted) {
+		s.maxWaiters = n
+	}
+}
+
+// queueFull reports whether the waiter queue is at the bound set
+// WithMaxWaiters. Must be called with s.mu held.
+func (s *Weighted) queueFull() bool {
+	return s.maxWaiters > 0 && s.waiters.Len()+s.impossibleWaiters.Len() >= s.maxWaiters
+}
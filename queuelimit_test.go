@@ -0,0 +1,46 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedMaxWaiters(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2, WithMaxWaiters(2))
+	sem.Acquire(ctx, 2)
+
+	done := make(chan error, 2)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	go func() { done <- sem.Acquire(ctx, 3) }() // Impossible waiters count too.
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := sem.Acquire(ctx, 1); err != ErrQueueFull {
+		t.Errorf("Acquire with a full queue = %v, want ErrQueueFull", err)
+	}
+	if acquired, _ := sem.AcquireChan(1); <-acquired != ErrQueueFull {
+		t.Error("AcquireChan with a full queue didn't fail with ErrQueueFull")
+	}
+
+	sem.Release(1)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// There is room for one waiter again.
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Resize(6)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Quota limits acquisitions per tenant and across all tenants together: a
+// tenant may hold at most its own limit, and all tenants at most the total.
+//
+// Unlike Composite, which acquires the key and then the global semaphore, both
+// limits are charged in a single step, so a waiter holds nothing until it is
+// admitted and a canceled waiter has nothing to roll back.
+//
+// Waiters are admitted in FIFO order, except that a waiter held back only by
+// its tenant's limit doesn't hold up waiters of other tenants.
+type Quota struct {
+	total      int64
+	tenantSize int64
+	mu         sync.Mutex
+	cur        int64
+	tenants    map[string]*quotaTenant
+	waiters    list.List
+}
+
+type quotaTenant struct {
+	cur     int64
+	waiters int
+}
+
+type quotaWaiter struct {
+	t     *quotaTenant
+	n     int64
+	ready chan<- struct{} // Closed when the weight is acquired.
+}
+
+// NewQuota creates a new Quota limiting every tenant to tenantSize and all
+// tenants together to total.
+func NewQuota(total, tenantSize int64) *Quota {
+	if tenantSize < 0 || tenantSize > total {
+		panic("semaphore: bad quota limits")
+	}
+	return &Quota{total: total, tenantSize: tenantSize, tenants: make(map[string]*quotaTenant)}
+}
+
+// Acquire acquires a weight of n for tenant, blocking until both the tenant's
+// and the total limit have the resources available or ctx is done. On success,
+// returns nil. On failure, returns ctx.Err() and leaves the quota unchanged.
+func (q *Quota) Acquire(ctx context.Context, tenant string, n int64) error {
+	q.mu.Lock()
+	t := q.tenant(tenant)
+	if q.admits(t, n) {
+		q.charge(t, n)
+		q.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	t.waiters++
+	elem := q.waiters.PushBack(quotaWaiter{t: t, n: n, ready: ready})
+	q.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		q.mu.Lock()
+		select {
+		case <-ready:
+			err = nil
+		default:
+			q.waiters.Remove(elem)
+			t.waiters--
+			q.forget(tenant, t)
+			// Waiters queued behind us may fit now.
+			q.notifyWaiters()
+		}
+		q.mu.Unlock()
+		return err
+
+	case <-ready:
+		return nil
+	}
+}
+
+// TryAcquire acquires a weight of n for tenant without blocking. On success,
+// returns true. On failure, returns false and leaves the quota unchanged.
+func (q *Quota) TryAcquire(tenant string, n int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := q.tenant(tenant)
+	success := q.admits(t, n)
+	if success {
+		q.charge(t, n)
+	} else {
+		q.forget(tenant, t)
+	}
+	return success
+}
+
+// Release releases a weight of n for tenant from both limits.
+func (q *Quota) Release(tenant string, n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tenants[tenant]
+	if !ok || t.cur < n {
+		panic("semaphore: bad release")
+	}
+	q.charge(t, -n)
+	q.forget(tenant, t)
+	q.notifyWaiters()
+}
+
+// InUse returns the weight held by tenant.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (q *Quota) InUse(tenant string) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.tenants[tenant]; ok {
+		return t.cur
+	}
+	return 0
+}
+
+// Total returns the weight held by all tenants together.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (q *Quota) Total() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.cur
+}
+
+// tenant returns the state of tenant, creating it if needed. Must be called
+// with q.mu held.
+func (q *Quota) tenant(tenant string) *quotaTenant {
+	t, ok := q.tenants[tenant]
+	if !ok {
+		t = &quotaTenant{}
+		q.tenants[tenant] = t
+	}
+	return t
+}
+
+// forget removes t once it has no holders or waiters. Must be called with q.mu
+// held.
+func (q *Quota) forget(tenant string, t *quotaTenant) {
+	if t.cur == 0 && t.waiters == 0 {
+		delete(q.tenants, tenant)
+	}
+}
+
+// charge adds n, which may be negative, to the weight held by t and in total.
+// Must be called with q.mu held.
+func (q *Quota) charge(t *quotaTenant, n int64) {
+	t.cur += n
+	q.cur += n
+}
+
+// admits reports whether a new acquisition of a weight of n for t may proceed
+// without queueing: it must fit both limits and must not overtake waiters of
+// its own tenant, nor waiters held back by the total. Must be called with q.mu
+// held.
+func (q *Quota) admits(t *quotaTenant, n int64) bool {
+	for elem := q.waiters.Front(); elem != nil; elem = elem.Next() {
+		w := elem.Value.(quotaWaiter)
+		if w.t == t || w.t.cur+w.n <= q.tenantSize {
+			return false
+		}
+	}
+	return t.cur+n <= q.tenantSize && q.cur+n <= q.total
+}
+
+// notifyWaiters admits queued waiters that fit, in FIFO order. A waiter that
+// doesn't fit its tenant's limit keeps only its tenant's later waiters
+// blocked; one that doesn't fit the total keeps everyone behind it blocked.
+// Must be called with q.mu held.
+func (q *Quota) notifyWaiters() {
+	blocked := make(map[*quotaTenant]bool)
+	for elem := q.waiters.Front(); elem != nil; {
+		w := elem.Value.(quotaWaiter)
+		next := elem.Next()
+		switch {
+		case blocked[w.t]:
+		case w.t.cur+w.n > q.tenantSize:
+			blocked[w.t] = true
+		case q.cur+w.n > q.total:
+			return
+		default:
+			q.charge(w.t, w.n)
+			w.t.waiters--
+			q.waiters.Remove(elem)
+			close(w.ready)
+		}
+		elem = next
+	}
+}
@@ -0,0 +1,80 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+
+	q := NewQuota(3, 2)
+
+	tries := []bool{}
+	tries = append(tries, q.TryAcquire("a", 2)) // true;  a = 2/2, total = 2/3
+	tries = append(tries, q.TryAcquire("a", 1)) // false; a is at its limit
+	tries = append(tries, q.TryAcquire("b", 2)) // false; total would be 4/3
+	tries = append(tries, q.TryAcquire("b", 1)) // true;  b = 1/2, total = 3/3
+
+	want := []bool{true, false, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	// A canceled waiter leaves nothing behind on either limit.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Acquire(ctx, "c", 1); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if use := q.Total(); use != 3 {
+		t.Errorf("got total %d, want 3", use)
+	}
+
+	q.Release("a", 2)
+	q.Release("b", 1)
+	if use := q.Total(); use != 0 {
+		t.Errorf("got total %d, want 0", use)
+	}
+	if _, ok := q.tenants["a"]; ok {
+		t.Error("idle tenant was not forgotten")
+	}
+}
+
+func TestQuotaTenantDoesNotBlockOthers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	q := NewQuota(4, 2)
+	if !q.TryAcquire("a", 2) {
+		t.Fatal("TryAcquire failed")
+	}
+
+	// a's waiter is at its tenant limit, b's only needs the total.
+	aDone := make(chan error, 1)
+	go func() { aDone <- q.Acquire(ctx, "a", 1) }()
+	waiters := func() int {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.waiters.Len()
+	}
+	for waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := q.Acquire(ctx, "b", 2); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if in := q.InUse("a"); in != 2 {
+		t.Errorf("got a in use %d, want 2", in)
+	}
+
+	q.Release("a", 1)
+	if err := <-aDone; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
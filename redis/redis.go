@@ -0,0 +1,315 @@
+// Package redis implements a weighted semaphore shared by many processes,
+// stored in Redis, for bounding the total concurrency of the replicas of a
+// service.
+//
+// Every acquisition is a hold with a lease: the process renews the leases of
+// its holds in the background, and holds whose lease runs out, because their
+// process crashed or lost its connection, are reclaimed by the next
+// acquisition. Admission is done by Lua scripts, so it is atomic; it is not
+// FIFO, as blocked acquisitions poll.
+//
+// The package needs Redis 5 or later and works with any client through
+// Client. A semaphore's keys share a hash tag, so they work on Redis Cluster.
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore/internal/holdset"
+)
+
+// Client runs a Lua script on a Redis server and returns its result, with
+// integers as int64. It is satisfied by a small adapter of any Redis client,
+// e.g. for github.com/redis/go-redis/v9:
+//
+//	type adapter struct{ *redis.Client }
+//
+//	func (a adapter) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+//		return a.Client.Eval(ctx, script, keys, args...).Result()
+//	}
+type Client interface {
+	Eval(ctx context.Context, script string, keys []string, args ...any) (any, error)
+}
+
+// Option configures a Semaphore.
+type Option func(*Semaphore)
+
+// WithTTL sets the lease of holds, renewed every third of it. The default is
+// 10 seconds.
+func WithTTL(d time.Duration) Option {
+	if d <= 0 {
+		panic("redis: bad ttl")
+	}
+	return func(s *Semaphore) {
+		s.ttl = d
+	}
+}
+
+// WithPollInterval sets how often a blocked Acquire retries. The default is
+// 50 milliseconds.
+func WithPollInterval(d time.Duration) Option {
+	if d <= 0 {
+		panic("redis: bad poll interval")
+	}
+	return func(s *Semaphore) {
+		s.poll = d
+	}
+}
+
+// WithErrorHandler sets a function called with the errors of the calls that
+// can't return them: TryAcquire, Release, Resize and lease renewals. By
+// default, they are dropped.
+func WithErrorHandler(fn func(error)) Option {
+	return func(s *Semaphore) {
+		s.onError = fn
+	}
+}
+
+// WithOnLost sets a function called with the weight of every hold whose lease
+// ran out before it could be renewed, so its weight may already be held by
+// someone else.
+func WithOnLost(fn func(n int64)) Option {
+	return func(s *Semaphore) {
+		s.onLost = fn
+	}
+}
+
+// Semaphore is a weighted semaphore stored in Redis. Every process sharing it
+// creates its own Semaphore with the same key.
+type Semaphore struct {
+	client  Client
+	keys    []string // Holders by lease expiry, weights by holder, size.
+	size    int64
+	ttl     time.Duration
+	poll    time.Duration
+	onError func(error)
+	onLost  func(n int64)
+	holds   holdset.Set
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// New creates a new Semaphore stored under key, with the given size unless one
+// was set by Resize.
+func New(client Client, key string, size int64, opts ...Option) *Semaphore {
+	tag := "{" + key + "}"
+	s := &Semaphore{
+		client: client,
+		keys:   []string{tag + ":holders", tag + ":weights", tag + ":size"},
+		size:   size,
+		ttl:    10 * time.Second,
+		poll:   50 * time.Millisecond,
+		stop:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	go s.renew()
+	return s
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until it is
+// available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() or the error of the Redis client, and leaves the semaphore
+// unchanged.
+func (s *Semaphore) Acquire(ctx context.Context, n int64) error {
+	for {
+		ok, err := s.tryAcquire(ctx, n)
+		switch {
+		case ok:
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return err
+		}
+
+		timer := time.NewTimer(s.poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking. On
+// success, returns true. On failure, including an error of the Redis client,
+// returns false and leaves the semaphore unchanged.
+func (s *Semaphore) TryAcquire(n int64) bool {
+	ok, err := s.tryAcquire(context.Background(), n)
+	if err != nil {
+		s.error(err)
+	}
+	return ok
+}
+
+func (s *Semaphore) tryAcquire(ctx context.Context, n int64) (bool, error) {
+	id := rand.Text()
+	res, err := s.client.Eval(ctx, acquireScript, s.keys, id, n, s.ttl.Milliseconds(), s.size)
+	if err != nil {
+		return false, fmt.Errorf("redis: acquire: %w", err)
+	}
+	if res != int64(1) {
+		return false, nil
+	}
+	s.holds.Add(holdset.Hold{ID: id, N: n})
+	return true, nil
+}
+
+// Release releases a hold with a weight of n. It panics if the process holds
+// none.
+func (s *Semaphore) Release(n int64) {
+	h, ok := s.holds.Take(n)
+	if !ok {
+		panic("redis: bad release")
+	}
+	if _, err := s.client.Eval(context.Background(), releaseScript, s.keys, h.ID); err != nil {
+		s.error(fmt.Errorf("redis: release: %w", err))
+	}
+}
+
+// Resize sets the size of the semaphore for every process sharing it.
+func (s *Semaphore) Resize(n int64) {
+	if n < 0 {
+		panic("redis: bad resize")
+	}
+	if _, err := s.client.Eval(context.Background(), resizeScript, s.keys, n); err != nil {
+		s.error(fmt.Errorf("redis: resize: %w", err))
+	}
+}
+
+// Size returns the size of the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Size(ctx context.Context) (int64, error) {
+	return s.read(ctx, sizeScript)
+}
+
+// Current returns the weight held by every process sharing the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Semaphore) Current(ctx context.Context) (int64, error) {
+	return s.read(ctx, currentScript)
+}
+
+func (s *Semaphore) read(ctx context.Context, script string) (int64, error) {
+	res, err := s.client.Eval(ctx, script, s.keys, s.size)
+	if err != nil {
+		return 0, fmt.Errorf("redis: %w", err)
+	}
+	n, ok := res.(int64)
+	if !ok {
+		return 0, errors.New("redis: unexpected script result")
+	}
+	return n, nil
+}
+
+// Close stops renewing the leases of the holds of the process, which then
+// expire unless they are released.
+func (s *Semaphore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// renew renews the leases of the holds of the process every third of their
+// ttl, until Close.
+func (s *Semaphore) renew() {
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		for _, h := range s.holds.All() {
+			res, err := s.client.Eval(context.Background(), renewScript, s.keys, h.ID, s.ttl.Milliseconds())
+			if err != nil {
+				s.error(fmt.Errorf("redis: renew: %w", err))
+				continue
+			}
+			// A hold released meanwhile is gone too, but isn't lost.
+			if res != int64(1) && s.holds.Remove(h.ID) && s.onLost != nil {
+				s.onLost(h.N)
+			}
+		}
+	}
+}
+
+func (s *Semaphore) error(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// The scripts take the keys of a semaphore: KEYS[1] is a sorted set of the
+// holders by the expiry of their lease, in milliseconds of the server's clock,
+// KEYS[2] a hash of the holders' weights, and KEYS[3] the size set by Resize.
+
+// purge removes the holders whose lease expired and sets now to the server's
+// time.
+const purge = `
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+for _, id in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now)) do
+	redis.call('HDEL', KEYS[2], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+local function used()
+	local sum = 0
+	for _, w in ipairs(redis.call('HVALS', KEYS[2])) do
+		sum = sum + tonumber(w)
+	end
+	return sum
+end
+`
+
+// acquireScript takes the holder ID, its weight, its ttl and the default size.
+const acquireScript = purge + `
+local size = tonumber(redis.call('GET', KEYS[3]) or ARGV[4])
+if used() + tonumber(ARGV[2]) > size then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[3]), ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[2])
+return 1
+`
+
+// releaseScript takes the holder ID.
+const releaseScript = `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 1 then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+end
+return 1
+`
+
+// renewScript takes the holder ID and its ttl, and returns 0 if its lease
+// already expired.
+const renewScript = purge + `
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[2]), ARGV[1])
+return 1
+`
+
+// resizeScript takes the new size.
+const resizeScript = `
+redis.call('SET', KEYS[3], ARGV[1])
+return 1
+`
+
+// sizeScript takes the default size.
+const sizeScript = `
+return tonumber(redis.call('GET', KEYS[3]) or ARGV[1])
+`
+
+// currentScript ignores its arguments.
+const currentScript = purge + `
+return used()
+`
@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+var _ semaphore.AcquireReleaser = (*Semaphore)(nil)
+
+// fakeRedis runs the scripts of the package against an in-memory copy of the
+// keys they use, implemented in Go.
+type fakeRedis struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	weights map[string]int64
+	size    *int64
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{expires: make(map[string]time.Time), weights: make(map[string]int64)}
+}
+
+func (r *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range r.expires {
+		if !exp.After(now) {
+			delete(r.expires, id)
+			delete(r.weights, id)
+		}
+	}
+	used := int64(0)
+	for _, w := range r.weights {
+		used += w
+	}
+
+	switch script {
+	case acquireScript:
+		id, n, ttl, size := args[0].(string), args[1].(int64), args[2].(int64), args[3].(int64)
+		if r.size != nil {
+			size = *r.size
+		}
+		if used+n > size {
+			return int64(0), nil
+		}
+		r.expires[id] = now.Add(time.Duration(ttl) * time.Millisecond)
+		r.weights[id] = n
+	case releaseScript:
+		delete(r.expires, args[0].(string))
+		delete(r.weights, args[0].(string))
+	case renewScript:
+		id, ttl := args[0].(string), args[1].(int64)
+		if _, ok := r.expires[id]; !ok {
+			return int64(0), nil
+		}
+		r.expires[id] = now.Add(time.Duration(ttl) * time.Millisecond)
+	case resizeScript:
+		size := args[0].(int64)
+		r.size = &size
+	case sizeScript:
+		if r.size != nil {
+			return *r.size, nil
+		}
+		return args[0], nil
+	case currentScript:
+		return used, nil
+	default:
+		return nil, errors.New("unknown script")
+	}
+	return int64(1), nil
+}
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+	r := newFakeRedis()
+	a := New(r, "jobs", 3, WithPollInterval(time.Millisecond))
+	defer a.Close()
+	b := New(r, "jobs", 3, WithPollInterval(time.Millisecond))
+	defer b.Close()
+
+	tries := []bool{}
+	tries = append(tries, a.TryAcquire(2)) // true;  2/3
+	tries = append(tries, b.TryAcquire(2)) // false; shared with a
+	tries = append(tries, b.TryAcquire(1)) // true;  3/3
+
+	want := []bool{true, false, true}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+
+	done := make(chan error)
+	go func() { done <- b.Acquire(ctx, 2) }()
+	time.Sleep(5 * time.Millisecond)
+	a.Release(2)
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if cur, err := a.Current(ctx); err != nil || cur != 3 {
+		t.Errorf("got current %d, %v; want 3, nil", cur, err)
+	}
+
+	a.Resize(5)
+	if size, err := b.Size(ctx); err != nil || size != 5 {
+		t.Errorf("got size %d, %v; want 5, nil", size, err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := a.Acquire(tctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSemaphoreLease(t *testing.T) {
+	ctx := context.Background()
+	r := newFakeRedis()
+	ttl := 30 * time.Millisecond
+
+	// The leases of a live process are renewed.
+	live := New(r, "jobs", 1, WithTTL(ttl))
+	defer live.Close()
+	if !live.TryAcquire(1) {
+		t.Fatal("TryAcquire failed")
+	}
+	time.Sleep(3 * ttl)
+	if cur, _ := live.Current(ctx); cur != 1 {
+		t.Fatalf("got current %d, want the renewed hold", cur)
+	}
+	live.Release(1)
+
+	// Those of a dead one expire, and are reported lost if it comes back.
+	lost := make(chan int64, 1)
+	dead := New(r, "jobs", 1, WithTTL(ttl), WithOnLost(func(n int64) { lost <- n }))
+	defer dead.Close()
+	if !dead.TryAcquire(1) {
+		t.Fatal("TryAcquire failed")
+	}
+	r.mu.Lock()
+	for id := range r.expires {
+		r.expires[id] = time.Now()
+	}
+	r.mu.Unlock()
+	if cur, _ := live.Current(ctx); cur != 0 {
+		t.Errorf("got current %d, want the expired hold reclaimed", cur)
+	}
+	if n := <-lost; n != 1 {
+		t.Errorf("got lost weight %d, want 1", n)
+	}
+}
@@ -0,0 +1,102 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// Reservation is a pending acquisition of a semaphore, made by Reserve. Like a
+// reservation of a rate.Limiter, it lets the caller decide later whether to
+// wait for it, with its own timers, or to abandon it.
+type Reservation struct {
+	s      *Weighted
+	n      int64
+	ready  chan struct{}
+	result <-chan error
+	cancel func() bool
+
+	mu       sync.Mutex
+	decided  bool
+	err      error
+	canceled bool
+}
+
+// Reserve reserves a weight of n without blocking, queueing like Acquire if it
+// isn't available. Once the reservation is Ready and OK, the caller holds the
+// weight, and gives it back with Cancel.
+//
+// Like AcquireChan, which it is built on, it neither needs a goroutine per
+// reservation nor a context.
+func (s *Weighted) Reserve(n int64) *Reservation {
+	r := &Reservation{s: s, n: n, ready: make(chan struct{})}
+	result := make(chan error, 1)
+	r.result = result
+	r.cancel = s.acquireNotify(n, func(err error) {
+		result <- err
+		close(r.ready)
+	})
+	return r
+}
+
+// Ready returns a channel that is closed once the reservation is decided:
+// granted, failed, or canceled. Check OK after it is closed.
+func (r *Reservation) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// OK reports whether the reservation was granted or may still be: it is false
+// once it has failed, e.g. with ErrQueueFull, a *StateError or
+// ErrRequestTooLarge, or was canceled while waiting, in which case Err is
+// context.Canceled.
+func (r *Reservation) OK() bool {
+	decided, err := r.outcome()
+	return !decided || err == nil
+}
+
+// Err returns why the reservation failed, or nil if it was granted or is still
+// waiting.
+func (r *Reservation) Err() error {
+	_, err := r.outcome()
+	return err
+}
+
+// Cancel abandons the reservation: it withdraws it if still waiting, and
+// releases the weight if it was granted. Calls after the first do nothing.
+func (r *Reservation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.canceled {
+		return
+	}
+	r.canceled = true
+	if !r.cancel() {
+		r.s.Release(r.n)
+		return
+	}
+	// Failed, or withdrawn, in which case no error will be received.
+	if !r.decided {
+		r.decided = true
+		select {
+		case r.err = <-r.result:
+		default:
+			r.err = context.Canceled
+			close(r.ready)
+		}
+	}
+}
+
+// outcome returns whether the reservation is decided, and its error if so.
+func (r *Reservation) outcome() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.decided {
+		select {
+		case r.err = <-r.result:
+			r.decided = true
+		default:
+		}
+	}
+	return r.decided, r.err
+}
@@ -0,0 +1,71 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWeightedReserve(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	r := sem.Reserve(2)
+	<-r.Ready()
+	if !r.OK() || r.Err() != nil {
+		t.Fatalf("immediate reservation: OK() = %t, Err() = %v", r.OK(), r.Err())
+	}
+
+	waiting := sem.Reserve(1)
+	select {
+	case <-waiting.Ready():
+		t.Fatal("reservation of a full semaphore is ready")
+	default:
+	}
+	if !waiting.OK() {
+		t.Error("waiting reservation isn't OK")
+	}
+	r.Cancel() // Releases the weight, granting the waiting reservation.
+	r.Cancel()
+	<-waiting.Ready()
+	if !waiting.OK() {
+		t.Fatalf("granted reservation failed: %v", waiting.Err())
+	}
+	if cur := sem.Current(); cur != 1 {
+		t.Errorf("got current %d, want 1", cur)
+	}
+
+	// Withdrawing a waiting reservation leaves the semaphore unchanged.
+	sem.Acquire(context.Background(), 1)
+	withdrawn := sem.Reserve(1)
+	withdrawn.Cancel()
+	<-withdrawn.Ready()
+	if withdrawn.OK() || withdrawn.Err() != context.Canceled {
+		t.Errorf("withdrawn reservation: OK() = %t, Err() = %v", withdrawn.OK(), withdrawn.Err())
+	}
+	waiting.Cancel()
+	if cur, n := sem.Current(), sem.Waiters(); cur != 1 || n != 0 {
+		t.Errorf("got current %d and %d waiters, want 1 and 0", cur, n)
+	}
+}
+
+func TestWeightedReserveFailed(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1, WithMaxWaiters(1))
+	sem.Acquire(context.Background(), 1)
+	queued := sem.Reserve(1)
+	full := sem.Reserve(1)
+	<-full.Ready()
+	if full.OK() || full.Err() != ErrQueueFull {
+		t.Errorf("reservation of a full queue: OK() = %t, Err() = %v", full.OK(), full.Err())
+	}
+	full.Cancel()
+
+	sem.Close(nil)
+	<-queued.Ready()
+	if queued.OK() || queued.Err() != ErrClosed {
+		t.Errorf("reservation of a closed semaphore: OK() = %t, Err() = %v", queued.OK(), queued.Err())
+	}
+}
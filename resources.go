@@ -0,0 +1,180 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownResource is returned when a request names a resource that was not
+// added to the ResourceManager.
+var ErrUnknownResource = errors.New("semaphore: unknown resource")
+
+// ResourceManager acquires weights on several named semaphores as a unit.
+//
+// Resources are always acquired in the same canonical (lexical) order, so
+// callers whose requests overlap can't deadlock each other regardless of the
+// order they list resources in.
+type ResourceManager struct {
+	mu        sync.Mutex
+	resources map[string]*Weighted
+}
+
+// ResourceSet is a set of weights held on the resources of a ResourceManager.
+type ResourceSet struct {
+	mu    sync.Mutex
+	held  []heldResource
+	freed bool
+}
+
+type heldResource struct {
+	sem *Weighted
+	n   int64
+}
+
+// NewResourceManager creates a new ResourceManager with no resources.
+func NewResourceManager() *ResourceManager {
+	return &ResourceManager{resources: make(map[string]*Weighted)}
+}
+
+// Add adds sem to the manager under name, replacing any resource previously
+// added with the same name. Add panics if sem was already added under another
+// name, as requests naming both would acquire it twice, out of order.
+func (m *ResourceManager) Add(name string, sem *Weighted) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for other, s := range m.resources {
+		if s == sem && other != name {
+			panic("semaphore: resource added twice")
+		}
+	}
+	m.resources[name] = sem
+}
+
+// Resource returns the semaphore added under name.
+func (m *ResourceManager) Resource(name string) (*Weighted, bool) {
+	m.mu.Lock()
+	sem, ok := m.resources[name]
+	m.mu.Unlock()
+	return sem, ok
+}
+
+// Acquire acquires the requested weight of every named resource, blocking until
+// all of them are available or ctx is done. On success, returns the held set.
+// On failure, returns ctx.Err() and releases whatever was acquired so far.
+func (m *ResourceManager) Acquire(ctx context.Context, req map[string]int64) (*ResourceSet, error) {
+	held, err := m.resolve(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, h := range held {
+		if err := h.sem.Acquire(ctx, h.n); err != nil {
+			releaseHeld(held[:i])
+			report(currentInstrumentation(), "semaphore.resources.failures", 1)
+			return nil, err
+		}
+	}
+	report(currentInstrumentation(), "semaphore.resources.acquires", 1)
+	return &ResourceSet{held: held}, nil
+}
+
+// TryAcquire acquires the requested weight of every named resource without
+// blocking. On success, returns the held set and true. On failure, returns false
+// and leaves every resource unchanged.
+func (m *ResourceManager) TryAcquire(req map[string]int64) (*ResourceSet, bool) {
+	held, err := m.resolve(req)
+	if err != nil {
+		return nil, false
+	}
+
+	for i, h := range held {
+		if !h.sem.TryAcquire(h.n) {
+			releaseHeld(held[:i])
+			return nil, false
+		}
+	}
+	report(currentInstrumentation(), "semaphore.resources.acquires", 1)
+	return &ResourceSet{held: held}, true
+}
+
+// AcquireWithBackoff repeatedly tries to acquire the requested weights without
+// holding any of them while waiting, sleeping between attempts for a duration
+// starting at minBackoff and doubling up to maxBackoff. It is an alternative to
+// Acquire for callers that must not hold part of a request while blocked.
+//
+// On failure, returns ctx.Err() and leaves every resource unchanged. Panics if
+// minBackoff is not positive or maxBackoff is less than minBackoff.
+func (m *ResourceManager) AcquireWithBackoff(ctx context.Context, req map[string]int64, minBackoff, maxBackoff time.Duration) (*ResourceSet, error) {
+	if minBackoff <= 0 || maxBackoff < minBackoff {
+		panic("semaphore: bad backoff")
+	}
+	if _, err := m.resolve(req); err != nil {
+		return nil, err
+	}
+
+	backoff := minBackoff
+	for {
+		if set, ok := m.TryAcquire(req); ok {
+			return set, nil
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			report(currentInstrumentation(), "semaphore.resources.failures", 1)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// resolve maps req to its resources in canonical order.
+func (m *ResourceManager) resolve(req map[string]int64) ([]heldResource, error) {
+	names := make([]string, 0, len(req))
+	for name := range req {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	held := make([]heldResource, 0, len(names))
+	for _, name := range names {
+		sem, ok := m.resources[name]
+		if !ok {
+			return nil, ErrUnknownResource
+		}
+		held = append(held, heldResource{sem: sem, n: req[name]})
+	}
+	return held, nil
+}
+
+// Release releases every weight held by the set. Releasing a set more than once
+// panics.
+func (r *ResourceSet) Release() {
+	r.mu.Lock()
+	if r.freed {
+		r.mu.Unlock()
+		panic("semaphore: resource set released twice")
+	}
+	r.freed = true
+	r.mu.Unlock()
+	releaseHeld(r.held)
+}
+
+// releaseHeld releases held in reverse acquisition order.
+func releaseHeld(held []heldResource) {
+	for i := len(held) - 1; i >= 0; i-- {
+		held[i].sem.Release(held[i].n)
+	}
+}
@@ -0,0 +1,130 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestResourceManager() *ResourceManager {
+	m := NewResourceManager()
+	m.Add("cpu", NewWeighted(2))
+	m.Add("mem", NewWeighted(4))
+	return m
+}
+
+// TestResourceManagerNoDeadlock times out if requests listing the same
+// resources deadlock each other.
+// Merely returning from the test function indicates success.
+func TestResourceManagerNoDeadlock(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := newTestResourceManager()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := map[string]int64{"cpu": 2, "mem": 1}
+			if i%2 == 0 {
+				req = map[string]int64{"mem": 4, "cpu": 1}
+			}
+			set, err := m.Acquire(ctx, req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(100 * time.Microsecond)
+			set.Release()
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResourceManagerRollback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := newTestResourceManager()
+	mem, _ := m.Resource("mem")
+	mem.Acquire(ctx, 4)
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.Acquire(tctx, map[string]int64{"cpu": 2, "mem": 1}); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, ok := m.TryAcquire(map[string]int64{"cpu": 1, "mem": 1}); ok {
+		t.Fatal("TryAcquire succeeded on a full resource")
+	}
+
+	cpu, _ := m.Resource("cpu")
+	if cur := cpu.Current(); cur != 0 {
+		t.Errorf("failed acquisitions left cpu at %d, want 0", cur)
+	}
+
+	if _, err := m.Acquire(ctx, map[string]int64{"gpu": 1}); err != ErrUnknownResource {
+		t.Errorf("got %v, want %v", err, ErrUnknownResource)
+	}
+}
+
+func TestResourceManagerBackoff(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := newTestResourceManager()
+	set, _ := m.TryAcquire(map[string]int64{"cpu": 2})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		set.Release()
+	}()
+
+	got, err := m.AcquireWithBackoff(ctx, map[string]int64{"cpu": 1, "mem": 1}, time.Millisecond, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Release()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("double release of a resource set did not panic")
+		}
+	}()
+	got.Release()
+}
+
+func TestResourceManagerPanics(t *testing.T) {
+	t.Parallel()
+
+	m := NewResourceManager()
+	sem := NewWeighted(1)
+	m.Add("cpu", sem)
+	m.Add("cpu", sem)
+
+	tries := []struct {
+		name string
+		f    func()
+	}{
+		{"same semaphore under two names", func() { m.Add("mem", sem) }},
+		{"zero backoff", func() { m.AcquireWithBackoff(context.Background(), map[string]int64{"cpu": 1}, 0, time.Second) }},
+		{"inverted backoff", func() {
+			m.AcquireWithBackoff(context.Background(), map[string]int64{"cpu": 1}, time.Second, time.Millisecond)
+		}},
+	}
+	for i, try := range tries {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("tries[%d]: %s did not panic", i, try.name)
+				}
+			}()
+			try.f()
+		}()
+	}
+}
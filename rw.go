@@ -0,0 +1,208 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// RWWeighted is a read-write semaphore: up to its size of readers may hold it
+// at once, or a single writer, excluding every reader.
+//
+// It packages the pattern of readers acquiring a weight of 1 and writers the
+// whole size, but a writer excludes readers regardless of the size, so a
+// Resize while a writer holds or waits never lets readers in beside it.
+//
+// Readers and writers are admitted in FIFO order, so a waiting writer isn't
+// starved by a stream of readers.
+type RWWeighted struct {
+	mu      sync.Mutex
+	size    int64
+	readers int64
+	writer  bool
+	waiters list.List
+}
+
+type rwWaiter struct {
+	write bool
+	ready chan<- struct{} // Closed when the lock is acquired.
+}
+
+// NewRWWeighted creates a new RWWeighted admitting up to size readers at once.
+func NewRWWeighted(size int64) *RWWeighted {
+	if size < 0 {
+		panic("semaphore: bad size")
+	}
+	return &RWWeighted{size: size}
+}
+
+// RLock acquires the semaphore for reading, blocking until no writer holds or
+// is queued ahead and fewer than size readers hold it, or ctx is done. On
+// success, returns nil. On failure, returns ctx.Err() and leaves the semaphore
+// unchanged.
+func (s *RWWeighted) RLock(ctx context.Context) error {
+	return s.lock(ctx, false)
+}
+
+// TryRLock acquires the semaphore for reading without blocking. On success,
+// returns true. On failure, returns false and leaves the semaphore unchanged.
+func (s *RWWeighted) TryRLock() bool {
+	return s.tryLock(false)
+}
+
+// RUnlock releases a read hold of the semaphore.
+func (s *RWWeighted) RUnlock() {
+	s.mu.Lock()
+	if s.readers == 0 {
+		s.mu.Unlock()
+		panic("semaphore: bad release")
+	}
+	s.readers--
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// Lock acquires the semaphore for writing, blocking until nobody holds it and
+// nobody is queued ahead, or ctx is done. On success, returns nil. On failure,
+// returns ctx.Err() and leaves the semaphore unchanged.
+func (s *RWWeighted) Lock(ctx context.Context) error {
+	return s.lock(ctx, true)
+}
+
+// TryLock acquires the semaphore for writing without blocking. On success,
+// returns true. On failure, returns false and leaves the semaphore unchanged.
+func (s *RWWeighted) TryLock() bool {
+	return s.tryLock(true)
+}
+
+// Unlock releases the write hold of the semaphore.
+func (s *RWWeighted) Unlock() {
+	s.mu.Lock()
+	if !s.writer {
+		s.mu.Unlock()
+		panic("semaphore: bad release")
+	}
+	s.writer = false
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// Resize sets the number of readers that may hold the semaphore at once.
+// Readers beyond a smaller size keep their hold; new readers wait until enough
+// of them release.
+func (s *RWWeighted) Resize(size int64) {
+	if size < 0 {
+		panic("semaphore: bad resize")
+	}
+	s.mu.Lock()
+	s.size = size
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// Size returns the number of readers that may hold the semaphore at once.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *RWWeighted) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Readers returns the number of readers holding the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *RWWeighted) Readers() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readers
+}
+
+// Waiters returns the number of currently waiting RLock and Lock calls.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *RWWeighted) Waiters() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waiters.Len()
+}
+
+func (s *RWWeighted) lock(ctx context.Context, write bool) error {
+	s.mu.Lock()
+	if s.waiters.Len() == 0 && s.fits(write) {
+		s.grant(write)
+		s.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := s.waiters.PushBack(rwWaiter{write: write, ready: ready})
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		s.mu.Lock()
+		select {
+		case <-ready:
+			err = nil
+		default:
+			s.waiters.Remove(elem)
+			// Readers queued behind a canceled writer may fit now.
+			s.notifyWaiters()
+		}
+		s.mu.Unlock()
+		return err
+
+	case <-ready:
+		return nil
+	}
+}
+
+func (s *RWWeighted) tryLock(write bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	success := s.waiters.Len() == 0 && s.fits(write)
+	if success {
+		s.grant(write)
+	}
+	return success
+}
+
+// fits reports whether a reader, or a writer if write, can hold the semaphore
+// now. Must be called with s.mu held.
+func (s *RWWeighted) fits(write bool) bool {
+	if write {
+		return !s.writer && s.readers == 0
+	}
+	return !s.writer && s.readers < s.size
+}
+
+// grant gives a reader, or a writer if write, its hold. Must be called with
+// s.mu held.
+func (s *RWWeighted) grant(write bool) {
+	if write {
+		s.writer = true
+	} else {
+		s.readers++
+	}
+}
+
+// notifyWaiters admits queued waiters in FIFO order while they fit. Must be
+// called with s.mu held.
+func (s *RWWeighted) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			break // No more waiters blocked.
+		}
+
+		w := next.Value.(rwWaiter)
+		if !s.fits(w.write) {
+			break
+		}
+
+		s.grant(w.write)
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
@@ -0,0 +1,95 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRWWeighted(t *testing.T) {
+	t.Parallel()
+
+	s := NewRWWeighted(2)
+
+	tries := []bool{}
+	tries = append(tries, s.TryRLock()) // true;  1/2 readers
+	tries = append(tries, s.TryRLock()) // true;  2/2 readers
+	tries = append(tries, s.TryRLock()) // false; readers are full
+	tries = append(tries, s.TryLock())  // false; readers hold it
+	s.RUnlock()
+	s.RUnlock()
+	tries = append(tries, s.TryLock())  // true;  nobody holds it
+	tries = append(tries, s.TryRLock()) // false; the writer holds it
+
+	want := []bool{true, true, false, false, true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+	s.Unlock()
+}
+
+func TestRWWeightedResizeWhileWriting(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewRWWeighted(1)
+	if err := s.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Growing the semaphore must not let a reader in beside the writer.
+	s.Resize(3)
+	if s.TryRLock() {
+		t.Fatal("reader admitted while the writer holds")
+	}
+
+	done := make(chan error)
+	go func() { done <- s.RLock(ctx) }()
+	for s.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	s.Unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	s.RUnlock()
+}
+
+func TestRWWeightedWriterNotStarved(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewRWWeighted(2)
+	s.TryRLock()
+
+	writer := make(chan error)
+	go func() { writer <- s.Lock(ctx) }()
+	for s.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// With a writer queued, new readers wait behind it.
+	if s.TryRLock() {
+		t.Fatal("reader overtook the queued writer")
+	}
+
+	s.RUnlock()
+	if err := <-writer; err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+
+	// A reader timing out behind the writer leaves nothing behind.
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := s.RLock(tctx); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	s.Unlock()
+	if r := s.Readers(); r != 0 {
+		t.Errorf("got %d readers, want 0", r)
+	}
+}
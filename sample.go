@@ -0,0 +1,27 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "sync/atomic"
+
+// Sampler decides which events to record so instrumentation can stay enabled
+// in hot paths: it selects one in every N events. The zero value and a nil
+// *Sampler select every event. A Sampler is safe for concurrent use.
+type Sampler struct {
+	every uint64
+	count uint64
+}
+
+// NewSampler creates a new Sampler selecting one in every events. An every of
+// 0 or 1 selects every event.
+func NewSampler(every uint64) *Sampler {
+	return &Sampler{every: every}
+}
+
+// Sample reports whether the current event should be recorded.
+func (s *Sampler) Sample() bool {
+	if s == nil || s.every <= 1 {
+		return true
+	}
+	return atomic.AddUint64(&s.count, 1)%s.every == 1
+}
@@ -0,0 +1,28 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "testing"
+
+func TestSampler(t *testing.T) {
+	t.Parallel()
+
+	var nilSampler *Sampler
+	for _, s := range []*Sampler{nilSampler, NewSampler(0), NewSampler(1)} {
+		if !s.Sample() || !s.Sample() {
+			t.Errorf("sampler %+v skipped an event", s)
+		}
+	}
+
+	s := NewSampler(4)
+	var got []bool
+	for i := 0; i < 8; i++ {
+		got = append(got, s.Sample())
+	}
+	want := []bool{true, false, false, false, true, false, false, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sample[%d]: got %t, want %t", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// Scheduler decides which queued waiter a Weighted admits next, in place of
+// FIFO order. It is a hook for deterministic test drivers exploring the
+// interleavings of code built on the semaphore, not a production queue policy.
+type Scheduler interface {
+	// Pick returns the position of the waiter to admit next, given the weights
+	// of the queued waiters in arrival order and the weight available, or -1
+	// to admit none until Reschedule is called. The picked waiter's weight must
+	// be available.
+	//
+	// Pick is called with the semaphore's lock held and must not call its
+	// methods. The queued slice is reused, and must not be retained.
+	Pick(queued []int64, available int64) int
+}
+
+// WithScheduler makes the semaphore ask sched which waiter to admit whenever
+// it would admit one. Acquisitions that find the semaphore available with no
+// waiters are still admitted immediately.
+func WithScheduler(sched Scheduler) Option {
+	return func(s *Weighted) {
+		s.scheduler = sched
+	}
+}
+
+// Reschedule asks the scheduler again which waiters to admit, after it
+// deferred a decision or after its driver changed its mind. It does nothing
+// without a scheduler.
+func (s *Weighted) Reschedule() {
+	s.lock()
+	if s.scheduler != nil {
+		s.notifyWaiters()
+	}
+	s.unlock()
+}
+
+// schedule returns the waiter picked by the scheduler, or nil. Must be called
+// with s.mu held.
+func (s *Weighted) schedule() *waiter {
+	// The buffer is reused, so scheduling doesn't allocate once it has grown
+	// to the queue's length.
+	queued := s.scheduled[:0]
+	for w := s.waiters.Front(); w != nil; w = w.Next() {
+		queued = append(queued, w.n)
+	}
+	s.scheduled = queued
+
+	i := s.scheduler.Pick(queued, s.size-s.cur)
+	if i < 0 {
+		return nil
+	}
+	if i >= len(queued) || queued[i] > s.size-s.cur {
+		s.mu.Unlock()
+		panic("semaphore: bad schedule")
+	}
+	w := s.waiters.Front()
+	for ; i > 0; i-- {
+		w = w.Next()
+	}
+	return w
+}
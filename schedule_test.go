@@ -0,0 +1,106 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// scriptedScheduler picks waiters by position from a script, deferring once
+// the script runs out.
+type scriptedScheduler struct {
+	picks []int
+}
+
+func (s *scriptedScheduler) Pick(queued []int64, available int64) int {
+	if len(s.picks) == 0 {
+		return -1
+	}
+	i := s.picks[0]
+	s.picks = s.picks[1:]
+	return i
+}
+
+func TestWeightedScheduler(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sched := &scriptedScheduler{}
+	sem := NewWeighted(1, WithScheduler(sched))
+	sem.Acquire(ctx, 1)
+
+	admitted := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			sem.Acquire(ctx, 1)
+			admitted <- i
+		}(i)
+		for sem.Waiters() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// With nothing scripted, a release admits nobody.
+	sem.Release(1)
+	if n := sem.Waiters(); n != 3 {
+		t.Fatalf("Waiters() = %d after deferred decision, want 3", n)
+	}
+
+	// Admit the waiters in reverse order of arrival.
+	want := []int{2, 1, 0}
+	for _, i := range want {
+		sched.picks = []int{i}
+		sem.Reschedule()
+		if got := <-admitted; got != i {
+			t.Fatalf("admitted waiter %d, want %d", got, i)
+		}
+		sem.Release(1)
+	}
+}
+
+func TestWeightedSchedulerBadPick(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1, WithScheduler(&scriptedScheduler{picks: []int{5}}))
+	sem.Acquire(ctx, 1)
+	go sem.Acquire(ctx, 1)
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("picking a waiter that doesn't exist did not panic")
+		}
+	}()
+	sem.Release(1)
+}
+
+// deferringScheduler never admits anyone.
+type deferringScheduler struct{}
+
+func (deferringScheduler) Pick(queued []int64, available int64) int { return -1 }
+
+func TestWeightedScheduleZeroAlloc(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sem := NewWeighted(0, WithScheduler(deferringScheduler{}))
+	for i := 0; i < 3; i++ {
+		go sem.Acquire(ctx, 1)
+	}
+	for sem.Waiters() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		sem.lock()
+		sem.schedule()
+		sem.mu.Unlock()
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocs per schedule, want 0", allocs)
+	}
+}
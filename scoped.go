@@ -0,0 +1,29 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// AcquireScoped acquires the semaphore with a weight of n, as Acquire does,
+// and binds the hold to ctx: the weight is released when ctx is done, if it
+// wasn't released before by calling release. It protects the semaphore from
+// request-scoped holders that forget to release on some error path.
+//
+// release may be called any number of times, from any goroutine; only the
+// first call, or ctx being done, releases the weight. On failure, returns
+// ctx.Err() and a nil release.
+func (s *Weighted) AcquireScoped(ctx context.Context, n int64) (release func(), err error) {
+	if err := s.Acquire(ctx, n); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	releaseOnce := func() { once.Do(func() { s.Release(n) }) }
+	stop := context.AfterFunc(ctx, releaseOnce)
+	return func() {
+		stop()
+		releaseOnce()
+	}, nil
+}
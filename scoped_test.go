@@ -0,0 +1,48 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedAcquireScoped(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+
+	// A holder that forgets to release loses its weight with its context.
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := sem.AcquireScoped(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	for sem.Current() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// One that releases only releases once.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	release, err := sem.AcquireScoped(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release()
+	cancel()
+	if !sem.TryAcquire(2) {
+		t.Error("weight was not released")
+	}
+	if cur := sem.Current(); cur != 2 {
+		t.Errorf("got current %d, want 2", cur)
+	}
+
+	tctx, tcancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer tcancel()
+	if release, err := sem.AcquireScoped(tctx, 1); err != context.DeadlineExceeded || release != nil {
+		t.Errorf("got %v, want %v and a nil release", err, context.DeadlineExceeded)
+	}
+}
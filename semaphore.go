@@ -2,35 +2,107 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !tinygo && !js
+
 // Package semaphore provides a weighted semaphore implementation.
 package semaphore
 
 import (
-	"container/list"
 	"context"
 	"sync"
+	"time"
 )
 
 type waiter struct {
-	n     int64
-	ready chan<- struct{} // Closed when semaphore acquired.
+	n          int64
+	max        int64       // Largest weight granted, for AcquireUpTo; otherwise n.
+	granted    int64       // Set to the granted weight on admission.
+	err        error       // Set instead when the waiter is failed.
+	notify     func(error) // For AcquireChan, called with err in place of ready.
+	slot       *waiter     // For AcquireChan, the preallocated waiter it holds.
+	strict     bool        // Fails with ErrRequestTooLarge rather than wait for a Resize.
+	all        bool        // For AcquireAll, n and max follow the size.
+	wakeNext   *waiter     // The next waiter to send ready to, in s.woken.
+	priority   int
+	skipped    int           // Times smaller waiters were admitted ahead of it.
+	ready      chan struct{} // Receives when semaphore acquired; buffered so it can be reused.
+	ctx        context.Context
+	enqueued   time.Time
+	list       *waiterList // The list the waiter is in, if any.
+	prev, next *waiter
 }
 
 // NewWeighted creates a new weighted semaphore with the given
 // maximum combined weight for concurrent access.
-func NewWeighted(n int64) *Weighted {
-	w := &Weighted{size: n}
+func NewWeighted(n int64, opts ...Option) *Weighted {
+	w := &Weighted{id: weightedIDs.Add(1), size: n, defaultWeight: 1, opts: opts}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.handOff()
 	return w
 }
 
 // Weighted provides a way to bound concurrent access to a resource.
 // The callers can request access with a given weight.
 type Weighted struct {
+	id                uint64 // Orders semaphores for AcquireMultiple.
+	opts              []Option
+	name              string
 	size              int64
 	cur               int64
+	version           uint64 // Bumped on every change of usage, size or state.
 	mu                sync.Mutex
-	waiters           list.List
-	impossibleWaiters list.List
+	woken, wokenTail  *waiter // Waiters to send ready to once s.mu is unlocked.
+	waiters           waiterList
+	impossibleWaiters waiterList
+	state             State
+	closeErr          error           // The cause given to Close.
+	idle              []chan struct{} // Closed once nothing is held or queued.
+	stateWatchers     map[chan StateChange]struct{}
+	expiry            *expiry
+	defaultWeight     int64
+	noBypass          bool
+	bypassed          int64
+	onFirstBlocked    func()
+	onQueueEmpty      func()
+	queued            bool // Whether the queue was last seen non-empty.
+	callbacks         dispatcher
+	progressEvery     time.Duration
+	onProgress        func(Progress)
+	releaseReasons    map[string]int64
+	signals           []*Backpressure
+	callers           *Composite
+	identity          IdentityFunc
+	warning           *utilizationWarning
+	maxWait           time.Duration
+	scheduler         Scheduler
+	scheduled         []int64 // Weights passed to the scheduler, reused.
+	strict            bool
+	onMisuse          func(error)
+	prioritized       bool          // Whether any waiter ever had a priority.
+	priorityAging     time.Duration // Waiting time that raises priority by one.
+	maxSkips          int           // See WithWorkConserving.
+	lifo              bool          // See WithQueuePolicy.
+	maxWaiters        int           // See WithMaxWaiters.
+	resizeHooks       []*resizeHook
+	counters          counters
+	hooks             *Hooks
+	waits             *waitWindow // See WithWaitTracking.
+	waitQuantiles     []float64
+	allHeld           []int64     // Weights granted by AcquireAll, oldest first.
+	slots             *waiterList // Free preallocated waiters, if any.
+	inst              Instrumentation
+	sampler           *Sampler
+	holders           *holderTracking // See WithHolderTracking.
+	watchdog          *holdWatchdog   // See WithSlowHolderWatchdog.
+	fast              fastPath        // See lock.
+}
+
+// Clone creates a new semaphore with the current size of s and the options s
+// was created with, but none of its holders, waiters or counters.
+func (s *Weighted) Clone() *Weighted {
+	return NewWeighted(s.Size(), s.opts...)
 }
 
 // Acquire acquires the semaphore with a weight of n, blocking until resources
@@ -38,12 +110,99 @@ type Weighted struct {
 // ctx.Err() and leaves the semaphore unchanged.
 //
 // If ctx is already done, Acquire may still succeed without blocking.
+//
+// If the semaphore is draining or closed, or starts to while Acquire waits,
+// Acquire fails with a *StateError.
+//
+// If ctx was marked by WithBypass, Acquire skips admission; see WithBypass.
+//
+// Acquire doesn't apply the per-caller limit set WithCallerLimit, even if ctx
+// identifies the caller; use AcquireAs for that.
 func (s *Weighted) Acquire(ctx context.Context, n int64) error {
-	s.mu.Lock()
-	if s.size-s.cur >= n && s.waiters.Len() == 0 {
-		s.cur += n
+	if s.noBypass || !isBypass(ctx) {
+		if _, ok := s.fastAcquire(n, n); ok {
+			return nil
+		}
+	}
+	_, err := s.acquire(ctx, request{n: n, max: n})
+	return err
+}
+
+// AcquireUpTo acquires the semaphore with as much weight as is available, up to
+// max, blocking only until at least a weight of 1 is available or ctx is done.
+// On success, returns the granted weight, which must be released. On failure,
+// returns ctx.Err() and leaves the semaphore unchanged.
+//
+// AcquireUpTo waits its turn like Acquire: it is granted weight only once the
+// waiters queued before it are.
+func (s *Weighted) AcquireUpTo(ctx context.Context, max int64) (int64, error) {
+	if max < 1 {
+		panic("semaphore: bad AcquireUpTo max")
+	}
+	return s.acquire(ctx, request{n: 1, max: max})
+}
+
+// request describes an acquisition.
+type request struct {
+	n, max   int64 // The least and most weight to grant.
+	strict   bool  // Fail with ErrRequestTooLarge rather than wait for n to fit.
+	all      bool  // Acquire the whole size, whatever it is; n and max are ignored.
+	priority int
+}
+
+// acquire acquires a weight of at least r.n and at most r.max, returning the
+// granted weight.
+func (s *Weighted) acquire(ctx context.Context, r request) (granted int64, err error) {
+	if s.holders != nil {
+		defer func() {
+			if err == nil && granted > 0 {
+				s.trackHolder(ctx, granted)
+			}
+		}()
+	}
+	s.lock()
+	if r.all {
+		r.n, r.max = s.size, s.size
+	}
+	n, max := r.n, r.max
+	if err := s.refused(); err != nil {
+		s.mu.Unlock()
+		s.count("semaphore.rejections", 1)
+		return 0, err
+	}
+	if !s.noBypass && isBypass(ctx) {
+		// Availability doesn't limit a bypassed AcquireUpTo, so the size does.
+		granted = max
+		if granted > s.size && granted > n {
+			granted = s.size
+			if granted < n {
+				granted = n
+			}
+		}
+		s.bypassed++
+		s.acquired(granted)
+		s.usageChanged()
 		s.mu.Unlock()
-		return nil
+		s.count("semaphore.acquires", 1)
+		s.hookAcquire(granted, 0)
+		return granted, nil
+	}
+	strict := r.strict || s.strict
+	if strict && n > s.size {
+		s.counters.tooLarge++
+		s.mu.Unlock()
+		s.count("semaphore.rejections", 1)
+		return 0, ErrRequestTooLarge
+	}
+	if s.state == StateOpen && s.size-s.cur >= n && (s.waiters.Len() == 0 || s.outranksQueue(r.priority)) {
+		granted = s.grantable(max)
+		s.acquired(granted)
+		s.waited(0)
+		s.usageChanged()
+		s.unlock()
+		s.count("semaphore.acquires", 1)
+		s.hookAcquire(granted, 0)
+		return granted, nil
 	}
 
 	var waiterList = &s.waiters
@@ -53,157 +212,499 @@ func (s *Weighted) Acquire(ctx context.Context, n int64) error {
 		waiterList = &s.impossibleWaiters
 	}
 
-	ready := make(chan struct{})
-	w := waiter{n: n, ready: ready}
-	elem := waiterList.PushBack(w)
-	s.mu.Unlock()
+	w := s.newWaiter(n, max)
+	if w == nil {
+		s.mu.Unlock()
+		s.count("semaphore.rejections", 1)
+		return 0, ErrQueueFull
+	}
+	w.ctx, w.enqueued, w.strict, w.priority, w.all = ctx, time.Now(), strict, r.priority, r.all
+	if r.priority != 0 {
+		s.prioritized = true
+	}
+	waiterList.PushBack(w)
+	s.queueChanged()
+	if s.maxSkips > 0 {
+		// Capacity left idle by a blocked waiter may be ours.
+		s.notifyWaiters()
+	}
+	enqueued := w.enqueued
+	s.unlock()
 
-	select {
-	case <-ctx.Done():
-		err := ctx.Err()
-		s.mu.Lock()
+	if s.hooks != nil {
+		s.hookWaitStart(n)
+		defer func() { s.hookWaitEnd(n, enqueued, granted, err) }()
+	}
+	if end := s.startWait(ctx, n); end != nil {
+		defer func() { end(err) }()
+	}
+	if s.maxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.maxWait)
+		defer cancel()
+	}
+
+	var tick <-chan time.Time
+	if s.onProgress != nil {
+		ticker := time.NewTicker(s.progressEvery)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
 		select {
-		case <-ready:
-			// Acquired the semaphore after we were canceled.  Rather than trying to
-			// fix up the queue, just pretend we didn't notice the cancelation.
-			err = nil
-		default:
-			waiterList.Remove(elem)
+		case <-ctx.Done():
+			err = ctx.Err()
+			s.lock()
+			if w.list == nil {
+				// Acquired the semaphore after we were canceled.  Rather than trying to
+				// fix up the queue, just pretend we didn't notice the cancelation.
+				// The waker sends ready once it unlocks s.mu.
+				s.mu.Unlock()
+				<-w.ready
+				granted, err = w.granted, w.err
+				s.lock()
+			} else {
+				// The waiter may have moved between the lists on Resize.
+				w.list.Remove(w)
+				s.counters.cancellations++
+				s.waited(time.Since(w.enqueued))
+				s.queueChanged()
+			}
+			s.freeWaiter(w)
+			s.mu.Unlock()
+			return granted, err
+
+		case <-w.ready:
+			granted, err = w.granted, w.err
+			if s.slots == nil {
+				s.freeWaiter(w)
+			} else {
+				s.lock()
+				s.freeWaiter(w)
+				s.mu.Unlock()
+			}
+			return granted, err
+
+		case <-tick:
+			s.progress(w)
 		}
-		s.mu.Unlock()
-		return err
+	}
+}
 
-	case <-ready:
-		return nil
+// grantable returns the weight to grant a request for at most max, given that
+// its minimum is available. Must be called with s.mu held.
+func (s *Weighted) grantable(max int64) int64 {
+	if avail := s.size - s.cur; avail < max {
+		return avail
 	}
+	return max
 }
 
 // TryAcquire acquires the semaphore with a weight of n without blocking.
 // On success, returns true. On failure, returns false and leaves the semaphore unchanged.
 func (s *Weighted) TryAcquire(n int64) bool {
-	s.mu.Lock()
-	success := s.size-s.cur >= n && s.waiters.Len() == 0
+	_, ok := s.tryAcquire(n, n)
+	return ok
+}
+
+// TryAcquireUpTo acquires the semaphore with as much weight as is available, up
+// to max, without blocking. Returns the granted weight, which must be released;
+// it is zero if nothing is available or waiters are queued.
+func (s *Weighted) TryAcquireUpTo(max int64) int64 {
+	if max < 1 {
+		panic("semaphore: bad TryAcquireUpTo max")
+	}
+	granted, _ := s.tryAcquire(1, max)
+	return granted
+}
+
+// tryAcquire acquires a weight of at least n and at most max without blocking,
+// returning the granted weight and whether it succeeded.
+func (s *Weighted) tryAcquire(n, max int64) (int64, bool) {
+	if granted, ok := s.fastAcquire(n, max); ok {
+		return granted, true
+	}
+	s.lock()
+	var granted int64
+	success := s.state == StateOpen && s.size-s.cur >= n && s.waiters.Len() == 0
 	if success {
-		s.cur += n
+		granted = s.grantable(max)
+		s.acquired(granted)
+		s.usageChanged()
 	}
-	s.mu.Unlock()
-	return success
+	s.unlock()
+	if success {
+		s.count("semaphore.acquires", 1)
+		s.hookAcquire(granted, 0)
+		if s.holders != nil {
+			s.trackHolder(context.Background(), granted)
+		}
+	}
+	return granted, success
+}
+
+// MustAcquire acquires the semaphore with a weight of n without blocking, like
+// TryAcquire, but panics if the weight isn't available. It is meant for
+// init-time claims where blocking indicates a programming error.
+func (s *Weighted) MustAcquire(n int64) {
+	if !s.TryAcquire(n) {
+		panic("semaphore: MustAcquire would block")
+	}
+}
+
+// AcquireDefault acquires the semaphore with the weight given WithDefaultWeight, as
+// Acquire does.
+func (s *Weighted) AcquireDefault(ctx context.Context) error {
+	return s.Acquire(ctx, s.defaultWeight)
+}
+
+// ReleaseDefault releases the semaphore with the weight given WithDefaultWeight.
+func (s *Weighted) ReleaseDefault() {
+	s.Release(s.defaultWeight)
 }
 
 // Release releases the semaphore with a weight of n.
 func (s *Weighted) Release(n int64) {
-	s.mu.Lock()
-	s.cur -= n
-	if s.cur < 0 {
-		s.mu.Unlock()
-		panic("semaphore: bad release")
+	if s.fastRelease(n) {
+		return
 	}
-	for {
-		next := s.waiters.Front()
-		if next == nil {
-			break // No more waiters blocked.
-		}
+	s.release(n, "")
+}
 
-		w := next.Value.(waiter)
-		if s.size-s.cur < w.n {
-			// Not enough tokens for the next waiter.  We could keep going (to try to
-			// find a waiter with a smaller request), but under load that could cause
-			// starvation for large requests; instead, we leave all remaining waiters
-			// blocked.
-			//
-			// Consider a semaphore used as a read-write lock, with N tokens, N
-			// readers, and one writer.  Each reader can Acquire(1) to obtain a read
-			// lock.  The writer can Acquire(N) to obtain a write lock, excluding all
-			// of the readers.  If we allow the readers to jump ahead in the queue,
-			// the writer will starve — there is always one token available for every
-			// reader.
-			break
-		}
+// ReleaseWithReason releases the semaphore with a weight of n, attributing the
+// release to reason, e.g. "success", "error", "timeout" or "preempted". Counts
+// per reason are reported by ReleaseReasons.
+func (s *Weighted) ReleaseWithReason(n int64, reason string) {
+	s.release(n, reason)
+}
 
-		s.cur += w.n
-		s.waiters.Remove(next)
-		close(w.ready)
+func (s *Weighted) release(n int64, reason string) {
+	s.lock()
+	s.counters.releases++
+	if reason != "" {
+		if s.releaseReasons == nil {
+			s.releaseReasons = make(map[string]int64)
+		}
+		s.releaseReasons[reason]++
 	}
-	s.mu.Unlock()
+	if s.holders != nil {
+		s.untrackHolder(n)
+	}
+	live := s.released(n)
+	if live == 0 && n > 0 {
+		// The weight was already returned when its hold expired.
+		s.mu.Unlock()
+		s.countRelease(reason)
+		s.hookRelease(n)
+		return
+	}
+	s.cur -= live
+	s.version++
+	if s.cur < 0 {
+		if s.onMisuse == nil {
+			s.mu.Unlock()
+			panic("semaphore: bad release")
+		}
+		s.misused(ErrBadRelease)
+		s.cur = 0
+	}
+	s.notifyWaiters()
+	s.unlock()
+	s.countRelease(reason)
+	s.hookRelease(n)
 }
 
 // Resize semaphore.
 func (s *Weighted) Resize(n int64) {
-	s.mu.Lock()
-	s.size = n
-	if s.size < 0 {
-		s.mu.Unlock()
-		panic("semaphore: bad resize")
+	s.lock()
+	s.resize(n, ResizeGraceful)
+	s.unlock()
+}
+
+// ResizeIfSizeIs resizes the semaphore to n only if its size is still old,
+// returning whether it did. Controllers that compute the new size from an
+// observed one can use it to avoid clobbering each other's changes.
+func (s *Weighted) ResizeIfSizeIs(old, n int64) bool {
+	s.lock()
+	ok := s.size == old
+	if ok {
+		s.resize(n, ResizeGraceful)
 	}
+	s.unlock()
+	return ok
+}
 
-	// Add the now possible waiters to waiters list.
-	element := s.impossibleWaiters.Front()
-	for {
-		if element == nil {
-			break // No more impossible waiters blocked.
+// ResizeBy adds delta, which may be negative, to the size of the semaphore
+// atomically and returns the new size, so concurrent controllers adjusting it
+// incrementally don't clobber each other. It panics if the size would go
+// negative, as Resize does.
+func (s *Weighted) ResizeBy(delta int64) int64 {
+	s.lock()
+	s.resize(s.size+delta, ResizeGraceful)
+	n := s.size
+	s.unlock()
+	return n
+}
+
+// ResizeByWithin is like ResizeBy, but clamps the new size to [min, max].
+func (s *Weighted) ResizeByWithin(delta, min, max int64) int64 {
+	if min < 0 || max < min {
+		panic("semaphore: bad resize bounds")
+	}
+	s.lock()
+	n := s.size + delta
+	if n < min {
+		n = min
+	} else if n > max {
+		n = max
+	}
+	s.resize(n, ResizeGraceful)
+	s.unlock()
+	return n
+}
+
+// resize sets the size of the semaphore to n, moving waiters between the
+// waiters and impossible waiters lists and waking those that now fit. Under
+// ResizeStrict, waiters that no longer fit are failed instead. Must be called
+// with s.mu held.
+func (s *Weighted) resize(n int64, mode ResizeMode) {
+	if n < 0 {
+		if s.onMisuse == nil {
+			s.mu.Unlock()
+			panic("semaphore: bad resize")
 		}
+		s.misused(ErrBadResize)
+		return
+	}
+	if n != s.size {
+		s.resized(s.size, n)
+	}
+	s.size = n
+	s.version++
+	s.followSize(&s.waiters)
+	s.followSize(&s.impossibleWaiters)
 
-		w := element.Value.(waiter)
+	// Add the now possible waiters to waiters list, and fail the impossible
+	// ones in strict mode.
+	for w := s.impossibleWaiters.Front(); w != nil; {
+		next := w.Next()
+		if s.size >= w.n {
+			s.impossibleWaiters.Remove(w)
+			s.waiters.PushBack(w)
+		} else if mode == ResizeStrict {
+			s.impossibleWaiters.Remove(w)
+			w.err = ErrResized
+			s.counters.tooLarge++
+			s.wake(w)
+		}
+		w = next
+	}
+
+	// Add the now impossible-waiters to impossible waiters list, or fail them
+	// if they or the resize are strict.
+	for w := s.waiters.Front(); w != nil; {
+		next := w.Next()
 		if s.size < w.n {
-			// Still Impossible. next.
-			element = element.Next()
-			continue
+			s.waiters.Remove(w)
+			if w.strict {
+				w.err = ErrRequestTooLarge
+				s.counters.tooLarge++
+				s.wake(w)
+			} else if mode == ResizeStrict {
+				w.err = ErrResized
+				s.counters.tooLarge++
+				s.wake(w)
+			} else {
+				s.impossibleWaiters.PushBack(w)
+			}
 		}
+		w = next
+	}
 
-		s.waiters.PushBack(w)
-		toRemove := element
-		element = element.Next()
-		s.impossibleWaiters.Remove(toRemove)
+	// Release Possible Waiters
+	s.notifyWaiters()
+}
 
+// Pause stops admitting acquisitions, both new and queued, without failing
+// them. Unlike Resize(0), the size and current usage are left unchanged, and
+// holders may keep releasing. Acquire calls block and TryAcquire calls fail
+// until Resume is called. Pause has no effect unless the semaphore is open.
+func (s *Weighted) Pause() {
+	s.lock()
+	if s.state == StateOpen {
+		s.setState(StatePaused)
 	}
+	s.mu.Unlock()
+}
 
-	// Add the now impossible-waiters to impossible waiters list.
-	element = s.waiters.Front()
-	for {
-		if element == nil {
-			break // No more waiters.
-		}
+// Resume resumes admitting acquisitions after Pause, waking the queued waiters
+// that now fit.
+func (s *Weighted) Resume() {
+	s.lock()
+	if s.state == StatePaused {
+		s.setState(StateOpen)
+	}
+	s.notifyWaiters()
+	s.unlock()
+}
 
-		w := element.Value.(waiter)
-		if s.size >= w.n {
-			// Still Possible. next.
-			element = element.Next()
-			continue
-		}
+// Close moves the semaphore to StateClosed without waiting for holders, which
+// may still release. It wakes every queued Acquire call, including those for
+// more than the size, failing them with cause, or ErrClosed if cause is nil;
+// later acquisitions fail the same way. Close has no effect on a semaphore
+// already closed.
+func (s *Weighted) Close(cause error) {
+	if cause == nil {
+		cause = ErrClosed
+	}
+	s.lock()
+	if s.setState(StateClosed) {
+		s.closeErr = cause
+		s.failWaiters(cause)
+		s.usageChanged()
+	}
+	s.unlock()
+}
 
-		s.impossibleWaiters.PushBack(w)
-		toRemove := element
-		element = element.Next()
-		s.waiters.Remove(toRemove)
+// failWaiters wakes every queued waiter, including impossible ones, with err.
+// Must be called with s.mu held.
+func (s *Weighted) failWaiters(err error) {
+	for _, list := range []*waiterList{&s.waiters, &s.impossibleWaiters} {
+		for w := list.Front(); w != nil; w = list.Front() {
+			list.Remove(w)
+			w.err = err
+			s.wake(w)
+		}
 	}
+	s.queueChanged()
+}
 
-	// Release Possible Waiters
+// notifyWaiters admits queued waiters in the order of the queue policy while
+// they fit. It is
+// called whenever usage drops or the size or state changes. Must be called with
+// s.mu held.
+func (s *Weighted) notifyWaiters() {
+	defer s.usageChanged()
+	if s.state == StateDraining && s.cur == 0 {
+		s.setState(StateClosed)
+	}
+	if s.state == StatePaused || s.state >= StateDraining {
+		return
+	}
 	for {
-		next := s.waiters.Front()
-		if next == nil {
+		w := s.waiters.Front()
+		if w == nil {
 			break // No more waiters blocked.
 		}
+		if s.scheduler != nil {
+			if w = s.schedule(); w == nil {
+				break
+			}
+		} else {
+			w = s.next()
+		}
 
-		w := next.Value.(waiter)
 		if s.size-s.cur < w.n {
-			// Not enough tokens for the element waiter.  We could keep going (to try to
+			// Not enough tokens for the next waiter.  We could keep going (to try to
 			// find a waiter with a smaller request), but under load that could cause
 			// starvation for large requests; instead, we leave all remaining waiters
 			// blocked.
+			//
+			// Consider a semaphore used as a read-write lock, with N tokens, N
+			// readers, and one writer.  Each reader can Acquire(1) to obtain a read
+			// lock.  The writer can Acquire(N) to obtain a write lock, excluding all
+			// of the readers.  If we allow the readers to jump ahead in the queue,
+			// the writer will starve — there is always one token available for every
+			// reader.
+			//
+			// WithWorkConserving lets them jump ahead a bounded number of times.
+			if s.maxSkips > 0 && s.scheduler == nil {
+				s.admitAround(w)
+			}
 			break
 		}
 
-		s.cur += w.n
-		s.waiters.Remove(next)
-		close(w.ready)
+		s.admit(w)
 	}
+	s.queueChanged()
+}
+
+// admit grants queued w its weight and wakes it. Must be called with s.mu held.
+func (s *Weighted) admit(w *waiter) {
+	w.granted = s.grantable(w.max)
+	s.acquired(w.granted)
+	s.waited(time.Since(w.enqueued))
+	s.waiters.Remove(w)
+	s.wake(w)
+}
+
+// unlock hands the usage to the uncontended path if it can and unlocks s.mu,
+// then sends ready to the waiters woken while it was held. Must be used in
+// place of s.mu.Unlock wherever waiters may have been woken.
+func (s *Weighted) unlock() {
+	w := s.woken
+	s.woken, s.wokenTail = nil, nil
+	s.handOff()
 	s.mu.Unlock()
+	for w != nil {
+		// w may be reused as soon as it receives.
+		next := w.wakeNext
+		w.wakeNext = nil
+		w.ready <- struct{}{}
+		w = next
+	}
+}
+
+// queueChanged posts the queue callbacks if the queue went from empty to
+// non-empty or back. Must be called with s.mu held.
+func (s *Weighted) queueChanged() {
+	s.checkIdle()
+	waiters := s.waiters.Len() + s.impossibleWaiters.Len()
+	if waiters > s.counters.peakWaiters {
+		s.counters.peakWaiters = waiters
+	}
+	queued := waiters > 0
+	if queued == s.queued {
+		return
+	}
+	s.queued = queued
+	if queued && s.onFirstBlocked != nil {
+		s.callbacks.post(s.onFirstBlocked)
+	}
+	if !queued && s.onQueueEmpty != nil {
+		s.callbacks.post(s.onQueueEmpty)
+	}
+}
+
+// acquired adds a granted weight of n to the semaphore. Must be called with
+// s.mu held.
+func (s *Weighted) acquired(n int64) {
+	s.cur += n
+	s.version++
+	s.counters.acquires++
+	if s.cur > s.counters.peakCurrent {
+		s.counters.peakCurrent = s.cur
+	}
+	if s.expiry != nil {
+		s.trackHold(n)
+	}
+}
+
+// released accounts for a release of a weight of n, returning the part of it
+// to return to the semaphore, which excludes weight already returned by expiry.
+// Must be called with s.mu held.
+func (s *Weighted) released(n int64) int64 {
+	if s.expiry != nil {
+		return s.untrackHold(n)
+	}
+	return n
 }
 
 // Current returns the current size of semaphore.
 // Returned value may instantly change after/during call. use for diagnostic and health-checking only.
 func (s *Weighted) Current() int64 {
-	s.mu.Lock()
+	s.lock()
 	cur := s.cur
 	s.mu.Unlock()
 	return cur
@@ -212,7 +713,7 @@ func (s *Weighted) Current() int64 {
 // Size returns the maximum size of semaphore.
 // Returned value may instantly change after/during call. use for diagnostic and health-checking only.
 func (s *Weighted) Size() int64 {
-	s.mu.Lock()
+	s.lock()
 	size := s.size
 	s.mu.Unlock()
 	return size
@@ -221,8 +722,50 @@ func (s *Weighted) Size() int64 {
 // Waiters returns the number of currently waiting Acquire calls.
 // Returned value may instantly change after/during call. use for diagnostic and health-checking only.
 func (s *Weighted) Waiters() int {
-	s.mu.Lock()
+	s.lock()
 	waiters := s.waiters.Len() + s.impossibleWaiters.Len()
 	s.mu.Unlock()
 	return waiters
 }
+
+// Snapshot returns the size, usage and number of waiters of the semaphore,
+// read at once.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Snapshot() Snapshot {
+	s.lock()
+	snap := Snapshot{Size: s.size, Current: s.cur, Waiters: s.waiters.Len() + s.impossibleWaiters.Len()}
+	s.mu.Unlock()
+	return snap
+}
+
+// Paused returns whether the semaphore is paused.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Paused() bool {
+	s.lock()
+	paused := s.state == StatePaused
+	s.mu.Unlock()
+	return paused
+}
+
+// Bypassed returns the number of acquisitions that skipped admission through
+// WithBypass.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Bypassed() int64 {
+	s.lock()
+	bypassed := s.bypassed
+	s.mu.Unlock()
+	return bypassed
+}
+
+// ReleaseReasons returns the number of releases per reason given to
+// ReleaseWithReason.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) ReleaseReasons() map[string]int64 {
+	s.lock()
+	reasons := make(map[string]int64, len(s.releaseReasons))
+	for reason, n := range s.releaseReasons {
+		reasons[reason] = n
+	}
+	s.mu.Unlock()
+	return reasons
+}
@@ -0,0 +1,171 @@
+package semaphore
+
+import "context"
+
+// This file is the implementation for js/wasm, which is single-threaded:
+// goroutines only switch at blocking operations, so the semaphore needs no
+// mutex, and waits are callbacks that run as soon as the weight is granted.
+// The code between reading and updating the semaphore's state must therefore
+// never block.
+
+// Option configures a Weighted at construction time.
+type Option func(*Weighted)
+
+type waiter struct {
+	n  int64
+	fn func()
+}
+
+// Weighted provides a way to bound concurrent access to a resource.
+// The callers can request access with a given weight.
+type Weighted struct {
+	size    int64
+	cur     int64
+	waiters []*waiter // FIFO order.
+}
+
+// NewWeighted creates a new weighted semaphore with the given
+// maximum combined weight for concurrent access.
+func NewWeighted(n int64, opts ...Option) *Weighted {
+	w := &Weighted{size: n}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// AcquireFunc acquires the semaphore with a weight of n and calls fn once it
+// is acquired, immediately if resources are available. It never blocks, which
+// suits event-loop code such as JavaScript callbacks.
+//
+// The returned cancel func withdraws a request that is still waiting and
+// reports whether it did; if it returns false, fn has been or is being called
+// and the weight must be released.
+func (s *Weighted) AcquireFunc(n int64, fn func()) (cancel func() bool) {
+	if s.size-s.cur >= n && s.blocker() < 0 {
+		s.cur += n
+		fn()
+		return func() bool { return false }
+	}
+
+	w := &waiter{n: n, fn: fn}
+	s.waiters = append(s.waiters, w)
+	return func() bool {
+		for i, q := range s.waiters {
+			if q == w {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				s.notifyWaiters()
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until resources
+// are available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() and leaves the semaphore unchanged.
+//
+// If ctx is already done, Acquire may still succeed without blocking.
+func (s *Weighted) Acquire(ctx context.Context, n int64) error {
+	ready := make(chan struct{})
+	cancel := s.AcquireFunc(n, func() { close(ready) })
+
+	select {
+	case <-ctx.Done():
+		if cancel() {
+			return ctx.Err()
+		}
+		// Acquired the semaphore after we were canceled.  Rather than trying to
+		// fix up the queue, just pretend we didn't notice the cancelation.
+		return nil
+
+	case <-ready:
+		return nil
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking.
+// On success, returns true. On failure, returns false and leaves the semaphore unchanged.
+func (s *Weighted) TryAcquire(n int64) bool {
+	success := s.size-s.cur >= n && s.blocker() < 0
+	if success {
+		s.cur += n
+	}
+	return success
+}
+
+// Release releases the semaphore with a weight of n.
+func (s *Weighted) Release(n int64) {
+	if s.cur < n {
+		panic("semaphore: bad release")
+	}
+	s.cur -= n
+	s.notifyWaiters()
+}
+
+// Resize resizes the semaphore to the given maximum combined weight.
+func (s *Weighted) Resize(n int64) {
+	if n < 0 {
+		panic("semaphore: bad resize")
+	}
+	s.size = n
+	s.notifyWaiters()
+}
+
+// Current returns the current size of semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Current() int64 {
+	return s.cur
+}
+
+// Size returns the maximum size of semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Size() int64 {
+	return s.size
+}
+
+// Waiters returns the number of currently waiting Acquire calls.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Waiters() int {
+	return len(s.waiters)
+}
+
+// Snapshot returns the size, usage and number of waiters of the semaphore,
+// read at once.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Snapshot() Snapshot {
+	return Snapshot{Size: s.size, Current: s.cur, Waiters: len(s.waiters)}
+}
+
+// blocker returns the position of the first waiter whose request fits the
+// size, which newcomers must not overtake, or -1. Waiters requesting more than
+// the size are impossible until a Resize and block nobody.
+func (s *Weighted) blocker() int {
+	for i, w := range s.waiters {
+		if w.n <= s.size {
+			return i
+		}
+	}
+	return -1
+}
+
+// notifyWaiters admits possible waiters in FIFO order while they fit, leaving
+// the rest blocked to avoid starving large requests. The callbacks of the
+// admitted waiters run after the state is updated, in the order admitted.
+func (s *Weighted) notifyWaiters() {
+	var admitted []func()
+	for {
+		i := s.blocker()
+		if i < 0 || s.size-s.cur < s.waiters[i].n {
+			break
+		}
+		w := s.waiters[i]
+		s.cur += w.n
+		s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+		admitted = append(admitted, w.fn)
+	}
+	for _, fn := range admitted {
+		fn()
+	}
+}
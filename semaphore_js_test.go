@@ -0,0 +1,44 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestJSAcquireFunc(t *testing.T) {
+	sem := NewWeighted(2)
+
+	var order []int64
+	sem.AcquireFunc(2, func() { order = append(order, 0) })
+	sem.AcquireFunc(2, func() { order = append(order, 2) })
+	cancel := sem.AcquireFunc(1, func() { order = append(order, 1) })
+	if len(order) != 1 || sem.Waiters() != 2 {
+		t.Fatalf("got order %v with %d waiters, want [0] with 2", order, sem.Waiters())
+	}
+
+	sem.Release(2)
+	if len(order) != 2 || order[1] != 2 {
+		t.Fatalf("got order %v, want [0 2]", order)
+	}
+	if !cancel() {
+		t.Fatal("cancel of a waiting request returned false")
+	}
+	sem.Release(2)
+	if len(order) != 2 || sem.Current() != 0 || sem.Waiters() != 0 {
+		t.Errorf("canceled request was admitted: order %v, cur %d", order, sem.Current())
+	}
+}
+
+func TestJSAcquireCanceled(t *testing.T) {
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sem.Acquire(ctx, 1); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if waiters := sem.Waiters(); waiters != 0 {
+		t.Errorf("Waiters() = %d, want 0", waiters)
+	}
+}
@@ -2,6 +2,8 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build !tinygo && !js
+
 package semaphore
 
 import (
@@ -16,7 +18,7 @@ import (
 
 const maxSleep = 1 * time.Millisecond
 
-func HammerWeighted(sem Weighted, n int64, loops int) {
+func HammerWeighted(sem *Weighted, n int64, loops int) {
 	for i := 0; i < loops; i++ {
 		sem.Acquire(context.Background(), n)
 		time.Sleep(time.Duration(rand.Int63n(int64(maxSleep/time.Nanosecond))) * time.Nanosecond)
@@ -29,7 +31,7 @@ func TestWeighted(t *testing.T) {
 
 	n := runtime.GOMAXPROCS(0)
 	loops := 10000 / n
-	sem := *NewWeighted(int64(n))
+	sem := NewWeighted(int64(n))
 	var wg sync.WaitGroup
 	wg.Add(n)
 	for i := 0; i < n; i++ {
@@ -330,3 +332,310 @@ func TestGetters(t *testing.T) {
 		}
 	}
 }
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4)
+
+	// Snapshots race with every mutation without tripping the race detector,
+	// and a holder of 2 never sees a usage beyond it.
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if snap := sem.Snapshot(); snap.Current%2 != 0 || snap.Current > 2 {
+				t.Errorf("inconsistent snapshot %+v", snap)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		sem.Acquire(ctx, 2)
+		sem.Resize(int64(4 + i%2))
+		sem.Release(2)
+	}
+	close(stop)
+	<-done
+
+	sem.Acquire(ctx, 4)
+	go sem.Acquire(ctx, 2)
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if snap, want := sem.Snapshot(), (Snapshot{Size: 5, Current: 4, Waiters: 1}); snap != want {
+		t.Errorf("got %+v, want %+v", snap, want)
+	}
+}
+
+func TestWeightedPauseResume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	sem.Acquire(ctx, 1)
+
+	sem.Pause()
+	if !sem.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	if sem.TryAcquire(1) {
+		t.Error("TryAcquire succeeded on a paused semaphore")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		sem.Acquire(ctx, 1)
+		close(done)
+	}()
+
+	sem.Release(1)
+	select {
+	case <-done:
+		t.Fatal("Acquire succeeded on a paused semaphore")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if cur, size := sem.Current(), sem.Size(); cur != 0 || size != 2 {
+		t.Errorf("got cur/size %d/%d while paused, want 0/2", cur, size)
+	}
+
+	sem.Resume()
+	<-done
+	if sem.Paused() {
+		t.Error("Paused() = true after Resume")
+	}
+}
+
+func TestWeightedDefaultWeight(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4, WithDefaultWeight(2))
+	sem.AcquireDefault(ctx)
+	sem.AcquireDefault(ctx)
+	if sem.TryAcquire(1) {
+		t.Error("TryAcquire succeeded after two default acquisitions of weight 2")
+	}
+	sem.ReleaseDefault()
+	if cur := sem.Current(); cur != 2 {
+		t.Errorf("got current %d, want 2", cur)
+	}
+
+	sem = NewWeighted(1)
+	sem.AcquireDefault(ctx)
+	if cur := sem.Current(); cur != 1 {
+		t.Errorf("got current %d, want the default weight of 1", cur)
+	}
+}
+
+func TestWeightedMustAcquire(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	sem.MustAcquire(2)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("MustAcquire on a full semaphore did not panic")
+		}
+		if cur := sem.Current(); cur != 2 {
+			t.Errorf("got current %d, want 2", cur)
+		}
+	}()
+	sem.MustAcquire(1)
+}
+
+func TestWeightedClone(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(3, WithName("proto"), WithDefaultWeight(2))
+	sem.AcquireDefault(ctx)
+	sem.Resize(4)
+
+	clone := sem.Clone()
+	if got, want := clone.String(), `Weighted "proto": open, cur=0 size=4 waiters=0 queued=0`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	clone.AcquireDefault(ctx)
+	if cur := clone.Current(); cur != 2 {
+		t.Errorf("clone lost its default weight, current %d", cur)
+	}
+	if cur := sem.Current(); cur != 2 {
+		t.Errorf("clone shares state with its prototype, current %d", cur)
+	}
+}
+
+func TestWeightedResizeIfSizeIs(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	if !sem.ResizeIfSizeIs(2, 4) {
+		t.Fatal("ResizeIfSizeIs with the current size failed")
+	}
+	if sem.ResizeIfSizeIs(2, 8) {
+		t.Fatal("ResizeIfSizeIs with a stale size succeeded")
+	}
+	if size := sem.Size(); size != 4 {
+		t.Errorf("got size %d, want 4", size)
+	}
+}
+
+func TestWeightedResizeBy(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem.ResizeBy(1)
+		}()
+	}
+	wg.Wait()
+	if size := sem.Size(); size != 12 {
+		t.Errorf("got size %d after 10 concurrent ResizeBy(1), want 12", size)
+	}
+	if n := sem.ResizeBy(-2); n != 10 {
+		t.Errorf("ResizeBy(-2) = %d, want 10", n)
+	}
+
+	tries := []struct {
+		delta, min, max, want int64
+	}{
+		{5, 0, 12, 12},
+		{-20, 4, 12, 4},
+		{3, 4, 12, 7},
+	}
+	for i, try := range tries {
+		if n := sem.ResizeByWithin(try.delta, try.min, try.max); n != try.want {
+			t.Errorf("tries[%d]: ResizeByWithin(%d, %d, %d) = %d, want %d", i, try.delta, try.min, try.max, n, try.want)
+		}
+	}
+}
+
+func TestWeightedAcquireUpTo(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4)
+
+	if got, err := sem.AcquireUpTo(ctx, 3); got != 3 || err != nil {
+		t.Fatalf("got (%d, %v), want (3, <nil>)", got, err)
+	}
+	if got, err := sem.AcquireUpTo(ctx, 3); got != 1 || err != nil {
+		t.Fatalf("got (%d, %v), want (1, <nil>)", got, err)
+	}
+
+	// Nothing is available: block until a release, then take what is free.
+	granted := make(chan int64)
+	go func() {
+		got, _ := sem.AcquireUpTo(ctx, 5)
+		granted <- got
+	}()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release(3)
+	if got := <-granted; got != 3 {
+		t.Errorf("blocked AcquireUpTo granted %d, want 3", got)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if got, err := sem.AcquireUpTo(tctx, 1); got != 0 || err != context.DeadlineExceeded {
+		t.Errorf("got (%d, %v), want (0, %v)", got, err, context.DeadlineExceeded)
+	}
+	if cur := sem.Current(); cur != 4 {
+		t.Errorf("got current %d, want 4", cur)
+	}
+}
+
+func TestWeightedTryAcquireUpTo(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(4)
+	tries := []int64{}
+	tries = append(tries, sem.TryAcquireUpTo(3)) // 3; cur/size = 3/4
+	tries = append(tries, sem.TryAcquireUpTo(3)) // 1; cur/size = 4/4
+	tries = append(tries, sem.TryAcquireUpTo(3)) // 0; full
+
+	sem.Release(2)
+	sem.Pause()
+	tries = append(tries, sem.TryAcquireUpTo(3)) // 0; paused
+	sem.Resume()
+	tries = append(tries, sem.TryAcquireUpTo(3)) // 2; cur/size = 4/4
+
+	want := []int64{3, 1, 0, 0, 2}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %d, want %d", i, tries[i], want[i])
+		}
+	}
+}
+
+func TestWeightedCancelAfterResizeMovedWaiter(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+
+	done := make(chan error)
+	go func() { done <- sem.Acquire(ctx, 2) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Moving the waiter between the impossible and possible lists must not
+	// keep its cancelation from removing it.
+	sem.Resize(2)
+	sem.Resize(1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	sem.Release(1)
+	sem.Resize(3)
+	if cur, waiters := sem.Current(), sem.Waiters(); cur != 0 || waiters != 0 {
+		t.Errorf("canceled waiter left cur=%d waiters=%d, want 0 and 0", cur, waiters)
+	}
+}
+
+func TestWeightedCancelRacingWakeup(t *testing.T) {
+	t.Parallel()
+
+	const n = 100
+	sem := NewWeighted(n)
+	sem.Acquire(context.Background(), n)
+
+	// Waiters whose context ends around the time they are woken must either
+	// hold their weight or leave nothing behind.
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rand.Intn(1000))*time.Microsecond)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer cancel()
+			if err := sem.Acquire(ctx, 1); err == nil {
+				sem.Release(1)
+			}
+		}()
+	}
+	time.Sleep(500 * time.Microsecond)
+	sem.Release(n)
+	wg.Wait()
+
+	if cur, waiters := sem.Current(), sem.Waiters(); cur != 0 || waiters != 0 {
+		t.Errorf("got cur=%d waiters=%d, want 0 and 0", cur, waiters)
+	}
+}
@@ -0,0 +1,248 @@
+// Package semaphorebench replays workloads against semaphores with different
+// queue policies and sizes, and reports throughput, fairness and wait latency
+// to guide their configuration.
+//
+// Workloads are replayed in real time: a request arrives at its offset from
+// the start of the replay, acquires its weight, holds it and releases it.
+package semaphorebench
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sherifabdlnaby/semaphore"
+)
+
+// Request is one request of a workload.
+type Request struct {
+	At     time.Duration // Arrival, from the start of the replay.
+	Tenant string
+	Weight int64
+	Hold   time.Duration
+}
+
+// Workload describes a synthetic workload.
+type Workload struct {
+	Requests int
+	// Arrival is the mean time between arrivals, which are exponentially
+	// distributed.
+	Arrival time.Duration
+	// Weight and Hold draw the weight and hold time of a request.
+	Weight func(r *rand.Rand) int64
+	Hold   func(r *rand.Rand) time.Duration
+	// Tenants is the number of tenants requests are spread over uniformly,
+	// named "t0", "t1", and so on. Zero means a single tenant.
+	Tenants int
+	Seed    int64
+}
+
+// Generate draws the requests of the workload, in order of arrival. The same
+// seed gives the same requests.
+func (w Workload) Generate() []Request {
+	r := rand.New(rand.NewSource(w.Seed))
+	tenants := w.Tenants
+	if tenants <= 0 {
+		tenants = 1
+	}
+	reqs := make([]Request, w.Requests)
+	var at time.Duration
+	for i := range reqs {
+		at += time.Duration(r.ExpFloat64() * float64(w.Arrival))
+		reqs[i] = Request{
+			At:     at,
+			Tenant: "t" + strconv.Itoa(r.Intn(tenants)),
+			Weight: w.Weight(r),
+			Hold:   w.Hold(r),
+		}
+	}
+	return reqs
+}
+
+// Constant returns a weight distribution that always draws n.
+func Constant(n int64) func(*rand.Rand) int64 {
+	return func(*rand.Rand) int64 { return n }
+}
+
+// Uniform returns a weight distribution drawing uniformly from [min, max].
+func Uniform(min, max int64) func(*rand.Rand) int64 {
+	return func(r *rand.Rand) int64 { return min + r.Int63n(max-min+1) }
+}
+
+// Exponential returns a hold time distribution with the given mean.
+func Exponential(mean time.Duration) func(*rand.Rand) time.Duration {
+	return func(r *rand.Rand) time.Duration { return time.Duration(r.ExpFloat64() * float64(mean)) }
+}
+
+// Admitter is a semaphore under a queue policy, admitting requests on behalf
+// of tenants.
+type Admitter interface {
+	Acquire(ctx context.Context, tenant string, n int64) error
+	Release(tenant string, n int64)
+}
+
+// Policy creates an Admitter of the given size.
+type Policy func(size int64) Admitter
+
+// FIFO admits requests in arrival order, through a semaphore.Weighted created
+// with opts.
+func FIFO(opts ...semaphore.Option) Policy {
+	return func(size int64) Admitter {
+		return weighted{semaphore.NewWeighted(size, opts...)}
+	}
+}
+
+type weighted struct{ sem *semaphore.Weighted }
+
+func (w weighted) Acquire(ctx context.Context, _ string, n int64) error { return w.sem.Acquire(ctx, n) }
+func (w weighted) Release(_ string, n int64)                            { w.sem.Release(n) }
+
+// FairShare admits requests in proportion to tenant shares, through a
+// semaphore.FairShare with the given usage half-life.
+func FairShare(halfLife time.Duration) Policy {
+	return func(size int64) Admitter {
+		return semaphore.NewFairShare(semaphore.NewWeighted(size), halfLife)
+	}
+}
+
+// Report summarizes a replay.
+type Report struct {
+	Policy string
+	Size   int64
+	// Requests is the number of requests replayed, and Elapsed the time from
+	// the start of the replay until the last one released.
+	Requests int
+	Elapsed  time.Duration
+	// Failures is the number of requests the admitter failed to acquire for.
+	// They are left out of every other statistic.
+	Failures int
+	// Throughput is in admitted requests per second.
+	Throughput float64
+	// P50, P90 and P99 are wait percentiles.
+	P50, P90, P99 time.Duration
+	// Fairness is Jain's fairness index of the mean waits of the tenants: 1
+	// when all tenants wait equally long, down to 1/tenants when one tenant
+	// does all the waiting.
+	Fairness float64
+}
+
+// Replay replays reqs against admitter and reports the outcome under the given
+// policy name and size.
+func Replay(name string, size int64, admitter Admitter, reqs []Request) Report {
+	waits := make([]time.Duration, len(reqs))
+	failed := make([]bool, len(reqs))
+	ctx := context.Background()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		if d := req.At - time.Since(start); d > 0 {
+			time.Sleep(d)
+		}
+		wg.Add(1)
+		go func(i int, req Request) {
+			defer wg.Done()
+			arrived := time.Now()
+			if err := admitter.Acquire(ctx, req.Tenant, req.Weight); err != nil {
+				failed[i] = true
+				return
+			}
+			waits[i] = time.Since(arrived)
+			time.Sleep(req.Hold)
+			admitter.Release(req.Tenant, req.Weight)
+		}(i, req)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var admitted []Request
+	var sorted []time.Duration
+	for i, req := range reqs {
+		if !failed[i] {
+			admitted = append(admitted, req)
+			sorted = append(sorted, waits[i])
+		}
+	}
+	report := Report{
+		Policy:   name,
+		Size:     size,
+		Requests: len(reqs),
+		Elapsed:  elapsed,
+		Failures: len(reqs) - len(admitted),
+		Fairness: fairness(admitted, sorted),
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(len(admitted)) / elapsed.Seconds()
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	report.P50 = percentile(sorted, 0.50)
+	report.P90 = percentile(sorted, 0.90)
+	report.P99 = percentile(sorted, 0.99)
+	return report
+}
+
+// Compare replays reqs under every combination of policy and size, in the
+// order of sizes and then of policy names.
+func Compare(policies map[string]Policy, sizes []int64, reqs []Request) []Report {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var reports []Report
+	for _, size := range sizes {
+		for _, name := range names {
+			reports = append(reports, Replay(name, size, policies[name](size), reqs))
+		}
+	}
+	return reports
+}
+
+func fairness(reqs []Request, waits []time.Duration) float64 {
+	type total struct {
+		wait time.Duration
+		n    int
+	}
+	tenants := make(map[string]*total)
+	for i, req := range reqs {
+		t, ok := tenants[req.Tenant]
+		if !ok {
+			t = &total{}
+			tenants[req.Tenant] = t
+		}
+		t.wait += waits[i]
+		t.n++
+	}
+
+	var sum, sumSquares float64
+	for _, t := range tenants {
+		mean := float64(t.wait) / float64(t.n)
+		sum += mean
+		sumSquares += mean * mean
+	}
+	if sumSquares == 0 {
+		return 1
+	}
+	return sum * sum / (float64(len(tenants)) * sumSquares)
+}
+
+// percentile returns the q-quantile of sorted using the nearest-rank method,
+// with the rank rounded as in the windowed statistics of package semaphore, so
+// the two agree on the same waits.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(q*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
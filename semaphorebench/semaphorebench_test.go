@@ -0,0 +1,122 @@
+package semaphorebench
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testWorkload() Workload {
+	return Workload{
+		Requests: 200,
+		Arrival:  50 * time.Microsecond,
+		Weight:   Uniform(1, 2),
+		Hold:     Exponential(500 * time.Microsecond),
+		Tenants:  3,
+		Seed:     1,
+	}
+}
+
+func TestWorkloadGenerateDeterministic(t *testing.T) {
+	t.Parallel()
+
+	a, b := testWorkload().Generate(), testWorkload().Generate()
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("same seed generated different workloads")
+	}
+	for i, req := range a {
+		if req.Weight < 1 || req.Weight > 2 {
+			t.Fatalf("reqs[%d]: weight %d outside [1, 2]", i, req.Weight)
+		}
+		if i > 0 && req.At < a[i-1].At {
+			t.Fatalf("reqs[%d]: arrives before its predecessor", i)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	reqs := testWorkload().Generate()
+	reports := Compare(map[string]Policy{
+		"fifo": FIFO(),
+		"fair": FairShare(time.Second),
+	}, []int64{2, 8}, reqs)
+
+	if len(reports) != 4 {
+		t.Fatalf("got %d reports, want 4", len(reports))
+	}
+	want := []struct {
+		policy string
+		size   int64
+	}{{"fair", 2}, {"fifo", 2}, {"fair", 8}, {"fifo", 8}}
+	for i, r := range reports {
+		if r.Policy != want[i].policy || r.Size != want[i].size {
+			t.Errorf("reports[%d]: got %s/%d, want %s/%d", i, r.Policy, r.Size, want[i].policy, want[i].size)
+		}
+		if r.Requests != len(reqs) || r.Throughput <= 0 {
+			t.Errorf("reports[%d]: %d requests at %.0f/s", i, r.Requests, r.Throughput)
+		}
+		if r.P50 > r.P90 || r.P90 > r.P99 {
+			t.Errorf("reports[%d]: percentiles out of order: %v %v %v", i, r.P50, r.P90, r.P99)
+		}
+		if r.Fairness <= 0 || r.Fairness > 1 {
+			t.Errorf("reports[%d]: fairness %v outside (0, 1]", i, r.Fairness)
+		}
+	}
+}
+
+// denyOdd fails every other acquisition, and panics on releases of weight it
+// didn't grant.
+type denyOdd struct {
+	mu    sync.Mutex
+	calls int
+	held  int64
+}
+
+func (d *denyOdd) Acquire(ctx context.Context, tenant string, n int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	if d.calls%2 == 1 {
+		return errors.New("denied")
+	}
+	d.held += n
+	return nil
+}
+
+func (d *denyOdd) Release(tenant string, n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.held -= n; d.held < 0 {
+		panic("denyOdd: bad release")
+	}
+}
+
+func TestReplayFailures(t *testing.T) {
+	t.Parallel()
+
+	reqs := testWorkload().Generate()[:10]
+	r := Replay("deny", 1, &denyOdd{}, reqs)
+	if r.Requests != 10 || r.Failures != 5 {
+		t.Errorf("got %d requests and %d failures, want 10 and 5", r.Requests, r.Failures)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+
+	sorted := []time.Duration{1, 2, 3, 4}
+	tries := []struct {
+		q    float64
+		want time.Duration
+	}{{0, 1}, {0.5, 2}, {0.9, 4}, {0.99, 4}, {1, 4}}
+	for i, try := range tries {
+		if got := percentile(sorted, try.q); got != try.want {
+			t.Errorf("tries[%d]: got %v, want %v", i, got, try.want)
+		}
+	}
+}
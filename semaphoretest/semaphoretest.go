@@ -0,0 +1,221 @@
+// Package semaphoretest provides utilities for testing code that uses
+// semaphores: a scriptable fake semaphore, and helpers to assert on semaphores
+// and to force interleavings of acquisitions.
+package semaphoretest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ErrDenied is returned by Fake.Acquire for a scripted Deny.
+var ErrDenied = errors.New("semaphoretest: acquire denied")
+
+// Step is the scripted outcome of one acquisition from a Fake.
+type Step int
+
+const (
+	// Grant admits the acquisition immediately.
+	Grant Step = iota
+	// Deny fails the acquisition immediately with ErrDenied.
+	Deny
+	// Block makes the acquisition wait until Unblock is called or its context
+	// is done.
+	Block
+)
+
+// Fake is a semaphore whose acquisitions follow a script instead of a capacity.
+// Once the script is exhausted, every acquisition is granted. It implements
+// semaphore.AcquireReleaseResizer, so it can stand in for a semaphore.Weighted
+// in the helpers of package semaphore; its size is only recorded, and never
+// limits acquisitions. It is safe for concurrent use.
+type Fake struct {
+	mu      sync.Mutex
+	script  []Step
+	size    int64
+	cur     int64
+	calls   int
+	blocked []chan struct{}
+}
+
+// NewFake creates a new fake semaphore following script.
+func NewFake(script ...Step) *Fake {
+	return &Fake{script: script}
+}
+
+// Script appends steps to the script.
+func (f *Fake) Script(steps ...Step) {
+	f.mu.Lock()
+	f.script = append(f.script, steps...)
+	f.mu.Unlock()
+}
+
+func (f *Fake) next() Step {
+	f.calls++
+	if len(f.script) == 0 {
+		return Grant
+	}
+	step := f.script[0]
+	f.script = f.script[1:]
+	return step
+}
+
+// Acquire acquires a weight of n following the next step of the script.
+func (f *Fake) Acquire(ctx context.Context, n int64) error {
+	f.mu.Lock()
+	switch f.next() {
+	case Deny:
+		f.mu.Unlock()
+		return ErrDenied
+	case Block:
+		unblock := make(chan struct{})
+		f.blocked = append(f.blocked, unblock)
+		f.mu.Unlock()
+
+		select {
+		case <-unblock:
+			f.mu.Lock()
+		case <-ctx.Done():
+			f.mu.Lock()
+			select {
+			case <-unblock:
+				// Unblocked after we were canceled; like semaphore.Weighted,
+				// pretend we didn't notice the cancelation.
+			default:
+				f.remove(unblock)
+				f.mu.Unlock()
+				return ctx.Err()
+			}
+		}
+	}
+	f.cur += n
+	f.mu.Unlock()
+	return nil
+}
+
+// TryAcquire acquires a weight of n following the next step of the script,
+// failing for both Deny and Block.
+func (f *Fake) TryAcquire(n int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.next() != Grant {
+		return false
+	}
+	f.cur += n
+	return true
+}
+
+// Release releases a weight of n. It panics if more than held is released.
+func (f *Fake) Release(n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cur < n {
+		panic("semaphoretest: bad release")
+	}
+	f.cur -= n
+}
+
+// Unblock admits the acquisition that has been blocked the longest, reporting
+// whether there was one.
+func (f *Fake) Unblock() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.blocked) == 0 {
+		return false
+	}
+	close(f.blocked[0])
+	f.blocked = f.blocked[1:]
+	return true
+}
+
+// remove drops a blocked acquisition. Must be called with f.mu held.
+func (f *Fake) remove(unblock chan struct{}) {
+	for i, c := range f.blocked {
+		if c == unblock {
+			f.blocked = append(f.blocked[:i], f.blocked[i+1:]...)
+			return
+		}
+	}
+}
+
+// Current returns the weight currently held.
+func (f *Fake) Current() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cur
+}
+
+// Size returns the size last set by Resize, zero initially.
+func (f *Fake) Size() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
+
+// Resize records n as the size of the fake.
+func (f *Fake) Resize(n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.size = n
+}
+
+// Waiters returns the number of blocked acquisitions.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.blocked)
+}
+
+// Calls returns the number of acquisitions attempted, including denied ones.
+func (f *Fake) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// Semaphore is the part of a semaphore inspected by the assertions, satisfied
+// by both semaphore.Weighted and Fake.
+type Semaphore interface {
+	Current() int64
+	Waiters() int
+}
+
+// AssertFullyReleased reports an error if sem has weight held or waiters.
+func AssertFullyReleased(tb testing.TB, sem Semaphore) {
+	tb.Helper()
+	if cur, waiters := sem.Current(), sem.Waiters(); cur != 0 || waiters != 0 {
+		tb.Errorf("semaphore not fully released: cur=%d waiters=%d", cur, waiters)
+	}
+}
+
+// Timeout bounds how long the waiting helpers wait before failing the test.
+var Timeout = 5 * time.Second
+
+// WaitForWaiters blocks until sem has at least n waiters, failing the test
+// after Timeout. Starting acquisitions one by one and waiting for each to queue
+// forces them into a known order.
+func WaitForWaiters(tb testing.TB, sem Semaphore, n int) {
+	tb.Helper()
+	waitFor(tb, func() bool { return sem.Waiters() >= n }, "%d waiters", n)
+}
+
+// WaitForCurrent blocks until sem has a weight of exactly n held, failing the
+// test after Timeout.
+func WaitForCurrent(tb testing.TB, sem Semaphore, n int64) {
+	tb.Helper()
+	waitFor(tb, func() bool { return sem.Current() == n }, "current weight %d", n)
+}
+
+func waitFor(tb testing.TB, cond func() bool, format string, args ...interface{}) {
+	tb.Helper()
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatalf("semaphoretest: timed out waiting for "+format, args...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,117 @@
+package semaphoretest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sherifabdlnaby/semaphore"
+	"github.com/sherifabdlnaby/semaphore/semaphoretest"
+)
+
+func TestFakeScript(t *testing.T) {
+	t.Parallel()
+
+	f := semaphoretest.NewFake(semaphoretest.Grant, semaphoretest.Deny, semaphoretest.Block)
+	ctx := context.Background()
+
+	if err := f.Acquire(ctx, 2); err != nil {
+		t.Fatalf("scripted Grant: %v", err)
+	}
+	if err := f.Acquire(ctx, 1); err != semaphoretest.ErrDenied {
+		t.Fatalf("scripted Deny: got %v, want ErrDenied", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- f.Acquire(ctx, 1) }()
+	semaphoretest.WaitForWaiters(t, f, 1)
+	if !f.Unblock() {
+		t.Fatal("Unblock found no blocked acquisition")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("scripted Block: %v", err)
+	}
+
+	if !f.TryAcquire(1) {
+		t.Error("TryAcquire after the script failed")
+	}
+	if got := f.Calls(); got != 4 {
+		t.Errorf("Calls() = %d, want 4", got)
+	}
+	f.Release(4)
+	semaphoretest.AssertFullyReleased(t, f)
+}
+
+func TestFakeBlockCanceled(t *testing.T) {
+	t.Parallel()
+
+	f := semaphoretest.NewFake(semaphoretest.Block)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- f.Acquire(ctx, 1) }()
+	semaphoretest.WaitForWaiters(t, f, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	semaphoretest.AssertFullyReleased(t, f)
+}
+
+func TestWaitForWaitersOrdersWeighted(t *testing.T) {
+	t.Parallel()
+
+	sem := semaphore.NewWeighted(1)
+	ctx := context.Background()
+	sem.Acquire(ctx, 1)
+
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		i := i
+		go func() {
+			sem.Acquire(ctx, 1)
+			order <- i
+			sem.Release(1)
+		}()
+		semaphoretest.WaitForWaiters(t, sem, i+1)
+	}
+	sem.Release(1)
+	if first, second := <-order, <-order; first != 0 || second != 1 {
+		t.Errorf("admitted %d then %d, want 0 then 1", first, second)
+	}
+	semaphoretest.WaitForCurrent(t, sem, 0)
+	semaphoretest.AssertFullyReleased(t, sem)
+}
+
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper()                                   {}
+func (r *recorder) Errorf(format string, args ...interface{}) { r.failed = true }
+
+func TestAssertFullyReleased(t *testing.T) {
+	t.Parallel()
+
+	sem := semaphore.NewWeighted(2)
+	sem.Acquire(context.Background(), 1)
+	r := &recorder{TB: t}
+	semaphoretest.AssertFullyReleased(r, sem)
+	if !r.failed {
+		t.Error("AssertFullyReleased passed with weight held")
+	}
+}
+
+func TestFakeResize(t *testing.T) {
+	t.Parallel()
+
+	f := semaphoretest.NewFake()
+	f.Resize(3)
+	if size := f.Size(); size != 3 {
+		t.Errorf("got size %d, want 3", size)
+	}
+	if !f.TryAcquire(5) {
+		t.Error("size limited an acquisition of the fake")
+	}
+}
+
+var _ semaphore.AcquireReleaseResizer = (*semaphoretest.Fake)(nil)
@@ -0,0 +1,157 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrSLOShed is returned by SLOEnforcer.Acquire when a request that would have
+// to wait is shed because the wait SLO is exceeded.
+var ErrSLOShed = errors.New("semaphore: wait SLO exceeded, request shed")
+
+// SLOAction is what an SLOEnforcer does while the wait SLO is exceeded.
+type SLOAction int
+
+const (
+	// SLOShed rejects acquisitions that would have to wait.
+	SLOShed SLOAction = iota
+	// SLOResize grows the semaphore.
+	SLOResize
+)
+
+// SLOConfig configures an SLOEnforcer.
+type SLOConfig struct {
+	// Window is the rolling window over which waits are tracked.
+	Window time.Duration
+	// Target is the maximum acceptable p99 wait.
+	Target time.Duration
+	// Action is taken while the p99 wait exceeds Target.
+	Action SLOAction
+	// ResizeStep and MaxSize bound growth under SLOResize.
+	ResizeStep, MaxSize int64
+	// OnEnforce, if not nil, is called for every enforcement action.
+	OnEnforce func(SLOEvent)
+	// Sampler, if not nil, selects the acquisitions whose waits are recorded.
+	Sampler *Sampler
+}
+
+// SLOEvent reports an enforcement action.
+type SLOEvent struct {
+	Action SLOAction
+	// Active is false when shedding stops.
+	Active bool
+	// P99 is the p99 wait that triggered the action.
+	P99 time.Duration
+	// Size is the size of the semaphore after the action.
+	Size int64
+}
+
+// SLOEnforcer acquires from a Weighted while tracking the distribution of
+// queue waits over a rolling window. When the p99 wait exceeds the target, it
+// sheds requests that would wait, or grows the semaphore, until waits recover.
+type SLOEnforcer struct {
+	sem      AcquireReleaseResizer
+	cfg      SLOConfig
+	mu       sync.Mutex
+	waits    *waitWindow
+	checked  time.Time
+	shedding bool
+}
+
+// NewSLOEnforcer creates a new SLOEnforcer acquiring from sem.
+func NewSLOEnforcer(sem AcquireReleaseResizer, cfg SLOConfig) *SLOEnforcer {
+	if cfg.Window <= 0 || cfg.Target <= 0 {
+		panic("semaphore: bad SLO config")
+	}
+	return &SLOEnforcer{sem: sem, cfg: cfg, waits: newWaitWindow(cfg.Window)}
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until resources
+// are available or ctx is done, and records how long it waited. While shedding,
+// it fails with ErrSLOShed instead of waiting. On failure, leaves the semaphore
+// unchanged.
+func (e *SLOEnforcer) Acquire(ctx context.Context, n int64) error {
+	if e.sem.TryAcquire(n) {
+		e.observe(0)
+		return nil
+	}
+
+	e.mu.Lock()
+	shedding := e.shedding
+	e.mu.Unlock()
+	if shedding {
+		e.observe(0)
+		return ErrSLOShed
+	}
+
+	start := time.Now()
+	err := e.sem.Acquire(ctx, n)
+	e.observe(time.Since(start))
+	return err
+}
+
+// Release releases the semaphore with a weight of n.
+func (e *SLOEnforcer) Release(n int64) {
+	e.sem.Release(n)
+}
+
+// Percentile returns the q-quantile, q in [0, 1], of the waits in the window.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (e *SLOEnforcer) Percentile(q float64) time.Duration {
+	e.mu.Lock()
+	samples := e.waits.snapshot(time.Now())
+	e.mu.Unlock()
+	return newWaitDistribution(samples).percentile(q)
+}
+
+// observe records a wait and enforces the SLO, at most ten times per window.
+func (e *SLOEnforcer) observe(wait time.Duration) {
+	if !e.cfg.Sampler.Sample() {
+		return
+	}
+	now := time.Now()
+	e.mu.Lock()
+	e.waits.observe(now, wait)
+	if now.Sub(e.checked) < e.cfg.Window/10 {
+		e.mu.Unlock()
+		return
+	}
+	e.checked = now
+
+	p99 := newWaitDistribution(e.waits.snapshot(now)).percentile(0.99)
+	exceeded := p99 > e.cfg.Target
+
+	var events []SLOEvent
+	switch e.cfg.Action {
+	case SLOShed:
+		if exceeded != e.shedding {
+			e.shedding = exceeded
+			events = append(events, SLOEvent{Action: SLOShed, Active: exceeded, P99: p99, Size: e.sem.Size()})
+		}
+	case SLOResize:
+		if size := e.sem.Size(); exceeded && size < e.cfg.MaxSize {
+			size += e.cfg.ResizeStep
+			if size > e.cfg.MaxSize {
+				size = e.cfg.MaxSize
+			}
+			e.sem.Resize(size)
+			events = append(events, SLOEvent{Action: SLOResize, Active: true, P99: p99, Size: size})
+		}
+	}
+	e.mu.Unlock()
+
+	inst := instrumentationOf(e.sem)
+	for _, ev := range events {
+		report(inst, "semaphore.slo.enforcements", 1, slog.Bool("resize", ev.Action == SLOResize), slog.Bool("active", ev.Active))
+	}
+	if e.cfg.OnEnforce != nil {
+		for _, ev := range events {
+			e.cfg.OnEnforce(ev)
+		}
+	}
+}
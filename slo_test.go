@@ -0,0 +1,78 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSLOEnforcerShed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	events := make(chan SLOEvent, 10)
+	e := NewSLOEnforcer(sem, SLOConfig{
+		Window:    50 * time.Millisecond,
+		Target:    time.Millisecond,
+		Action:    SLOShed,
+		OnEnforce: func(ev SLOEvent) { events <- ev },
+	})
+
+	// One slow wait pushes p99 over target.
+	e.Acquire(ctx, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		e.Release(1)
+	}()
+	if err := e.Acquire(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-events; ev.Action != SLOShed || !ev.Active || ev.P99 < 5*time.Millisecond {
+		t.Fatalf("got event %+v, want shedding to start", ev)
+	}
+
+	if err := e.Acquire(ctx, 1); err != ErrSLOShed {
+		t.Fatalf("got %v, want %v", err, ErrSLOShed)
+	}
+
+	// Once the slow wait leaves the window, shedding stops.
+	e.Release(1)
+	time.Sleep(60 * time.Millisecond)
+	if err := e.Acquire(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-events; ev.Active {
+		t.Errorf("got event %+v, want shedding to stop", ev)
+	}
+}
+
+func TestSLOEnforcerResize(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	e := NewSLOEnforcer(sem, SLOConfig{
+		Window:     50 * time.Millisecond,
+		Target:     time.Millisecond,
+		Action:     SLOResize,
+		ResizeStep: 2,
+		MaxSize:    2,
+	})
+
+	e.Acquire(ctx, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		e.Release(1)
+	}()
+	e.Acquire(ctx, 1)
+
+	if size := sem.Size(); size != 2 {
+		t.Errorf("got size %d, want it grown to the max of 2", size)
+	}
+	if p := e.Percentile(0.99); p < 5*time.Millisecond {
+		t.Errorf("got p99 %v, want the slow wait", p)
+	}
+}
@@ -0,0 +1,10 @@
+package semaphore
+
+// Snapshot is the size, usage and queue length of a semaphore, read at once so
+// they are consistent with each other, unlike separate calls to Size, Current
+// and Waiters.
+type Snapshot struct {
+	Size    int64
+	Current int64
+	Waiters int
+}
@@ -0,0 +1,134 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// State is a lifecycle state of a Weighted.
+//
+// A semaphore starts Open and moves to Paused and back with Pause and Resume.
+// Draining and Closed are shutdown states: Drain refuses acquisitions while
+// in-flight holders finish and closes the semaphore once they have, Close
+// refuses every acquisition right away with its cause. Closed is terminal.
+type State int32
+
+const (
+	// StateOpen admits acquisitions.
+	StateOpen State = iota
+	// StatePaused queues acquisitions without admitting or failing them.
+	StatePaused
+	// StateDraining refuses new acquisitions while holders finish.
+	StateDraining
+	// StateClosed refuses every acquisition.
+	StateClosed
+)
+
+func (st State) String() string {
+	switch st {
+	case StateOpen:
+		return "open"
+	case StatePaused:
+		return "paused"
+	case StateDraining:
+		return "draining"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("State(%d)", int32(st))
+}
+
+// ErrClosed is returned by acquisitions from a semaphore closed by Close
+// without a cause.
+var ErrClosed = errors.New("semaphore: closed")
+
+// StateError is returned by acquisitions refused because of the semaphore's
+// state.
+type StateError struct {
+	State State
+}
+
+func (e *StateError) Error() string {
+	return "semaphore: acquire refused, semaphore is " + e.State.String()
+}
+
+// Is reports whether e is refused for the semaphore being closed, if target is
+// ErrClosed, so drained and closed semaphores fail alike for errors.Is.
+func (e *StateError) Is(target error) bool {
+	return target == ErrClosed && e.State == StateClosed
+}
+
+// StateChange describes a transition between two states.
+type StateChange struct {
+	From, To State
+}
+
+// stateWatchBuffer is the number of transitions buffered for a watcher that
+// isn't keeping up; further transitions are dropped.
+const stateWatchBuffer = 16
+
+// State returns the lifecycle state of the semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) State() State {
+	s.lock()
+	state := s.state
+	s.mu.Unlock()
+	return state
+}
+
+// WatchState returns a channel receiving every state transition of the
+// semaphore until ctx is done, at which point the channel is closed. A watcher
+// that falls more than a few transitions behind misses transitions, so use
+// State to resynchronize.
+func (s *Weighted) WatchState(ctx context.Context) <-chan StateChange {
+	ch := make(chan StateChange, stateWatchBuffer)
+	s.lock()
+	if s.stateWatchers == nil {
+		s.stateWatchers = make(map[chan StateChange]struct{})
+	}
+	s.stateWatchers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.lock()
+		delete(s.stateWatchers, ch)
+		s.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+// setState moves the semaphore to state to and notifies watchers. Transitions
+// out of StateClosed, and from a shutdown state back to Open or Paused, are
+// ignored. Returns whether the state changed. Must be called with s.mu held.
+func (s *Weighted) setState(to State) bool {
+	from := s.state
+	if from == to || from == StateClosed || (from == StateDraining && to < StateDraining) {
+		return false
+	}
+	s.state = to
+	s.version++
+	for ch := range s.stateWatchers {
+		select {
+		case ch <- StateChange{From: from, To: to}:
+		default:
+		}
+	}
+	return true
+}
+
+// refused returns the error for an acquisition refused in the current state, or
+// nil if the state admits acquisitions. Must be called with s.mu held.
+func (s *Weighted) refused() error {
+	if s.closeErr != nil {
+		return s.closeErr
+	}
+	if s.state >= StateDraining {
+		return &StateError{State: s.state}
+	}
+	return nil
+}
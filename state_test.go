@@ -0,0 +1,115 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWeightedWatchState(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sem := NewWeighted(1)
+	events := sem.WatchState(ctx)
+
+	if st := sem.State(); st != StateOpen {
+		t.Fatalf("got state %v, want %v", st, StateOpen)
+	}
+
+	sem.Pause()
+	sem.Pause() // No transition.
+	sem.Resume()
+
+	want := []StateChange{{StateOpen, StatePaused}, {StatePaused, StateOpen}}
+	for i, w := range want {
+		if got := <-events; got != w {
+			t.Errorf("event[%d]: got %v, want %v", i, got, w)
+		}
+	}
+
+	cancel()
+	for range events {
+		t.Error("unexpected event after cancel")
+	}
+}
+
+func TestWeightedStateRefused(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	sem.lock()
+	sem.setState(StateDraining)
+	if sem.setState(StateOpen) {
+		t.Error("draining semaphore transitioned back to open")
+	}
+	sem.mu.Unlock()
+
+	err := sem.Acquire(context.Background(), 1)
+	if se, ok := err.(*StateError); !ok || se.State != StateDraining {
+		t.Fatalf("got %v, want *StateError for %v", err, StateDraining)
+	}
+	if sem.TryAcquire(1) {
+		t.Error("TryAcquire succeeded on a draining semaphore")
+	}
+	if got, want := StateClosed.String(), "closed"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWeightedClose(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	sem.Acquire(ctx, 1)
+	done := make(chan error, 2)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	go func() { done <- sem.Acquire(ctx, 2) }() // Impossible.
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cause := errors.New("shutting down")
+	sem.Close(cause)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != cause {
+			t.Fatalf("queued Acquire got %v, want %v", err, cause)
+		}
+	}
+	if err := sem.Acquire(ctx, 1); err != cause {
+		t.Fatalf("Acquire on a closed semaphore got %v, want %v", err, cause)
+	}
+	if sem.TryAcquire(1) {
+		t.Fatal("TryAcquire succeeded on a closed semaphore")
+	}
+	sem.Release(1)
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d after release, want 0", cur)
+	}
+
+	sem.Close(nil)
+	sem.Drain(ctx)
+	if err := sem.Acquire(ctx, 1); err != cause {
+		t.Errorf("closing again replaced the cause with %v", err)
+	}
+}
+
+func TestWeightedCloseErrClosed(t *testing.T) {
+	t.Parallel()
+
+	closed := NewWeighted(1)
+	closed.Close(nil)
+	if err := closed.Acquire(context.Background(), 1); err != ErrClosed {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+
+	drained := NewWeighted(1)
+	drained.Drain(context.Background())
+	if err := drained.Acquire(context.Background(), 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("drained semaphore got %v, want an error matching ErrClosed", err)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// Stats is a consistent snapshot of a semaphore's state and of its cumulative
+// counters since creation.
+type Stats struct {
+	Size    int64 // See Size.
+	Current int64 // See Current.
+	Waiters int   // See Waiters.
+	State   State // See State.
+	Version uint64
+
+	Acquires      int64 // Successful acquisitions, including bypassed ones.
+	Releases      int64 // Release calls.
+	Cancellations int64 // Waits abandoned because their context was done.
+	TooLarge      int64 // Acquisitions failed with ErrRequestTooLarge or ErrResized.
+	PeakCurrent   int64 // Highest weight held at once.
+	PeakWaiters   int   // Longest the queue has been.
+}
+
+// counters are the cumulative counters reported by Stats.
+type counters struct {
+	acquires, releases, cancellations, tooLarge int64
+	peakCurrent                                 int64
+	peakWaiters                                 int
+}
+
+// Stats returns the state and counters of the semaphore, read at once.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Stats() Stats {
+	s.lock()
+	defer s.mu.Unlock()
+	peak := s.counters.peakCurrent
+	if fastPeak := s.fast.peak.Load(); fastPeak > peak {
+		peak = fastPeak
+	}
+	return Stats{
+		Size:          s.size,
+		Current:       s.cur,
+		Waiters:       s.waiters.Len() + s.impossibleWaiters.Len(),
+		State:         s.state,
+		Version:       s.fastVersion(),
+		Acquires:      s.counters.acquires + s.fast.acquires.Load(),
+		Releases:      s.counters.releases + s.fast.releases.Load(),
+		Cancellations: s.counters.cancellations,
+		TooLarge:      s.counters.tooLarge,
+		PeakCurrent:   peak,
+		PeakWaiters:   s.counters.peakWaiters,
+	}
+}
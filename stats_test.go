@@ -0,0 +1,82 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedStats(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	sem.Acquire(ctx, 1)
+	sem.Acquire(ctx, 1)
+
+	canceled, cancel := context.WithCancel(ctx)
+	done := make(chan error, 2)
+	go func() { done <- sem.Acquire(canceled, 1) }()
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Release(1)
+	for i := 0; i < 2; i++ {
+		<-done
+	}
+	if err := sem.AcquireStrict(ctx, 3); err != ErrRequestTooLarge {
+		t.Fatalf("AcquireStrict = %v, want ErrRequestTooLarge", err)
+	}
+
+	got := sem.Stats()
+	want := Stats{
+		Size:          2,
+		Current:       2,
+		Version:       got.Version,
+		Acquires:      3,
+		Releases:      1,
+		Cancellations: 1,
+		TooLarge:      1,
+		PeakCurrent:   2,
+		PeakWaiters:   2,
+	}
+	if got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got.Version != sem.Version() {
+		t.Errorf("Stats().Version = %d, want %d", got.Version, sem.Version())
+	}
+}
+
+func TestWeightedStatsState(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+
+	tries := []State{}
+	tries = append(tries, sem.Stats().State) // open
+	sem.Pause()
+	tries = append(tries, sem.Stats().State) // paused
+	sem.Resume()
+	go sem.Drain(context.Background())
+	waitUntil(t, func() bool { return sem.State() == StateDraining })
+	tries = append(tries, sem.Stats().State) // draining; one holder left
+	sem.Release(1)
+	waitUntil(t, func() bool { return sem.State() == StateClosed })
+	tries = append(tries, sem.Stats().State) // closed
+
+	want := []State{StateOpen, StatePaused, StateDraining, StateClosed}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %v, want %v", i, tries[i], want[i])
+		}
+	}
+}
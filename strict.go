@@ -0,0 +1,56 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrRequestTooLarge is returned by strict acquisitions of more weight than the
+// semaphore's size.
+var ErrRequestTooLarge = errors.New("semaphore: request larger than semaphore size")
+
+// ErrResized is returned by an acquisition waiting for more weight than the
+// size left by a ResizeWithMode in ResizeStrict mode.
+var ErrResized = errors.New("semaphore: resized below request")
+
+// ResizeMode is how a Resize treats waiters that no longer fit.
+type ResizeMode int
+
+const (
+	// ResizeGraceful keeps waiters larger than the new size queued, in case a
+	// later Resize grows it again. It is the mode of Resize.
+	ResizeGraceful ResizeMode = iota
+	// ResizeStrict fails waiters larger than the new size with ErrResized, so
+	// shrinking doesn't strand them. Waiters queued before are failed too.
+	ResizeStrict
+)
+
+// ResizeWithMode resizes the semaphore to n, as Resize does, treating waiters
+// that no longer fit according to mode. Holders are never affected.
+func (s *Weighted) ResizeWithMode(n int64, mode ResizeMode) {
+	if mode != ResizeGraceful && mode != ResizeStrict {
+		panic("semaphore: bad resize mode")
+	}
+	s.lock()
+	s.resize(n, mode)
+	s.unlock()
+}
+
+// WithStrictSize makes every acquisition strict, as AcquireStrict is: requests
+// larger than the size fail with ErrRequestTooLarge instead of waiting for a
+// Resize that may never come.
+func WithStrictSize() Option {
+	return func(s *Weighted) {
+		s.strict = true
+	}
+}
+
+// AcquireStrict acquires the semaphore with a weight of n, as Acquire does,
+// but fails immediately with ErrRequestTooLarge if n exceeds the size, and
+// while waiting if a Resize makes it exceed the size.
+func (s *Weighted) AcquireStrict(ctx context.Context, n int64) error {
+	_, err := s.acquire(ctx, request{n: n, max: n, strict: true})
+	return err
+}
@@ -0,0 +1,93 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedAcquireStrict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	if err := sem.AcquireStrict(ctx, 3); err != ErrRequestTooLarge {
+		t.Fatalf("got %v, want ErrRequestTooLarge", err)
+	}
+	if n := sem.Waiters(); n != 0 {
+		t.Errorf("got %d waiters, want 0", n)
+	}
+
+	// A strict waiter fails once a Resize makes it impossible; others wait.
+	sem.Acquire(ctx, 2)
+	strict := make(chan error)
+	go func() { strict <- sem.AcquireStrict(ctx, 2) }()
+	lenient := make(chan error)
+	go func() { lenient <- sem.Acquire(ctx, 2) }()
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	sem.Resize(1)
+	if err := <-strict; err != ErrRequestTooLarge {
+		t.Errorf("strict waiter got %v, want ErrRequestTooLarge", err)
+	}
+	if n := sem.Waiters(); n != 1 {
+		t.Errorf("got %d waiters, want the lenient one", n)
+	}
+	sem.Resize(2)
+	sem.Release(2)
+	if err := <-lenient; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWeightedStrictSize(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1, WithStrictSize())
+	if err := sem.Acquire(context.Background(), 2); err != ErrRequestTooLarge {
+		t.Errorf("Acquire got %v, want ErrRequestTooLarge", err)
+	}
+	if acquired, _ := sem.AcquireChan(2); <-acquired != ErrRequestTooLarge {
+		t.Error("AcquireChan didn't fail with ErrRequestTooLarge")
+	}
+	if err := sem.Acquire(context.Background(), 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWeightedResizeStrict(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4)
+	sem.Acquire(ctx, 4)
+	impossible := make(chan error)
+	go func() { impossible <- sem.Acquire(ctx, 5) }()
+	large := make(chan error)
+	go func() { large <- sem.Acquire(ctx, 3) }()
+	small := make(chan error)
+	go func() { small <- sem.Acquire(ctx, 2) }()
+	for sem.Waiters() != 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sem.ResizeWithMode(2, ResizeStrict)
+	if err := <-impossible; err != ErrResized {
+		t.Errorf("waiter impossible before the resize got %v, want ErrResized", err)
+	}
+	if err := <-large; err != ErrResized {
+		t.Errorf("waiter made impossible got %v, want ErrResized", err)
+	}
+	if n := sem.Waiters(); n != 1 {
+		t.Errorf("got %d waiters, want the one that still fits", n)
+	}
+
+	// Holders are unaffected and the remaining waiter is admitted later.
+	sem.Release(4)
+	if err := <-small; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// String summarizes the semaphore's name, state, usage and queue, e.g.
+//
+//	Weighted "db": open, cur=3 size=5 waiters=2 queued=4
+//
+// where queued is the combined weight the waiters ask for.
+func (s *Weighted) String() string {
+	s.lock()
+	defer s.mu.Unlock()
+	var queued QueueBreakdown
+	queued.add(&s.waiters)
+	queued.add(&s.impossibleWaiters)
+	return fmt.Sprintf("Weighted%s: %v, cur=%d size=%d waiters=%d queued=%d",
+		quotedName(s.name), s.state, s.cur, s.size, queued.Waiters, queued.Weight)
+}
+
+// Name returns the name of the semaphore given WithName.
+func (s *Weighted) Name() string {
+	return s.name
+}
+
+// String summarizes the semaphore's usage and queue, e.g.
+//
+//	Vector: cur=[2 512] size=[4 1024] waiters=1
+func (s *Vector) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("Vector: cur=%v size=%v waiters=%d", s.cur, s.size, s.waiters.Len()+s.impossibleWaiters.Len())
+}
+
+// String summarizes the gate's state and queue, e.g.
+//
+//	Gate: closed, waiters=3
+func (g *Gate) String() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state := "closed"
+	if g.open {
+		state = "open"
+	}
+	return fmt.Sprintf("Gate: %s, waiters=%d", state, g.waiters.Len())
+}
+
+// String summarizes the class's limits and usage, e.g.
+//
+//	Class "batch": use=3 guaranteed=2 ceiling=4
+func (c *Class) String() string {
+	c.h.mu.Lock()
+	defer c.h.mu.Unlock()
+	return fmt.Sprintf("Class%s: use=%d guaranteed=%d ceiling=%d", quotedName(c.name), c.use, c.guaranteed, c.ceiling)
+}
+
+func quotedName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " " + strconv.Quote(name)
+}
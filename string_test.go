@@ -0,0 +1,40 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedString(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(5, WithName("db"))
+	sem.Acquire(ctx, 3)
+	go sem.Acquire(ctx, 3)
+	go sem.Acquire(ctx, 6) // Impossible.
+	for sem.Waiters() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	want := `Weighted "db": open, cur=3 size=5 waiters=2 queued=9`
+	if got := sem.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := NewWeighted(1).String(), "Weighted: open, cur=0 size=1 waiters=0 queued=0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := NewVector(4, 1024).String(), "Vector: cur=[0 0] size=[4 1024] waiters=0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := NewGate(false).String(), "Gate: closed, waiters=0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := NewHierarchy(4).Root().NewClass("batch", 2, 4).String(), `Class "batch": use=0 guaranteed=2 ceiling=4`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,235 @@
+//go:build tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync"
+)
+
+// This file is a compact implementation of the core API for TinyGo and other
+// constrained targets, selected by the tinygo build tag, which TinyGo sets;
+// on js, semaphore_js.go is used instead. It avoids container/list, reflection
+// and fmt, and recycles its waiters so that once the peak number of concurrent
+// waiters has been reached it no longer allocates.
+
+// Option configures a Weighted at construction time.
+type Option func(*Weighted)
+
+type waiter struct {
+	n          int64
+	ready      chan struct{} // Receives when semaphore acquired; reused.
+	granted    bool
+	prev, next *waiter
+}
+
+// Weighted provides a way to bound concurrent access to a resource.
+// The callers can request access with a given weight.
+type Weighted struct {
+	size    int64
+	cur     int64
+	mu      sync.Mutex
+	head    *waiter // Waiters in FIFO order.
+	tail    *waiter
+	waiters int
+	free    *waiter // Recycled waiters.
+}
+
+// NewWeighted creates a new weighted semaphore with the given
+// maximum combined weight for concurrent access.
+func NewWeighted(n int64, opts ...Option) *Weighted {
+	w := &Weighted{size: n}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until resources
+// are available or ctx is done. On success, returns nil. On failure, returns
+// ctx.Err() and leaves the semaphore unchanged.
+//
+// If ctx is already done, Acquire may still succeed without blocking.
+func (s *Weighted) Acquire(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.blocker() == nil {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	w := s.get(n)
+	s.push(w)
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		s.mu.Lock()
+		if w.granted {
+			// Acquired the semaphore after we were canceled.  Rather than trying to
+			// fix up the queue, just pretend we didn't notice the cancelation.
+			<-w.ready
+			err = nil
+		} else {
+			s.unlink(w)
+			s.notifyWaiters()
+		}
+		s.put(w)
+		s.mu.Unlock()
+		return err
+
+	case <-w.ready:
+		s.mu.Lock()
+		s.put(w)
+		s.mu.Unlock()
+		return nil
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking.
+// On success, returns true. On failure, returns false and leaves the semaphore unchanged.
+func (s *Weighted) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	success := s.size-s.cur >= n && s.blocker() == nil
+	if success {
+		s.cur += n
+	}
+	s.mu.Unlock()
+	return success
+}
+
+// Release releases the semaphore with a weight of n.
+func (s *Weighted) Release(n int64) {
+	s.mu.Lock()
+	s.cur -= n
+	if s.cur < 0 {
+		s.mu.Unlock()
+		panic("semaphore: bad release")
+	}
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// Resize resizes the semaphore to the given maximum combined weight.
+func (s *Weighted) Resize(n int64) {
+	if n < 0 {
+		panic("semaphore: bad resize")
+	}
+	s.mu.Lock()
+	s.size = n
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// Current returns the current size of semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Current() int64 {
+	s.mu.Lock()
+	cur := s.cur
+	s.mu.Unlock()
+	return cur
+}
+
+// Size returns the maximum size of semaphore.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Size() int64 {
+	s.mu.Lock()
+	size := s.size
+	s.mu.Unlock()
+	return size
+}
+
+// Waiters returns the number of currently waiting Acquire calls.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Waiters() int {
+	s.mu.Lock()
+	waiters := s.waiters
+	s.mu.Unlock()
+	return waiters
+}
+
+// Snapshot returns the size, usage and number of waiters of the semaphore,
+// read at once.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Snapshot() Snapshot {
+	s.mu.Lock()
+	snap := Snapshot{Size: s.size, Current: s.cur, Waiters: s.waiters}
+	s.mu.Unlock()
+	return snap
+}
+
+// blocker returns the first waiter whose request fits the size, which newcomers
+// must not overtake. Waiters requesting more than the size are impossible until
+// a Resize and block nobody. Must be called with s.mu held.
+func (s *Weighted) blocker() *waiter {
+	for w := s.head; w != nil; w = w.next {
+		if w.n <= s.size {
+			return w
+		}
+	}
+	return nil
+}
+
+// notifyWaiters admits possible waiters in FIFO order while they fit, leaving
+// the rest blocked to avoid starving large requests. Must be called with s.mu
+// held.
+func (s *Weighted) notifyWaiters() {
+	for {
+		w := s.blocker()
+		if w == nil || s.size-s.cur < w.n {
+			break
+		}
+		s.cur += w.n
+		s.unlink(w)
+		w.granted = true
+		w.ready <- struct{}{}
+	}
+}
+
+// get returns a recycled or new waiter for a weight of n. Must be called with
+// s.mu held.
+func (s *Weighted) get(n int64) *waiter {
+	w := s.free
+	if w == nil {
+		w = &waiter{ready: make(chan struct{}, 1)}
+	} else {
+		s.free = w.next
+	}
+	*w = waiter{n: n, ready: w.ready}
+	return w
+}
+
+// put recycles a waiter that left the queue. Must be called with s.mu held.
+func (s *Weighted) put(w *waiter) {
+	*w = waiter{ready: w.ready, next: s.free}
+	s.free = w
+}
+
+// push appends w to the queue. Must be called with s.mu held.
+func (s *Weighted) push(w *waiter) {
+	w.prev = s.tail
+	if s.tail == nil {
+		s.head = w
+	} else {
+		s.tail.next = w
+	}
+	s.tail = w
+	s.waiters++
+}
+
+// unlink removes w from the queue. Must be called with s.mu held.
+func (s *Weighted) unlink(w *waiter) {
+	if w.prev == nil {
+		s.head = w.next
+	} else {
+		w.prev.next = w.next
+	}
+	if w.next == nil {
+		s.tail = w.prev
+	} else {
+		w.next.prev = w.prev
+	}
+	w.prev, w.next = nil, nil
+	s.waiters--
+}
@@ -0,0 +1,96 @@
+//go:build tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTinyFIFO(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	sem.Acquire(ctx, 2)
+
+	admitted := make(chan int64, 2)
+	for i, n := range []int64{2, 1} {
+		n := n
+		go func() {
+			sem.Acquire(ctx, n)
+			admitted <- n
+		}()
+		for sem.Waiters() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The large waiter at the head keeps the small one from overtaking it.
+	if sem.TryAcquire(1) {
+		t.Fatal("TryAcquire overtook the queue")
+	}
+	sem.Release(1)
+	select {
+	case n := <-admitted:
+		t.Fatalf("admitted %d before the head of the queue", n)
+	case <-time.After(10 * time.Millisecond):
+	}
+	sem.Release(1)
+	if first := <-admitted; first != 2 {
+		t.Fatalf("admitted %d first, want 2", first)
+	}
+	sem.Release(2)
+	<-admitted
+	sem.Release(1)
+	if cur, waiters := sem.Current(), sem.Waiters(); cur != 0 || waiters != 0 {
+		t.Errorf("got cur=%d waiters=%d, want 0 and 0", cur, waiters)
+	}
+}
+
+func TestTinyImpossibleWaiter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(1)
+	done := make(chan struct{})
+	go func() {
+		sem.Acquire(ctx, 3)
+		close(done)
+	}()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A request larger than the size blocks nobody.
+	if !sem.TryAcquire(1) {
+		t.Fatal("impossible waiter blocked TryAcquire")
+	}
+	sem.Release(1)
+	sem.Resize(3)
+	<-done
+	if cur := sem.Current(); cur != 3 {
+		t.Errorf("Current() = %d, want 3", cur)
+	}
+}
+
+func TestTinyCanceledZeroAlloc(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+	sem.Acquire(ctx, 1) // Allocate the waiter to be recycled.
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := sem.Acquire(ctx, 1); err != context.Canceled {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("canceled Acquire allocated %v times, want 0", allocs)
+	}
+	if waiters := sem.Waiters(); waiters != 0 {
+		t.Errorf("Waiters() = %d, want 0", waiters)
+	}
+}
@@ -0,0 +1,81 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Token records that a weight was acquired from a semaphore, and releases
+// exactly that weight, exactly once.
+type Token struct {
+	sem      *Weighted
+	n        int64
+	acquired time.Time
+	released atomic.Bool
+	held     atomic.Int64 // How long the weight was held, once released.
+}
+
+// NewToken returns a token recording that a weight of n was acquired from s.
+func NewToken(s *Weighted, n int64) *Token {
+	return &Token{sem: s, n: n, acquired: time.Now()}
+}
+
+// AcquireToken acquires the semaphore with a weight of n, as Acquire does, and
+// returns a token to release it with. On failure, returns ctx.Err() and a nil
+// token.
+func (s *Weighted) AcquireToken(ctx context.Context, n int64) (*Token, error) {
+	if err := s.Acquire(ctx, n); err != nil {
+		return nil, err
+	}
+	return NewToken(s, n), nil
+}
+
+// Semaphore returns the semaphore the token's weight was acquired from.
+func (t *Token) Semaphore() *Weighted {
+	return t.sem
+}
+
+// Weight returns the weight recorded by the token.
+func (t *Token) Weight() int64 {
+	return t.n
+}
+
+// Acquired returns when the token was created, which for AcquireToken is when
+// its weight was acquired.
+func (t *Token) Acquired() time.Time {
+	return t.acquired
+}
+
+// Held returns how long the token's weight has been held, or was held if the
+// token was released.
+func (t *Token) Held() time.Duration {
+	if held := t.held.Load(); held != 0 {
+		return time.Duration(held)
+	}
+	return time.Since(t.acquired)
+}
+
+// Released reports whether the token was released.
+func (t *Token) Released() bool {
+	return t.released.Load()
+}
+
+// Release releases the token's weight from its semaphore. It panics if the
+// token was already released.
+func (t *Token) Release() {
+	t.ReleaseWithReason("")
+}
+
+// ReleaseWithReason releases the token's weight from its semaphore, attributing
+// the release to reason; see Weighted.ReleaseWithReason. It panics if the token
+// was already released.
+func (t *Token) ReleaseWithReason(reason string) {
+	if !t.released.CompareAndSwap(false, true) {
+		panic("semaphore: token released twice")
+	}
+	t.held.Store(int64(time.Since(t.acquired)))
+	t.sem.release(t.n, reason)
+}
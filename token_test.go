@@ -0,0 +1,75 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenReleaseWithReason(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(4)
+	sem.Acquire(ctx, 3)
+	NewToken(sem, 1).ReleaseWithReason("success")
+	NewToken(sem, 1).ReleaseWithReason("timeout")
+	sem.ReleaseWithReason(1, "success")
+
+	if cur := sem.Current(); cur != 0 {
+		t.Errorf("got current %d, want 0", cur)
+	}
+	reasons := sem.ReleaseReasons()
+	if len(reasons) != 2 || reasons["success"] != 2 || reasons["timeout"] != 1 {
+		t.Errorf("got reasons %v, want map[success:2 timeout:1]", reasons)
+	}
+}
+
+func TestWeightedAcquireToken(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(3)
+	tok, err := sem.AcquireToken(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur, n := sem.Current(), tok.Weight(); cur != 2 || n != 2 {
+		t.Errorf("got current %d and token weight %d, want 2 and 2", cur, n)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	tok.Release()
+	held := tok.Held()
+	if !tok.Released() || held < 5*time.Millisecond {
+		t.Errorf("got released %v after holding for %v, want true after at least 5ms", tok.Released(), held)
+	}
+	time.Sleep(time.Millisecond)
+	if tok.Held() != held {
+		t.Error("hold time of a released token kept growing")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("double release of a token did not panic")
+		}
+		if cur := sem.Current(); cur != 0 {
+			t.Errorf("got current %d after double release, want 0", cur)
+		}
+	}()
+	tok.Release()
+}
+
+func TestWeightedAcquireTokenCanceled(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(1)
+	sem.Acquire(context.Background(), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if tok, err := sem.AcquireToken(ctx, 1); tok != nil || err != context.DeadlineExceeded {
+		t.Errorf("got %v, %v, want nil, %v", tok, err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"fmt"
+)
+
+// ExampleWeighted_AcquireUpTo shows an elastic batch job scaling its
+// parallelism to whatever capacity is free, instead of waiting for a fixed
+// amount of it.
+func ExampleWeighted_AcquireUpTo() {
+	ctx := context.Background()
+	sem := NewWeighted(8)
+	sem.Acquire(ctx, 5) // Held by other work.
+
+	workers, err := sem.AcquireUpTo(ctx, 4)
+	if err != nil {
+		return
+	}
+	defer sem.Release(workers)
+	fmt.Println("running", workers, "workers")
+	// Output: running 3 workers
+}
+
+// ExampleWeighted_TryAcquireUpTo shows a downloader opportunistically opening
+// extra connections with spare capacity, never blocking for it.
+func ExampleWeighted_TryAcquireUpTo() {
+	ctx := context.Background()
+	sem := NewWeighted(4)
+	sem.Acquire(ctx, 1) // The connection every download gets.
+
+	extra := sem.TryAcquireUpTo(8)
+	defer sem.Release(extra + 1)
+	fmt.Println("downloading over", extra+1, "connections")
+	// Output: downloading over 4 connections
+}
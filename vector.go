@@ -0,0 +1,247 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Vector is a weighted semaphore whose capacity and weights are vectors, e.g.
+// {cpu, memMB, iops}. An acquisition is admitted only when every dimension
+// fits, so several resources are acquired atomically instead of in sequence.
+//
+// Like Weighted, waiters are admitted in FIFO order, and requests that exceed
+// the size in some dimension are set aside until a Resize makes them possible.
+type Vector struct {
+	size              []int64
+	cur               []int64
+	mu                sync.Mutex
+	waiters           list.List
+	impossibleWaiters list.List
+}
+
+type vectorWaiter struct {
+	n     []int64
+	ready chan<- struct{} // Closed when semaphore acquired.
+	elem  *list.Element   // Current element, in either list.
+}
+
+// NewVector creates a new vector semaphore with the given maximum combined
+// weight per dimension.
+func NewVector(size ...int64) *Vector {
+	for _, n := range size {
+		if n < 0 {
+			panic("semaphore: bad vector size")
+		}
+	}
+	return &Vector{size: append([]int64(nil), size...), cur: make([]int64, len(size))}
+}
+
+// Acquire acquires the semaphore with a weight of n, blocking until resources
+// are available in every dimension or ctx is done. On success, returns nil. On
+// failure, returns ctx.Err() and leaves the semaphore unchanged.
+//
+// If ctx is already done, Acquire may still succeed without blocking.
+func (s *Vector) Acquire(ctx context.Context, n ...int64) error {
+	s.check(n)
+	s.mu.Lock()
+	if s.fits(n) && s.waiters.Len() == 0 {
+		s.add(n)
+		s.mu.Unlock()
+		report(currentInstrumentation(), "semaphore.vector.acquires", 1)
+		return nil
+	}
+
+	var waiterList = &s.waiters
+	if !s.possible(n) {
+		waiterList = &s.impossibleWaiters
+	}
+
+	ready := make(chan struct{})
+	w := &vectorWaiter{n: append([]int64(nil), n...), ready: ready}
+	w.elem = waiterList.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		s.mu.Lock()
+		select {
+		case <-ready:
+			err = nil
+		default:
+			// The waiter may have moved between the lists on Resize.
+			s.waiters.Remove(w.elem)
+			s.impossibleWaiters.Remove(w.elem)
+		}
+		s.mu.Unlock()
+		if err != nil {
+			report(currentInstrumentation(), "semaphore.vector.cancellations", 1)
+		} else {
+			report(currentInstrumentation(), "semaphore.vector.acquires", 1)
+		}
+		return err
+
+	case <-ready:
+		report(currentInstrumentation(), "semaphore.vector.acquires", 1)
+		return nil
+	}
+}
+
+// TryAcquire acquires the semaphore with a weight of n without blocking.
+// On success, returns true. On failure, returns false and leaves the semaphore unchanged.
+func (s *Vector) TryAcquire(n ...int64) bool {
+	s.check(n)
+	s.mu.Lock()
+	success := s.fits(n) && s.waiters.Len() == 0
+	if success {
+		s.add(n)
+	}
+	s.mu.Unlock()
+	if success {
+		report(currentInstrumentation(), "semaphore.vector.acquires", 1)
+	}
+	return success
+}
+
+// Release releases the semaphore with a weight of n.
+func (s *Vector) Release(n ...int64) {
+	s.check(n)
+	s.mu.Lock()
+	for i := range n {
+		if s.cur[i] < n[i] {
+			s.mu.Unlock()
+			panic("semaphore: bad release")
+		}
+	}
+	for i := range n {
+		s.cur[i] -= n[i]
+	}
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// Resize resizes the semaphore to the given maximum combined weight per
+// dimension.
+func (s *Vector) Resize(size ...int64) {
+	s.check(size)
+	for _, n := range size {
+		if n < 0 {
+			panic("semaphore: bad resize")
+		}
+	}
+
+	s.mu.Lock()
+	copy(s.size, size)
+
+	// Move waiters between the lists according to the new size, keeping their
+	// relative order.
+	var possible, impossible []*list.Element
+	for elem := s.impossibleWaiters.Front(); elem != nil; elem = elem.Next() {
+		if s.possible(elem.Value.(*vectorWaiter).n) {
+			possible = append(possible, elem)
+		}
+	}
+	for elem := s.waiters.Front(); elem != nil; elem = elem.Next() {
+		if !s.possible(elem.Value.(*vectorWaiter).n) {
+			impossible = append(impossible, elem)
+		}
+	}
+	for _, elem := range possible {
+		w := s.impossibleWaiters.Remove(elem).(*vectorWaiter)
+		w.elem = s.waiters.PushBack(w)
+	}
+	for _, elem := range impossible {
+		w := s.waiters.Remove(elem).(*vectorWaiter)
+		w.elem = s.impossibleWaiters.PushBack(w)
+	}
+
+	s.notifyWaiters()
+	s.mu.Unlock()
+}
+
+// Current returns the current usage per dimension.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Vector) Current() []int64 {
+	s.mu.Lock()
+	cur := append([]int64(nil), s.cur...)
+	s.mu.Unlock()
+	return cur
+}
+
+// Size returns the maximum size per dimension.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Vector) Size() []int64 {
+	s.mu.Lock()
+	size := append([]int64(nil), s.size...)
+	s.mu.Unlock()
+	return size
+}
+
+// Waiters returns the number of currently waiting Acquire calls.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Vector) Waiters() int {
+	s.mu.Lock()
+	waiters := s.waiters.Len() + s.impossibleWaiters.Len()
+	s.mu.Unlock()
+	return waiters
+}
+
+func (s *Vector) check(n []int64) {
+	if len(n) != len(s.cur) {
+		panic("semaphore: vector dimension mismatch")
+	}
+}
+
+// fits reports whether n is available now. Must be called with s.mu held.
+func (s *Vector) fits(n []int64) bool {
+	for i := range n {
+		if s.size[i]-s.cur[i] < n[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// possible reports whether n fits in an idle semaphore. Must be called with
+// s.mu held.
+func (s *Vector) possible(n []int64) bool {
+	for i := range n {
+		if n[i] > s.size[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// add adds n to the current usage. Must be called with s.mu held.
+func (s *Vector) add(n []int64) {
+	for i := range n {
+		s.cur[i] += n[i]
+	}
+}
+
+// notifyWaiters admits queued waiters in FIFO order while they fit. Must be
+// called with s.mu held.
+func (s *Vector) notifyWaiters() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			break // No more waiters blocked.
+		}
+
+		w := next.Value.(*vectorWaiter)
+		if !s.fits(w.n) {
+			// Not enough resources for the next waiter in some dimension; as in
+			// Weighted, leave the remaining waiters blocked to avoid starving
+			// large requests.
+			break
+		}
+
+		s.add(w.n)
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
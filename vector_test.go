@@ -0,0 +1,82 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVector(t *testing.T) {
+	t.Parallel()
+
+	sem := NewVector(4, 1024) // cpu, memMB
+
+	tries := []bool{}
+	tries = append(tries, sem.TryAcquire(2, 512)) // true;  2/4, 512/1024
+	tries = append(tries, sem.TryAcquire(1, 768)) // false; memory doesn't fit
+	tries = append(tries, sem.TryAcquire(2, 512)) // true;  4/4, 1024/1024
+	sem.Release(2, 512)
+	tries = append(tries, sem.TryAcquire(3, 1)) // false; cpu doesn't fit
+
+	want := []bool{true, false, true, false}
+	for i := range tries {
+		if tries[i] != want[i] {
+			t.Errorf("tries[%d]: got %t, want %t", i, tries[i], want[i])
+		}
+	}
+}
+
+func TestVectorResizeUnblockImpossible(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewVector(2, 2)
+
+	done := make(chan struct{})
+	go func() {
+		sem.Acquire(ctx, 1, 3)
+		close(done)
+	}()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The impossible waiter must not block possible ones.
+	if !sem.TryAcquire(1, 1) {
+		t.Fatal("impossible waiter blocked a possible acquisition")
+	}
+	sem.Release(1, 1)
+
+	sem.Resize(2, 3)
+	<-done
+	if cur := sem.Current(); cur[0] != 1 || cur[1] != 3 {
+		t.Errorf("got current %v, want [1 3]", cur)
+	}
+}
+
+func TestVectorCancelAfterResize(t *testing.T) {
+	t.Parallel()
+
+	sem := NewVector(1)
+	sem.Acquire(context.Background(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() { errs <- sem.Acquire(ctx, 2) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sem.Resize(2) // Moves the waiter to the possible list.
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	sem.Release(1)
+	if cur := sem.Current(); cur[0] != 0 {
+		t.Errorf("canceled waiter was granted, current %v", cur)
+	}
+}
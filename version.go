@@ -0,0 +1,21 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// Version returns the version of the semaphore's state, which increases on
+// every acquisition, release, resize and state transition. Controllers and
+// caches can keep the version of their last observation and check it with
+// ChangedSince instead of comparing every value.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Version() uint64 {
+	s.lock()
+	version := s.fastVersion()
+	s.mu.Unlock()
+	return version
+}
+
+// ChangedSince reports whether the semaphore's state changed since it was at
+// version v, as returned by Version.
+func (s *Weighted) ChangedSince(v uint64) bool {
+	return s.Version() != v
+}
@@ -0,0 +1,44 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWeightedVersion(t *testing.T) {
+	t.Parallel()
+
+	sem := NewWeighted(2)
+	v := sem.Version()
+	if sem.ChangedSince(v) {
+		t.Fatal("idle semaphore changed")
+	}
+
+	tries := []struct {
+		name string
+		fn   func()
+	}{
+		{"Acquire", func() { sem.Acquire(context.Background(), 1) }},
+		{"TryAcquire", func() { sem.TryAcquire(1) }},
+		{"Release", func() { sem.Release(2) }},
+		{"Resize", func() { sem.Resize(3) }},
+		{"Pause", func() { sem.Pause() }},
+	}
+	for i, try := range tries {
+		try.fn()
+		if !sem.ChangedSince(v) {
+			t.Errorf("tries[%d]: %s didn't change the version", i, try.name)
+		}
+		next := sem.Version()
+		if next <= v {
+			t.Errorf("tries[%d]: %s moved the version from %d to %d", i, try.name, v, next)
+		}
+		v = next
+	}
+
+	if sem.TryAcquire(1) || sem.ChangedSince(v) {
+		t.Error("failed TryAcquire changed the version")
+	}
+}
@@ -0,0 +1,65 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+)
+
+// WaiterInfo describes a queued Acquire call.
+type WaiterInfo struct {
+	// Weight is the weight the call asks for; for AcquireUpTo, the least it
+	// accepts.
+	Weight int64
+	// Enqueued is when the call started waiting.
+	Enqueued time.Time
+	// Impossible is whether the weight exceeds the semaphore's size.
+	Impossible bool
+	// Priority is the priority given to AcquireWithPriority, without aging.
+	Priority int
+	// Labels are the pprof labels of the call's context, if any.
+	Labels map[string]string
+}
+
+// Waiting calls yield for every queued Acquire call, in the order they queued
+// followed by the impossible ones, until yield returns false. Without
+// priorities, that is the order they will be admitted in. It can
+// be ranged over:
+//
+//	for w := range sem.Waiting {
+//		...
+//	}
+//
+// The waiters are a snapshot taken under the semaphore's lock, so they are
+// consistent with each other, and yield runs without it held.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) Waiting(yield func(WaiterInfo) bool) {
+	type queued struct {
+		info WaiterInfo
+		ctx  context.Context
+	}
+	s.lock()
+	snapshot := make([]queued, 0, s.waiters.Len()+s.impossibleWaiters.Len())
+	for _, l := range []*waiterList{&s.waiters, &s.impossibleWaiters} {
+		for w := l.Front(); w != nil; w = w.Next() {
+			info := WaiterInfo{Weight: w.n, Enqueued: w.enqueued, Impossible: l == &s.impossibleWaiters, Priority: w.priority}
+			snapshot = append(snapshot, queued{info: info, ctx: w.ctx})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, q := range snapshot {
+		pprof.ForLabels(q.ctx, func(key, value string) bool {
+			if q.info.Labels == nil {
+				q.info.Labels = make(map[string]string)
+			}
+			q.info.Labels[key] = value
+			return true
+		})
+		if !yield(q.info) {
+			return
+		}
+	}
+}
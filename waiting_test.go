@@ -0,0 +1,67 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+func TestWeightedWaiting(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	sem := NewWeighted(2)
+	sem.Acquire(ctx, 2)
+
+	labeled := pprof.WithLabels(ctx, pprof.Labels("route", "/search"))
+	for i, n := range []int64{3, 1, 2} {
+		actx := ctx
+		if n == 1 {
+			actx = labeled
+		}
+		go sem.Acquire(actx, n)
+		for sem.Waiters() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	var got []WaiterInfo
+	for w := range sem.Waiting {
+		got = append(got, w)
+	}
+	want := []struct {
+		weight     int64
+		impossible bool
+	}{{1, false}, {2, false}, {3, true}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d waiters, want %d", len(got), len(want))
+	}
+	for i, w := range got {
+		if w.Weight != want[i].weight || w.Impossible != want[i].impossible {
+			t.Errorf("waiters[%d]: got weight %d impossible %t, want %d %t", i, w.Weight, w.Impossible, want[i].weight, want[i].impossible)
+		}
+		if w.Enqueued.IsZero() {
+			t.Errorf("waiters[%d]: no enqueue time", i)
+		}
+	}
+	if route := got[0].Labels["route"]; route != "/search" {
+		t.Errorf("waiters[0]: got route label %q, want \"/search\"", route)
+	}
+	if got[1].Labels != nil {
+		t.Errorf("waiters[1]: got labels %v, want none", got[1].Labels)
+	}
+
+	n := 0
+	for range sem.Waiting {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("break stopped iteration after %d waiters, want 1", n)
+	}
+
+	sem.Resize(6)
+}
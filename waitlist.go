@@ -0,0 +1,63 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+// waiterList is an intrusive doubly linked list of waiters. Unlike
+// container/list it allocates nothing, and a waiter knows which list it is in,
+// so it can be removed wherever Resize has moved it.
+type waiterList struct {
+	front, back *waiter
+	len         int
+}
+
+// Front returns the first waiter of l, or nil.
+func (l *waiterList) Front() *waiter {
+	return l.front
+}
+
+// Back returns the last waiter of l, or nil.
+func (l *waiterList) Back() *waiter {
+	return l.back
+}
+
+// Len returns the number of waiters in l.
+func (l *waiterList) Len() int {
+	return l.len
+}
+
+// PushBack appends w, which must not be in a list, to l.
+func (l *waiterList) PushBack(w *waiter) {
+	w.list = l
+	w.prev = l.back
+	if l.back == nil {
+		l.front = w
+	} else {
+		l.back.next = w
+	}
+	l.back = w
+	l.len++
+}
+
+// Remove removes w from l, if it is in l.
+func (l *waiterList) Remove(w *waiter) {
+	if w.list != l {
+		return
+	}
+	if w.prev == nil {
+		l.front = w.next
+	} else {
+		w.prev.next = w.next
+	}
+	if w.next == nil {
+		l.back = w.prev
+	} else {
+		w.next.prev = w.prev
+	}
+	w.list, w.prev, w.next = nil, nil, nil
+	l.len--
+}
+
+// Next returns the waiter after w in its list, or nil.
+func (w *waiter) Next() *waiter {
+	return w.next
+}
@@ -0,0 +1,70 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import "time"
+
+// WaitStats summarizes the waits of Acquire calls over the rolling window set
+// WithWaitTracking. Acquisitions that didn't block count as waits of 0, and
+// waits abandoned because their context was done count too, so a queue that
+// builds up shows in the percentiles before callers start timing out.
+//
+// The window keeps the latest 4096 waits that blocked; past that, older ones
+// within the window are no longer counted. Waits of 0 are counted in up to 64
+// runs per window, each expiring with its first wait.
+type WaitStats struct {
+	Count int
+	Mean  time.Duration
+	Max   time.Duration
+	// Percentiles maps each tracked quantile to its wait.
+	Percentiles map[float64]time.Duration
+}
+
+// WithWaitTracking tracks how long Acquire calls wait over a rolling window,
+// for WaitStats to report the given quantiles, each in [0, 1], or the 0.5, 0.95
+// and 0.99 quantiles if none are given.
+func WithWaitTracking(window time.Duration, quantiles ...float64) Option {
+	if window <= 0 {
+		panic("semaphore: bad wait tracking window")
+	}
+	for _, q := range quantiles {
+		if q < 0 || q > 1 {
+			panic("semaphore: bad wait tracking quantile")
+		}
+	}
+	if len(quantiles) == 0 {
+		quantiles = []float64{0.5, 0.95, 0.99}
+	}
+	return func(s *Weighted) {
+		s.waits = newWaitWindow(window)
+		s.waitQuantiles = quantiles
+	}
+}
+
+// WaitStats returns statistics of the waits within the window, or the zero
+// WaitStats if the semaphore wasn't created WithWaitTracking.
+// Returned value may instantly change after/during call. use for diagnostic and health-checking only.
+func (s *Weighted) WaitStats() WaitStats {
+	s.lock()
+	if s.waits == nil {
+		s.mu.Unlock()
+		return WaitStats{}
+	}
+	samples := s.waits.snapshot(time.Now())
+	s.mu.Unlock()
+
+	d := newWaitDistribution(samples)
+	stats := WaitStats{Count: d.count, Mean: d.mean(), Max: d.max(), Percentiles: make(map[float64]time.Duration, len(s.waitQuantiles))}
+	for _, q := range s.waitQuantiles {
+		stats.Percentiles[q] = d.percentile(q)
+	}
+	return stats
+}
+
+// waited records a wait of an Acquire call that ended now, if tracked. Must be
+// called with s.mu held.
+func (s *Weighted) waited(wait time.Duration) {
+	if s.waits != nil {
+		s.waits.observe(time.Now(), wait)
+	}
+}
@@ -0,0 +1,97 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWeightedWaitStats(t *testing.T) {
+	t.Parallel()
+
+	if stats := NewWeighted(1).WaitStats(); stats.Count != 0 || stats.Percentiles != nil {
+		t.Errorf("untracked semaphore got %+v, want the zero WaitStats", stats)
+	}
+
+	ctx := context.Background()
+	sem := NewWeighted(1, WithWaitTracking(time.Minute, 0.5, 1))
+	for i := 0; i < 3; i++ {
+		sem.Acquire(ctx, 1)
+		sem.Release(1)
+	}
+	sem.Acquire(ctx, 1)
+	done := make(chan error)
+	go func() { done <- sem.Acquire(ctx, 1) }()
+	for sem.Waiters() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	sem.Release(1)
+	<-done
+
+	stats := sem.WaitStats()
+	if stats.Count != 5 {
+		t.Errorf("got %d waits, want 5", stats.Count)
+	}
+	if p50 := stats.Percentiles[0.5]; p50 != 0 {
+		t.Errorf("got p50 %v, want 0", p50)
+	}
+	if max, p100 := stats.Max, stats.Percentiles[1]; max < 20*time.Millisecond || p100 != max {
+		t.Errorf("got max %v and p100 %v, want the blocked wait of at least 20ms", max, p100)
+	}
+	if mean := stats.Mean; mean != stats.Max/5 {
+		t.Errorf("got mean %v, want %v", mean, stats.Max/5)
+	}
+}
+
+func TestWaitWindowBounded(t *testing.T) {
+	t.Parallel()
+
+	w := newWaitWindow(time.Minute)
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		w.observe(now, 0)
+	}
+	for i := 1; i <= waitWindowCap+10; i++ {
+		w.observe(now, time.Duration(i))
+	}
+	samples := w.snapshot(now)
+	if len(samples) != waitWindowCap {
+		t.Fatalf("got %d samples, want %d", len(samples), waitWindowCap)
+	}
+	// The run of waits of 0 and the first blocked waits were overwritten.
+	if oldest := samples[0].wait; oldest != 11 {
+		t.Errorf("got oldest wait %v, want 11ns", oldest)
+	}
+
+	w = newWaitWindow(time.Minute)
+	for i := 0; i < 1000; i++ {
+		w.observe(now, 0)
+	}
+	w.observe(now, time.Second)
+	samples = w.snapshot(now)
+	if len(samples) != 2 {
+		t.Errorf("got %d samples, want a run of waits of 0 and the blocked wait", len(samples))
+	}
+	d := newWaitDistribution(samples)
+	if d.count != 1001 {
+		t.Errorf("got %d waits, want 1001", d.count)
+	}
+	tries := []struct {
+		got, want time.Duration
+	}{
+		{d.percentile(0.99), 0},
+		{d.percentile(1), time.Second},
+		{d.mean(), time.Second / 1001},
+	}
+	for i, try := range tries {
+		if try.got != try.want {
+			t.Errorf("tries[%d]: got %v, want %v", i, try.got, try.want)
+		}
+	}
+	if n := len(w.snapshot(now.Add(time.Minute))); n != 0 {
+		t.Errorf("got %d samples a window later, want 0", n)
+	}
+}
@@ -0,0 +1,100 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// topHolders is the number of callers named in a debug utilization warning.
+const topHolders = 3
+
+// utilizationWarning logs while a semaphore stays highly utilized.
+type utilizationWarning struct {
+	logger    *slog.Logger
+	threshold float64
+	after     time.Duration
+	every     time.Duration
+	since     time.Time // When utilization rose above threshold; zero if below.
+	timer     *time.Timer
+	gen       uint64 // Bumped on every arm, so a timer that fired after a disarm sees it was superseded.
+}
+
+// WithUtilizationWarning logs a warning to logger when the semaphore's
+// utilization, the fraction of its size in use, stays at or above threshold for
+// longer than after, and again every interval for as long as it stays there.
+// Warnings include the current usage and queue depth, as an early warning that
+// needs no dashboard. When the logger is enabled for debug level and the
+// semaphore has a caller limit, they also name the callers holding the most.
+//
+// If logger is nil, warnings go to the logger of the semaphore's
+// Instrumentation, if any.
+func WithUtilizationWarning(logger *slog.Logger, threshold float64, after, every time.Duration) Option {
+	if every <= 0 {
+		panic("semaphore: bad warning interval")
+	}
+	return func(s *Weighted) {
+		s.warning = &utilizationWarning{logger: logger, threshold: threshold, after: after, every: every}
+	}
+}
+
+// checkUtilization arms or disarms the utilization warning. Must be called with
+// s.mu held.
+func (s *Weighted) checkUtilization(utilization float64) {
+	w := s.warning
+	above := utilization >= w.threshold
+	switch {
+	case above && w.since.IsZero():
+		w.since = time.Now()
+		w.gen++
+		gen := w.gen
+		w.timer = time.AfterFunc(w.after, func() { s.warnUtilization(gen) })
+	case !above && !w.since.IsZero():
+		w.since = time.Time{}
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// warnUtilization logs a warning and re-arms the timer of generation gen,
+// unless the warning was disarmed or re-armed since.
+func (s *Weighted) warnUtilization(gen uint64) {
+	s.lock()
+	w := s.warning
+	if w.since.IsZero() || w.gen != gen {
+		// The timer fired while being stopped, and waited for s.mu.
+		s.mu.Unlock()
+		return
+	}
+	attrs := []slog.Attr{
+		slog.Duration("for", time.Since(w.since).Round(time.Millisecond)),
+		slog.Int64("cur", s.cur),
+		slog.Int64("size", s.size),
+		slog.Int("waiters", s.waiters.Len()+s.impossibleWaiters.Len()),
+	}
+	if s.name != "" {
+		attrs = append(attrs, slog.String("semaphore", s.name))
+	}
+	w.timer = time.AfterFunc(w.every, func() { s.warnUtilization(gen) })
+	callers := s.callers
+	s.mu.Unlock()
+
+	logger := w.logger
+	if inst := s.instrumentation(); logger == nil && inst != nil {
+		logger = inst.Logger()
+	}
+	if logger == nil {
+		return
+	}
+	ctx := context.Background()
+	if callers != nil && logger.Enabled(ctx, slog.LevelDebug) {
+		var holders []any
+		for _, u := range callers.top(topHolders) {
+			holders = append(holders, slog.Int64(u.key, u.inUse))
+		}
+		attrs = append(attrs, slog.Group("holders", holders...))
+	}
+	logger.LogAttrs(ctx, slog.LevelWarn, "semaphore: sustained high utilization", attrs...)
+}
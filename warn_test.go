@@ -0,0 +1,112 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of a logger.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWeightedUtilizationWarning(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+	sem := NewWeighted(4, WithName("db"), WithUtilizationWarning(logger, 0.75, 10*time.Millisecond, 10*time.Millisecond))
+
+	// A short spike doesn't warn.
+	sem.Acquire(ctx, 4)
+	sem.Release(4)
+	time.Sleep(20 * time.Millisecond)
+	if s := out.String(); s != "" {
+		t.Fatalf("warned about a short spike: %s", s)
+	}
+
+	sem.Acquire(ctx, 3)
+	time.Sleep(35 * time.Millisecond)
+	sem.Release(3)
+	time.Sleep(20 * time.Millisecond)
+
+	logged := out.String()
+	if n := strings.Count(logged, "sustained high utilization"); n < 2 || n > 3 {
+		t.Errorf("got %d warnings, want 2 or 3:\n%s", n, logged)
+	}
+	if !strings.Contains(logged, "cur=3 size=4 waiters=0 semaphore=db") {
+		t.Errorf("warning lacks usage details:\n%s", logged)
+	}
+}
+
+func TestWeightedUtilizationWarningHolders(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	sem := NewWeighted(4, WithCallerLimit(4), WithUtilizationWarning(logger, 1, 0, time.Hour))
+
+	sem.AcquireAs(ctx, "a", 1)
+	sem.AcquireAs(ctx, "b", 3)
+	time.Sleep(20 * time.Millisecond)
+
+	if logged := out.String(); !strings.Contains(logged, "holders.b=3 holders.a=1") {
+		t.Errorf("warning lacks top holders:\n%s", logged)
+	}
+	sem.ReleaseAs("a", 1)
+	sem.ReleaseAs("b", 3)
+}
+
+func TestWeightedUtilizationWarningRearm(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+	sem := NewWeighted(1, WithUtilizationWarning(logger, 1, time.Hour, time.Hour))
+
+	sem.Acquire(ctx, 1)
+	sem.lock()
+	stale := sem.warning.gen
+	sem.mu.Unlock()
+	sem.Release(1)
+	sem.Acquire(ctx, 1)
+	sem.lock()
+	armed := sem.warning.timer
+	sem.mu.Unlock()
+
+	// The first timer fires after it was stopped and the warning re-armed: it
+	// must neither warn nor start a second chain of warnings.
+	sem.warnUtilization(stale)
+	if s := out.String(); s != "" {
+		t.Errorf("superseded timer warned: %s", s)
+	}
+	sem.lock()
+	if sem.warning.timer != armed {
+		t.Error("superseded timer armed another")
+	}
+	sem.mu.Unlock()
+	sem.Release(1)
+}
@@ -0,0 +1,104 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// holdWatchdog reports holds of a semaphore held for too long.
+type holdWatchdog struct {
+	after  time.Duration
+	logger *slog.Logger
+	onSlow func(h HoldInfo, held time.Duration)
+	timer  *time.Timer
+}
+
+// WithSlowHolderWatchdog reports every hold of the semaphore that is held for
+// longer than after, once: long-held weight starves everyone else, and is
+// otherwise invisible. Reports go to onSlow if not nil, and as warnings to
+// logger, or if logger is nil and onSlow is nil too, to the logger of the
+// semaphore's Instrumentation, if any. They describe the hold as Holders does,
+// so they include its stack if the semaphore also has
+// WithHolderTracking(true).
+//
+// The watchdog tracks holds as WithHolderTracking does, with its costs and its
+// limits: Releases are matched to holds by weight, and holds acquired through
+// AcquireChan are not watched.
+func WithSlowHolderWatchdog(after time.Duration, logger *slog.Logger, onSlow func(h HoldInfo, held time.Duration)) Option {
+	if after <= 0 {
+		panic("semaphore: bad watchdog duration")
+	}
+	return func(s *Weighted) {
+		s.watchdog = &holdWatchdog{after: after, logger: logger, onSlow: onSlow}
+		if s.holders == nil {
+			s.holders = &holderTracking{}
+		}
+	}
+}
+
+// armWatchdog starts the watchdog's timer for a new hold, unless it runs
+// already. Must be called with s.mu held.
+func (s *Weighted) armWatchdog() {
+	if w := s.watchdog; w != nil && w.timer == nil {
+		w.timer = time.AfterFunc(w.after, s.checkSlowHolders)
+	}
+}
+
+// checkSlowHolders reports the holds held for too long that weren't reported
+// yet, and rearms the timer for the next one.
+func (s *Weighted) checkSlowHolders() {
+	s.lock()
+	w := s.watchdog
+	now := time.Now()
+	var slow []trackedHold // Copies: releases change the weight of holds.
+	w.timer = nil
+	for _, h := range s.holders.holds {
+		if h.reported {
+			continue
+		}
+		held := now.Sub(h.info.Acquired)
+		if held < w.after {
+			// Holds are oldest first, so this one is due next.
+			w.timer = time.AfterFunc(w.after-held, s.checkSlowHolders)
+			break
+		}
+		h.reported = true
+		slow = append(slow, *h)
+	}
+	name := s.name
+	s.mu.Unlock()
+
+	logger := w.logger
+	if inst := s.instrumentation(); logger == nil && w.onSlow == nil && inst != nil {
+		logger = inst.Logger()
+	}
+	for _, h := range slow {
+		info, held := h.info, now.Sub(h.info.Acquired)
+		if h.pcs != nil {
+			info.Stack = formatStack(h.pcs)
+		}
+		if w.onSlow != nil {
+			w.onSlow(info, held)
+		}
+		if logger == nil {
+			continue
+		}
+		attrs := []slog.Attr{
+			slog.Duration("held", held.Round(time.Millisecond)),
+			slog.Int64("n", info.Weight),
+		}
+		if name != "" {
+			attrs = append(attrs, slog.String("semaphore", name))
+		}
+		if info.Label != "" {
+			attrs = append(attrs, slog.String("holder", info.Label))
+		}
+		if info.Stack != "" {
+			attrs = append(attrs, slog.String("stack", info.Stack))
+		}
+		logger.LogAttrs(context.Background(), slog.LevelWarn, "semaphore: slow holder", attrs...)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWeightedSlowHolderWatchdog(t *testing.T) {
+	t.Parallel()
+
+	slow := make(chan HoldInfo, 4)
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+	sem := NewWeighted(10, WithSlowHolderWatchdog(20*time.Millisecond, logger, func(h HoldInfo, held time.Duration) {
+		if held < 20*time.Millisecond {
+			t.Errorf("reported after %v, want at least 20ms", held)
+		}
+		slow <- h
+	}))
+
+	ctx := ContextWithCaller(context.Background(), "stuck-worker")
+	if err := sem.Acquire(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	sem.TryAcquire(1)
+	sem.Release(1) // Released in time, so never reported.
+
+	if h := <-slow; h.Weight != 3 || h.Label != "stuck-worker" {
+		t.Errorf("got hold %d of %q, want 3 of %q", h.Weight, h.Label, "stuck-worker")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(slow) != 0 {
+		t.Errorf("got %d more reports, want every hold reported once", len(slow))
+	}
+
+	if log := out.String(); !strings.Contains(log, "semaphore: slow holder") || !strings.Contains(log, "holder=stuck-worker") {
+		t.Errorf("got log %q, want the slow holder", log)
+	}
+}
+
+func TestWeightedSlowHolderWatchdogConcurrentRelease(t *testing.T) {
+	t.Parallel()
+
+	reported := make(chan struct{}, 100)
+	sem := NewWeighted(100, WithSlowHolderWatchdog(time.Millisecond, nil, func(HoldInfo, time.Duration) {
+		reported <- struct{}{}
+	}))
+	for i := 0; i < 10; i++ {
+		sem.TryAcquire(3)
+	}
+	<-reported
+	// Shrinking holds in place races with reports still being made.
+	for i := 0; i < 10; i++ {
+		sem.Release(1)
+		sem.Release(2)
+	}
+}
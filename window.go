@@ -0,0 +1,155 @@
+//go:build !tinygo && !js
+
+package semaphore
+
+import (
+	"sort"
+	"time"
+)
+
+// waitWindowCap is the most samples a waitWindow keeps. Past it, the oldest
+// are overwritten, so a window only covers the latest waits if more than that
+// many ended within it.
+const waitWindowCap = 4096
+
+// waitRuns is the most runs waits of 0 are split into per window. Waits of 0,
+// the common case, are counted in runs rather than one sample each; a run
+// expires with its first wait.
+const waitRuns = 64
+
+// waitWindow records wait durations for statistics over those observed within
+// a rolling window, in a ring of at most waitWindowCap samples. It is not safe
+// for concurrent use.
+type waitWindow struct {
+	window  time.Duration
+	samples []waitSample // The ring, grown up to waitWindowCap.
+	head, n int          // The index of the oldest sample and the number held.
+}
+
+type waitSample struct {
+	at   time.Time // When the wait, or the first of the run, ended.
+	wait time.Duration
+	n    int // The number of waits, more than 1 only for a run of waits of 0.
+}
+
+func newWaitWindow(window time.Duration) *waitWindow {
+	return &waitWindow{window: window}
+}
+
+// sample returns the i-th oldest sample.
+func (w *waitWindow) sample(i int) *waitSample {
+	return &w.samples[(w.head+i)%len(w.samples)]
+}
+
+// observe records a wait that ended at now.
+func (w *waitWindow) observe(now time.Time, wait time.Duration) {
+	w.expire(now)
+	if wait == 0 && w.n > 0 {
+		if last := w.sample(w.n - 1); last.wait == 0 && now.Sub(last.at) < w.window/waitRuns {
+			last.n++
+			return
+		}
+	}
+	if w.n == len(w.samples) {
+		if len(w.samples) == waitWindowCap {
+			// Full: overwrite the oldest.
+			*w.sample(0) = waitSample{at: now, wait: wait, n: 1}
+			w.head = (w.head + 1) % len(w.samples)
+			return
+		}
+		w.grow()
+	}
+	*w.sample(w.n) = waitSample{at: now, wait: wait, n: 1}
+	w.n++
+}
+
+// grow doubles the ring, up to waitWindowCap.
+func (w *waitWindow) grow() {
+	size := 2 * len(w.samples)
+	if size < 16 {
+		size = 16
+	}
+	if size > waitWindowCap {
+		size = waitWindowCap
+	}
+	samples := make([]waitSample, size)
+	for i := 0; i < w.n; i++ {
+		samples[i] = *w.sample(i)
+	}
+	w.samples, w.head = samples, 0
+}
+
+// expire drops samples older than the window.
+func (w *waitWindow) expire(now time.Time) {
+	cutoff := now.Add(-w.window)
+	for w.n > 0 && !w.sample(0).at.After(cutoff) {
+		w.head = (w.head + 1) % len(w.samples)
+		w.n--
+	}
+}
+
+// snapshot returns a copy of the samples within the window at now, to build a
+// waitDistribution from without holding the lock guarding w.
+func (w *waitWindow) snapshot(now time.Time) []waitSample {
+	w.expire(now)
+	samples := make([]waitSample, w.n)
+	for i := range samples {
+		samples[i] = *w.sample(i)
+	}
+	return samples
+}
+
+// waitDistribution is the distribution of the waits of a snapshot.
+type waitDistribution struct {
+	samples []waitSample // By wait, ascending.
+	count   int
+}
+
+// newWaitDistribution sorts samples by wait, in place.
+func newWaitDistribution(samples []waitSample) waitDistribution {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].wait < samples[j].wait })
+	d := waitDistribution{samples: samples}
+	for _, s := range samples {
+		d.count += s.n
+	}
+	return d
+}
+
+// mean returns the mean wait, or 0 for no waits.
+func (d waitDistribution) mean() time.Duration {
+	if d.count == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, s := range d.samples {
+		total += s.wait * time.Duration(s.n)
+	}
+	return total / time.Duration(d.count)
+}
+
+// max returns the longest wait, or 0 for no waits.
+func (d waitDistribution) max() time.Duration {
+	if len(d.samples) == 0 {
+		return 0
+	}
+	return d.samples[len(d.samples)-1].wait
+}
+
+// percentile returns the q-quantile, q in [0, 1], of the waits using the
+// nearest-rank method. Returns 0 for no waits.
+func (d waitDistribution) percentile(q float64) time.Duration {
+	if d.count == 0 {
+		return 0
+	}
+	rank := int(q*float64(d.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	for _, s := range d.samples {
+		if rank <= s.n {
+			return s.wait
+		}
+		rank -= s.n
+	}
+	return d.max()
+}